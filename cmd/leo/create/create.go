@@ -2,8 +2,13 @@ package create
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"os"
+	"sort"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alessio/shellescape"
@@ -15,20 +20,32 @@ import (
 )
 
 type Options struct {
-	Environment   map[string]string
-	Exclude       []string
-	Image         string
-	Machine       string
-	Name          string
-	Output        string
-	Parallelism   int
-	PermissionSet string
-	Script        string
-	Spot          bool
-	Storage       int
-	Tags          map[string]string
-	Timeout       int
-	Workdir       string
+	BandwidthLimit string
+	Bundle         bool
+	Checkers       int
+	DryRun         bool
+	Environment    map[string]string
+	Exclude        []string
+	Image          string
+	Machine        string
+	MaxCost        float64
+	Merge          string
+	Name           string
+	Output         string
+	Parallelism    int
+	PerMachine     bool
+	PermissionSet  string
+	QueueFile      string
+	QueuePrefix    string
+	QueueRetries   int
+	Resume         string
+	Script         string
+	Spot           bool
+	Storage        int
+	Tags           map[string]string
+	Timeout        int
+	Transfers      int
+	Workdir        string
 }
 
 func New(cloud *common.Cloud) *cobra.Command {
@@ -43,19 +60,31 @@ func New(cloud *common.Cloud) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&o.BandwidthLimit, "bwlimit", "", "bandwidth limit for transfers, with the rclone --bwlimit syntax; e.g. 10M")
+	cmd.Flags().BoolVar(&o.Bundle, "bundle", false, "transfer the working directory and outputs as compressed archives; faster for many small files")
+	cmd.Flags().IntVar(&o.Checkers, "checkers", 0, "number of files to check in parallel during transfers; 0 uses the rclone default")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "print the resources that would be created, without creating them")
 	cmd.Flags().StringToStringVar(&o.Environment, "environment", map[string]string{}, "environment variables")
 	cmd.Flags().StringVar(&o.Image, "image", "ubuntu", "machine image")
 	cmd.Flags().StringVar(&o.Machine, "machine", "m", "machine type")
+	cmd.Flags().Float64Var(&o.MaxCost, "max-cost", 0, "maximum cost in USD; the task is stopped when its spend exceeds it")
+	cmd.Flags().StringVar(&o.Merge, "merge", "", "how to combine per-machine outputs when downloading them: newest or strict; by default, they're downloaded to machines/<index>")
 	cmd.Flags().StringVar(&o.Name, "name", "", "deterministic name")
 	cmd.Flags().StringVar(&o.Output, "output", "", "output directory to download")
 	cmd.Flags().StringSliceVar(&o.Exclude, "exclude", nil, "comma-separated list of paths to exclude from uploading and downloading")
 	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 1, "parallelism")
+	cmd.Flags().BoolVar(&o.PerMachine, "per-machine-output", false, "sync the working directory of every machine to a directory of its own, so parallel machines don't overwrite each other's outputs")
 	cmd.Flags().StringVar(&o.PermissionSet, "permission-set", "", "permission set")
+	cmd.Flags().StringVar(&o.QueueFile, "queue-file", "", "file with a work item on every line, to run the script once for each")
+	cmd.Flags().StringVar(&o.QueuePrefix, "queue-prefix", "", "rclone path with a work item for every object under it, to run the script once for each")
+	cmd.Flags().IntVar(&o.QueueRetries, "queue-retries", 0, "number of times work items whose script fails go back to the queue before they're marked as failed")
+	cmd.Flags().StringVar(&o.Resume, "resume", "", "resume the interrupted creation of the task with the given identifier")
 	cmd.Flags().StringVar(&o.Script, "script", "", "script to run")
 	cmd.Flags().BoolVar(&o.Spot, "spot", false, "use spot instances")
 	cmd.Flags().IntVar(&o.Storage, "disk-size", -1, "disk size in gigabytes")
 	cmd.Flags().StringToStringVar(&o.Tags, "tags", map[string]string{}, "resource tags")
 	cmd.Flags().IntVar(&o.Timeout, "timeout", 24*60*60, "timeout")
+	cmd.Flags().IntVar(&o.Transfers, "transfers", 0, "number of files to transfer in parallel; 0 uses the rclone default")
 	cmd.Flags().StringVar(&o.Workdir, "workdir", ".", "working directory to upload")
 	cmd.Flags().SetInterspersed(false)
 
@@ -63,6 +92,10 @@ func New(cloud *common.Cloud) *cobra.Command {
 }
 
 func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	if o.Parallelism < 1 || o.Parallelism > math.MaxUint16 {
+		return fmt.Errorf("parallelism must be between 1 and %d", math.MaxUint16)
+	}
+
 	variables := make(map[string]*string)
 	for name, value := range o.Environment {
 		name = strings.ToUpper(name)
@@ -93,14 +126,28 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 			DirectoryOut: o.Output,
 			ExcludeList:  o.Exclude,
 			Timeout:      time.Duration(o.Timeout) * time.Second,
+			Queue: common.Queue{
+				File:    o.QueueFile,
+				Prefix:  o.QueuePrefix,
+				Retries: o.QueueRetries,
+			},
+			PerMachineOutput: o.PerMachine,
+			OutputMerge:      common.MergePolicy(o.Merge),
+			Transfer: common.Transfer{
+				Bundle:         o.Bundle,
+				Transfers:      o.Transfers,
+				Checkers:       o.Checkers,
+				BandwidthLimit: o.BandwidthLimit,
+			},
 		},
 		Firewall: common.Firewall{
 			Ingress: common.FirewallRule{
 				Ports: &[]uint16{22},
 			},
 		},
-		Parallelism:   uint16(1),
+		Parallelism:   uint16(o.Parallelism),
 		PermissionSet: o.PermissionSet,
+		MaxCost:       o.MaxCost,
 	}
 
 	cfg.Spot = common.Spot(common.SpotDisabled)
@@ -113,6 +160,30 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 		id = identifier
 	}
 
+	if o.Resume != "" {
+		identifier, err := common.ParseIdentifier(o.Resume)
+		if err != nil {
+			return err
+		}
+		if !common.NewProgress(identifier).Exists() {
+			return fmt.Errorf("no saved progress for task %s", identifier.Long())
+		}
+		id = identifier
+	}
+
+	if err := task.ValidateMachine(*cloud, cfg.Size.Machine); err != nil {
+		return err
+	}
+
+	if estimate, err := task.EstimateCost(*cloud, cfg); err != nil {
+		logrus.Warnf("Failed to estimate cost: %v", err)
+	} else {
+		logrus.Infof("Estimated cost: %s over the %s timeout", estimate, cfg.Environment.Timeout)
+		if cfg.MaxCost > 0 && estimate.Maximum > cfg.MaxCost {
+			logrus.Warnf("The task will be stopped if its spend exceeds the maximum cost of $%.2f", cfg.MaxCost)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Create)
 	defer cancel()
 
@@ -121,17 +192,55 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 		return err
 	}
 
+	if o.DryRun {
+		return o.plan(ctx, tsk)
+	}
+
 	logrus.Infof("Using identifier %s", id.Long())
 	defer fmt.Println(id.Long())
 
 	if err := tsk.Create(ctx); err != nil {
 		logrus.Errorf("Failed to create a new task: %v", err)
-		logrus.Warn("Attempting to delete residual resources...")
-		if err := tsk.Delete(ctx); err != nil {
-			logrus.Errorf("Failed to delete residual resources")
-			return err
+		// Resources created before the failure are rolled back by Create,
+		// except for the resumable ones and the ones that couldn't be rolled
+		// back, which are recorded as progress.
+		var rollbackErr *common.RollbackError
+		var progressErr *common.ProgressError
+		if errors.As(err, &rollbackErr) || errors.As(err, &progressErr) {
+			logrus.Warnf("Resume with `leo create --resume %s` or clean up with `leo delete %s`", id.Long(), id.Long())
 		}
 		return err
 	}
 	return nil
 }
+
+// plan prints the resources that the task would create.
+func (o *Options) plan(ctx context.Context, tsk task.Task) error {
+	plan, err := tsk.Plan(ctx)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "TYPE\tNAME\tATTRIBUTE\tVALUE")
+
+	for _, resource := range plan {
+		names := []string{}
+		for name := range resource.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		resourceType, resourceName := resource.Type, resource.Name
+		if len(names) == 0 {
+			fmt.Fprintf(writer, "%s\t%s\t-\t-\n", resourceType, resourceName)
+		}
+		for _, name := range names {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", resourceType, resourceName, name, resource.Attributes[name])
+			// Only the first row of each resource shows its type and name.
+			resourceType, resourceName = "", ""
+		}
+	}
+
+	return writer.Flush()
+}
@@ -13,6 +13,7 @@ type Options struct {
 	Workdir     string
 	Output      string
 	ExcludeList []string
+	Merge       string
 }
 
 func New(cloud *common.Cloud) *cobra.Command {
@@ -28,8 +29,9 @@ func New(cloud *common.Cloud) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&o.Output, "output", "", "output directory, relative to workdir")
-	cmd.Flags().StringVar(&o.Workdir, "workdir", ".", "working directory")
+	cmd.Flags().StringVar(&o.Output, "output", "", "output directory, relative to workdir; defaults to the one used at creation")
+	cmd.Flags().StringVar(&o.Workdir, "workdir", ".", "working directory; defaults to the one used at creation")
+	cmd.Flags().StringVar(&o.Merge, "merge", "", "how to combine per-machine outputs: newest or strict; defaults to the one used at creation")
 
 	return cmd
 }
@@ -37,11 +39,15 @@ func New(cloud *common.Cloud) *cobra.Command {
 func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
 	cfg := common.Task{
 		Environment: common.Environment{
-			Directory:    o.Workdir,
 			DirectoryOut: o.Output,
 			ExcludeList:  o.ExcludeList,
+			OutputMerge:  common.MergePolicy(o.Merge),
 		},
 	}
+	// Unspecified directories are read from the task manifest.
+	if cmd.Flags().Changed("workdir") || cmd.Flags().Changed("output") {
+		cfg.Environment.Directory = o.Workdir
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Delete)
 	defer cancel()
@@ -0,0 +1,66 @@
+package describe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type Options struct {
+}
+
+func New(cloud *common.Cloud) *cobra.Command {
+	o := Options{}
+
+	cmd := &cobra.Command{
+		Use:   "describe <name>",
+		Short: "Print the manifest recorded when a task was created",
+		Long:  ``,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args, cloud)
+		},
+	}
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Read)
+	defer cancel()
+
+	id, err := common.ParseIdentifier(args[0])
+	if err != nil {
+		return err
+	}
+
+	tsk, err := task.New(ctx, *cloud, id, common.Task{})
+	if err != nil {
+		return err
+	}
+
+	if err := tsk.Read(ctx); err != nil {
+		return err
+	}
+
+	manifest, err := tsk.Manifest(ctx)
+	if errors.Is(err, common.NotFoundError) {
+		return fmt.Errorf("task %s doesn't have a manifest; it was created by an older version", id.Long())
+	} else if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(output))
+	return nil
+}
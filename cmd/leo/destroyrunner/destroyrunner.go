@@ -1,17 +1,9 @@
 package destroyrunner
 
 import (
-	"fmt"
-
-	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
-	"github.com/mitchellh/go-testing-interface"
 	"github.com/spf13/cobra"
 
-	"terraform-provider-iterative/iterative/aws"
-	"terraform-provider-iterative/iterative/azure"
-	"terraform-provider-iterative/iterative/gcp"
-	"terraform-provider-iterative/iterative/kubernetes"
-
+	"terraform-provider-iterative/task"
 	"terraform-provider-iterative/task/common"
 )
 
@@ -36,21 +28,5 @@ func New(cloud *common.Cloud) *cobra.Command {
 }
 
 func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
-	r := map[string]interface{}{"region": string(cloud.Region)}
-	s := map[string]*schema.Schema{"region": {Type: schema.TypeString}}
-	d := schema.TestResourceDataRaw(&testing.RuntimeT{}, s, r)
-	d.SetId(args[0])
-
-	switch cloud.Provider {
-	case common.ProviderAWS:
-		return aws.ResourceMachineDelete(cmd.Context(), d, nil)
-	case common.ProviderGCP:
-		return gcp.ResourceMachineDelete(cmd.Context(), d, nil)
-	case common.ProviderAZ, "azure":
-		return azure.ResourceMachineDelete(cmd.Context(), d, nil)
-	case common.ProviderK8S, "kubernetes":
-		return kubernetes.ResourceMachineDelete(cmd.Context(), d, nil)
-	}
-
-	return fmt.Errorf("unknown provider: %#v", cloud.Provider)
+	return task.DestroyRunner(cmd.Context(), *cloud, args[0])
 }
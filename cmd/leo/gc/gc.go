@@ -0,0 +1,112 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type Options struct {
+	OlderThan time.Duration
+	Tags      map[string]string
+	Yes       bool
+}
+
+func New(cloud *common.Cloud) *cobra.Command {
+	o := Options{}
+
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Find and delete the resources of incomplete tasks",
+		Long: `Find every resource named after a task identifier and report the tasks that
+lack any of the resources the provider creates for every task, like those left
+behind by a failed deletion. Pass --yes to delete them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args, cloud)
+		},
+	}
+
+	cmd.Flags().DurationVar(&o.OlderThan, "older-than", time.Hour, "only consider tasks whose newest resource is older than this; tasks being created are incomplete too")
+	cmd.Flags().StringToStringVar(&o.Tags, "tags", map[string]string{}, "only consider tasks with these resource tags")
+	cmd.Flags().BoolVar(&o.Yes, "yes", false, "delete the resources instead of just reporting them")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Read)
+	defer cancel()
+
+	orphans, err := task.FindOrphans(ctx, *cloud)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var selected []task.Orphan
+	for _, orphan := range orphans {
+		// Resources that don't report their creation time can't be filtered by age.
+		if created := orphan.Created(); !created.IsZero() && now.Sub(created) < o.OlderThan {
+			continue
+		}
+		if !orphan.HasTags(o.Tags) {
+			continue
+		}
+		selected = append(selected, orphan)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "IDENTIFIER\tAGE\tRESOURCES\tMISSING")
+	for _, orphan := range selected {
+		age := "unknown"
+		if created := orphan.Created(); !created.IsZero() {
+			age = now.Sub(created).Round(time.Minute).String()
+		}
+
+		var resources []string
+		for _, resource := range orphan.Resources {
+			resources = append(resources, resource.Type+"/"+resource.Name)
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", orphan.Identifier.Long(), age, strings.Join(resources, ","), strings.Join(orphan.Missing, ","))
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	if !o.Yes {
+		if len(selected) > 0 {
+			logrus.Infof("Found %d incomplete tasks; run again with --yes to delete them", len(selected))
+		}
+		return nil
+	}
+
+	failed := 0
+	for _, orphan := range selected {
+		logrus.Infof("Deleting %s...", orphan.Identifier.Long())
+		if err := deleteOrphan(orphan, cloud.Timeouts.Delete); err != nil {
+			logrus.Errorf("Failed to delete %s: %v", orphan.Identifier.Long(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d of %d incomplete tasks", failed, len(selected))
+	}
+	return nil
+}
+
+func deleteOrphan(orphan task.Orphan, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return orphan.Delete(ctx)
+}
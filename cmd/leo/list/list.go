@@ -2,8 +2,15 @@ package list
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"terraform-provider-iterative/task"
@@ -11,6 +18,11 @@ import (
 )
 
 type Options struct {
+	Output  string
+	Status  []string
+	Tags    map[string]string
+	Sort    string
+	Workers int
 }
 
 func New(cloud *common.Cloud) *cobra.Command {
@@ -25,10 +37,24 @@ func New(cloud *common.Cloud) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&o.Output, "output", "ids", "output format: ids, table or json")
+	cmd.Flags().StringSliceVar(&o.Status, "status", nil, "only list tasks with these statuses, e.g. running")
+	cmd.Flags().StringToStringVar(&o.Tags, "tag", map[string]string{}, "only list tasks with these tags")
+	cmd.Flags().StringVar(&o.Sort, "sort", "created", "sort by identifier, created or status")
+	cmd.Flags().IntVar(&o.Workers, "workers", 8, "number of tasks to read at the same time")
+
 	return cmd
 }
 
 func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	less, ok := orders[o.Sort]
+	if !ok {
+		return fmt.Errorf("invalid sort key %#v", o.Sort)
+	}
+	if o.Output != "ids" && o.Output != "table" && o.Output != "json" {
+		return fmt.Errorf("invalid output format %#v", o.Output)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Read)
 	defer cancel()
 
@@ -37,9 +63,150 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 		return err
 	}
 
-	for _, id := range lst {
-		fmt.Println(id.Long())
+	// Identifiers alone don't need reading every task.
+	if o.Output == "ids" && len(o.Status) == 0 && len(o.Tags) == 0 && !cmd.Flags().Changed("sort") {
+		for _, id := range lst {
+			fmt.Println(id.Long())
+		}
+		return nil
 	}
 
+	// Reading every task logs a lot of progress messages.
+	level := logrus.GetLevel()
+	if level < logrus.DebugLevel {
+		logrus.SetLevel(logrus.WarnLevel)
+	}
+	read := task.Summarize(ctx, *cloud, lst, o.Workers)
+	logrus.SetLevel(level)
+
+	var summaries []task.Summary
+	for _, summary := range read {
+		if o.matches(summary) {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	sort.SliceStable(summaries, func(a, b int) bool {
+		return less(summaries[a], summaries[b])
+	})
+
+	if o.Output == "json" {
+		if summaries == nil {
+			summaries = []task.Summary{}
+		}
+		output, err := json.MarshalIndent(summaries, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+	}
+
+	for _, summary := range summaries {
+		if summary.Error != "" {
+			logrus.Warnf("Failed to read task %s: %s", summary.Identifier, summary.Error)
+		}
+	}
+
+	if o.Output == "ids" {
+		for _, summary := range summaries {
+			fmt.Println(summary.Identifier)
+		}
+		return nil
+	}
+
+	printSummaries(summaries)
 	return nil
 }
+
+// matches reports whether the task passes the status and tag filters.
+func (o *Options) matches(summary task.Summary) bool {
+	if len(o.Status) > 0 {
+		found := false
+		for _, status := range o.Status {
+			if common.Phase(status) == summary.Status {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range o.Tags {
+		if summary.Tags[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// orders maps sort keys to comparison functions; sorting by creation time
+// lists the newest tasks first, and tasks without a manifest last.
+var orders = map[string]func(a, b task.Summary) bool{
+	"identifier": func(a, b task.Summary) bool {
+		return a.Identifier < b.Identifier
+	},
+	"created": func(a, b task.Summary) bool {
+		if a.Created == nil || b.Created == nil {
+			return a.Created != nil
+		}
+		return a.Created.After(*b.Created)
+	},
+	"status": func(a, b task.Summary) bool {
+		return a.Status < b.Status
+	},
+}
+
+// printSummaries writes a table with the summary of every task to stdout.
+func printSummaries(summaries []task.Summary) {
+	now := time.Now()
+
+	orUnknown := func(value string) string {
+		if value == "" {
+			return "-"
+		}
+		return value
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "IDENTIFIER\tSTATUS\tMACHINES\tCREATED\tAGE\tMACHINE TYPE\tPARALLELISM\tREGION\tTAGS")
+	for _, summary := range summaries {
+		var machines []string
+		for phase, count := range summary.Machines {
+			machines = append(machines, fmt.Sprintf("%d %s", count, phase))
+		}
+		sort.Strings(machines)
+
+		created, age := "-", "-"
+		if summary.Created != nil {
+			created = summary.Created.UTC().Format("2006-01-02T15:04:05Z")
+			age = now.Sub(*summary.Created).Round(time.Minute).String()
+		}
+
+		parallelism := "-"
+		if summary.Parallelism > 0 {
+			parallelism = fmt.Sprint(summary.Parallelism)
+		}
+
+		var tags []string
+		for key, value := range summary.Tags {
+			tags = append(tags, key+"="+value)
+		}
+		sort.Strings(tags)
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			summary.Identifier,
+			summary.Status,
+			orUnknown(strings.Join(machines, ",")),
+			created,
+			age,
+			orUnknown(summary.MachineType),
+			parallelism,
+			orUnknown(string(summary.Region)),
+			orUnknown(strings.Join(tags, ",")),
+		)
+	}
+	writer.Flush()
+}
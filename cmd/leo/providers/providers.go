@@ -0,0 +1,73 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type Options struct {
+}
+
+func New(cloud *common.Cloud) *cobra.Command {
+	o := Options{}
+
+	cmd := &cobra.Command{
+		Use:   "providers",
+		Short: "List the available cloud providers and their capabilities",
+		Long:  ``,
+		Args:  cobra.NoArgs,
+		Annotations: map[string]string{
+			"cloud": "optional",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args, cloud)
+		},
+	}
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tALIASES\tSTOP\tSSH\tEXCLUDES\tSPOT\tMACHINE POOLS\tPIPELINES\tQUEUES\tMACHINE OUTPUTS\tBUNDLES")
+
+	for _, provider := range task.Providers() {
+		aliases := []string{}
+		for _, alias := range provider.Aliases {
+			aliases = append(aliases, string(alias))
+		}
+		if len(aliases) == 0 {
+			aliases = append(aliases, "-")
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			provider.Name,
+			strings.Join(aliases, ","),
+			yesNo(provider.Capabilities.Stop),
+			yesNo(provider.Capabilities.SSH),
+			yesNo(provider.Capabilities.Excludes),
+			yesNo(provider.Capabilities.Spot),
+			yesNo(provider.Capabilities.MachineTypes),
+			yesNo(provider.Capabilities.Pipelines),
+			yesNo(provider.Capabilities.Queues),
+			yesNo(provider.Capabilities.MachineOutputs),
+			yesNo(provider.Capabilities.Bundles),
+		)
+	}
+
+	return writer.Flush()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -42,7 +45,7 @@ func New(cloud *common.Cloud) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 1, "parallelism")
+	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 1, "parallelism; defaults to the one used at creation")
 	cmd.Flags().BoolVar(&o.Timestamps, "timestamps", false, "display timestamps")
 	cmd.Flags().BoolVar(&o.Follow, "follow", false, "follow logs")
 
@@ -68,7 +71,8 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 		return err
 	}
 
-	var last int
+	var cursor common.LogCursor
+	phases := map[string]common.Phase{}
 	firstRun := true
 	waiting := false
 	for {
@@ -76,7 +80,14 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 			return err
 		}
 
-		logs, err := o.getLogs(ctx, tsk)
+		if firstRun && !cmd.Flags().Changed("parallelism") {
+			if manifest, err := tsk.Manifest(ctx); err == nil && manifest.Task.Parallelism > 0 {
+				o.Parallelism = int(manifest.Task.Parallelism)
+			}
+		}
+
+		var logs []string
+		logs, cursor, err = o.getLogs(ctx, tsk, cursor)
 		if err != nil {
 			return err
 		}
@@ -90,18 +101,33 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 			fmt.Fprint(os.Stderr, ".")
 		}
 
-		status, err := o.getStatus(ctx, tsk)
+		status, machines, err := o.getStatus(ctx, tsk)
 		if err != nil {
 			return err
 		}
 
-		if delta := strings.Join(logs[last:], "\n"); delta != "" {
+		if delta := strings.Join(logs, "\n"); delta != "" {
 			if waiting {
 				fmt.Fprint(os.Stderr, "\n")
 				waiting = false
 			}
 			fmt.Println(delta)
-			last = len(logs)
+		}
+
+		if !o.Follow {
+			o.printMachines(machines)
+			o.printQueue(ctx, tsk)
+		} else {
+			for _, machine := range machines {
+				if phases[machine.Machine] != machine.Phase {
+					if waiting {
+						fmt.Fprint(os.Stderr, "\n")
+						waiting = false
+					}
+					fmt.Fprintf(os.Stderr, "Machine %s: %s\n", machine.Machine, machine.Phase)
+					phases[machine.Machine] = machine.Phase
+				}
+			}
 		}
 
 		switch o.Follow {
@@ -116,37 +142,39 @@ func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) er
 		}
 
 		switch status {
-		case statusSucceeded:
-			os.Exit(0)
-		case statusFailed:
-			os.Exit(1)
+		case statusSucceeded, statusFailed:
+			// Exit with the same code as the task script.
+			os.Exit(machines.ExitCode())
 		default:
 			time.Sleep(3 * time.Second)
 		}
 	}
 }
 
-func (o *Options) getLogs(ctx context.Context, tsk task.Task) ([]string, error) {
-	logs, err := tsk.Logs(ctx)
+// getLogs returns the log lines written after the given cursor, sorted by time.
+func (o *Options) getLogs(ctx context.Context, tsk task.Task, cursor common.LogCursor) ([]string, common.LogCursor, error) {
+	lines, cursor, err := tsk.StreamLogs(ctx, cursor)
 	if err != nil {
-		return nil, err
+		return nil, cursor, err
 	}
 
-	var result []string
+	sort.SliceStable(lines, func(a, b int) bool {
+		return lines[a].Time.Before(lines[b].Time)
+	})
 
-	for _, log := range logs {
-		for _, line := range strings.Split(strings.Trim(log, "\n"), "\n") {
-			if !o.Timestamps {
-				_, line, _ = strings.Cut(line, " ")
-			}
-			result = append(result, line)
+	var result []string
+	for _, line := range lines {
+		text := line.Text
+		if o.Timestamps && !line.Time.IsZero() {
+			text = line.Time.UTC().Format(time.RFC3339) + " " + text
 		}
+		result = append(result, text)
 	}
 
-	return result, nil
+	return result, cursor, nil
 }
 
-func (o *Options) getStatus(ctx context.Context, tsk task.Task) (status, error) {
+func (o *Options) getStatus(ctx context.Context, tsk task.Task) (status, common.Status, error) {
 	for _, event := range tsk.Events(ctx) {
 		line := fmt.Sprintf("%s: %s", event.Code, strings.Join(event.Description, " "))
 		if o.Timestamps {
@@ -156,23 +184,58 @@ func (o *Options) getStatus(ctx context.Context, tsk task.Task) (status, error)
 		logrus.Debug(line)
 	}
 
-	status, err := tsk.Status(ctx)
+	machines, err := tsk.Status(ctx)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
-	result := statusQueued
+	result := status(machines.Summary(o.Parallelism))
 
-	if status[common.StatusCodeSucceeded] >= o.Parallelism {
-		result = statusSucceeded
+	logrus.Debug(result)
+	return result, machines, nil
+}
+
+// printMachines writes a table with the state of every task machine to stderr.
+func (o *Options) printMachines(machines common.Status) {
+	if len(machines) == 0 {
+		return
 	}
-	if status[common.StatusCodeFailed] > 0 {
-		result = statusFailed
+
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.UTC().Format("2006-01-02T15:04:05Z")
 	}
-	if status[common.StatusCodeActive] >= o.Parallelism {
-		result = statusRunning
+
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MACHINE\tPHASE\tSTARTED\tFINISHED\tEXIT CODE\tPREEMPTIONS\tADDRESS")
+	for _, machine := range machines {
+		code, address := "-", "-"
+		if machine.ExitCode != nil {
+			code = strconv.Itoa(*machine.ExitCode)
+		}
+		if machine.Address != nil {
+			address = machine.Address.String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			machine.Machine,
+			machine.Phase,
+			formatTime(machine.Started),
+			formatTime(machine.Finished),
+			code,
+			machine.Preemptions,
+			address,
+		)
 	}
+	writer.Flush()
+}
 
-	logrus.Debug(result)
-	return result, nil
+// printQueue writes the work item counts of tasks with a queue to stderr.
+func (o *Options) printQueue(ctx context.Context, tsk task.Task) {
+	queue, err := tsk.Queue(ctx)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Work items: %d done, %d failed, %d pending\n", queue.Done, queue.Failed, queue.Pending)
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -13,10 +14,15 @@ import (
 
 	"terraform-provider-iterative/cmd/leo/create"
 	"terraform-provider-iterative/cmd/leo/delete"
+	"terraform-provider-iterative/cmd/leo/describe"
 	"terraform-provider-iterative/cmd/leo/destroyrunner"
+	"terraform-provider-iterative/cmd/leo/gc"
 	"terraform-provider-iterative/cmd/leo/list"
+	"terraform-provider-iterative/cmd/leo/providers"
 	"terraform-provider-iterative/cmd/leo/read"
+	"terraform-provider-iterative/cmd/leo/runpipeline"
 	"terraform-provider-iterative/cmd/leo/stop"
+	"terraform-provider-iterative/cmd/leo/wait"
 	"terraform-provider-iterative/task/common"
 )
 
@@ -44,19 +50,30 @@ func NewCmd() *cobra.Command {
 		Use:   "leo",
 		Short: "Run code in the cloud",
 		Long:  `leo is a command-line tool that allows data scientists to run code in the cloud.`,
+		// Commands annotated with cloud=optional don't operate on a specific provider.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if cmd.Annotations["cloud"] != "optional" && o.Provider == "" {
+				return errors.New(`required flag(s) "cloud" not set`)
+			}
+			return nil
+		},
 	}
 
 	cmd.AddCommand(create.New(&o.Cloud))
 	cmd.AddCommand(delete.New(&o.Cloud))
+	cmd.AddCommand(describe.New(&o.Cloud))
+	cmd.AddCommand(gc.New(&o.Cloud))
 	cmd.AddCommand(list.New(&o.Cloud))
+	cmd.AddCommand(providers.New(&o.Cloud))
 	cmd.AddCommand(read.New(&o.Cloud))
+	cmd.AddCommand(runpipeline.New(&o.Cloud))
 	cmd.AddCommand(stop.New(&o.Cloud))
+	cmd.AddCommand(wait.New(&o.Cloud))
 	cmd.AddCommand(destroyrunner.New(&o.Cloud))
 
 	cmd.PersistentFlags().StringVar(&o.Provider, "cloud", "", "cloud provider")
 	cmd.PersistentFlags().BoolVar(&o.Verbose, "verbose", false, "verbose output")
-	cmd.PersistentFlags().StringVar(&o.Region, "region", "us-east", "cloud region")
-	cobra.CheckErr(cmd.MarkPersistentFlagRequired("cloud"))
+	cmd.PersistentFlags().StringVar(&o.Region, "region", "us-east", "cloud region; a comma-separated list adds fallback regions for when it lacks capacity")
 
 	cobra.OnInitialize(func() {
 		logrus.SetLevel(logrus.InfoLevel)
@@ -70,7 +87,7 @@ func NewCmd() *cobra.Command {
 		})
 
 		o.Cloud.Provider = common.Provider(o.Provider)
-		o.Cloud.Region = common.Region(o.Region)
+		o.Cloud.Region, o.Cloud.FallbackRegions = common.ParseRegions(o.Cloud.Provider, o.Region)
 	})
 
 	cwd, err := os.Getwd()
@@ -0,0 +1,279 @@
+package runpipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type Options struct {
+	Name     string
+	Interval time.Duration
+	Keep     bool
+}
+
+// Spec is the format of pipeline files.
+type Spec struct {
+	// Name makes the stage identifiers deterministic, so running the same
+	// pipeline again resumes it.
+	Name string `json:"name"`
+	// Cloud and Region are the defaults for every stage.
+	Cloud  string      `json:"cloud"`
+	Region string      `json:"region"`
+	Stages []StageSpec `json:"stages"`
+}
+
+// StageSpec describes a pipeline stage, with the same settings as leo create.
+type StageSpec struct {
+	Name        string            `json:"name"`
+	Needs       []string          `json:"needs"`
+	Cloud       string            `json:"cloud"`
+	Region      string            `json:"region"`
+	Machine     string            `json:"machine"`
+	Image       string            `json:"image"`
+	Script      string            `json:"script"`
+	Spot        bool              `json:"spot"`
+	DiskSize    *int              `json:"disk_size"`
+	Parallelism *int              `json:"parallelism"`
+	Timeout     *int              `json:"timeout"`
+	MaxCost     float64           `json:"max_cost"`
+	Environment map[string]string `json:"environment"`
+	// Workdir is relative to the directory of the pipeline file.
+	Workdir string   `json:"workdir"`
+	Output  string   `json:"output"`
+	Exclude []string `json:"exclude"`
+}
+
+func New(cloud *common.Cloud) *cobra.Command {
+	o := Options{}
+
+	cmd := &cobra.Command{
+		Use:   "run-pipeline <pipeline.yaml>",
+		Short: "Run a pipeline of tasks",
+		Long: `Run a pipeline of tasks and wait for it to finish.
+
+Every stage is a task that starts once the stages listed in its needs have
+succeeded; their output directories are copied from the task storage into a
+directory named after each of them in the working directory of the stage.
+When the pipeline finishes, the stage tasks are deleted and the outputs of the
+final stages are downloaded to their working directories.
+
+Stages and pipelines use the cloud and region flags unless they specify
+their own. Running a pipeline with a name again resumes it.`,
+		Args: cobra.ExactArgs(1),
+		Annotations: map[string]string{
+			"cloud": "optional",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args, cloud)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Name, "name", "", "deterministic name; overrides the one in the pipeline file")
+	cmd.Flags().DurationVar(&o.Interval, "interval", 10*time.Second, "polling interval")
+	cmd.Flags().BoolVar(&o.Keep, "keep", false, "keep the stage tasks after the pipeline finishes")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	contents, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	var spec Spec
+	if err := yaml.UnmarshalStrict(contents, &spec); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", args[0], err)
+	}
+	if o.Name != "" {
+		spec.Name = o.Name
+	}
+
+	stages, err := o.stages(spec, filepath.Dir(args[0]), *cloud)
+	if err != nil {
+		return err
+	}
+
+	id := common.NewRandomIdentifier(spec.Name)
+	if spec.Name != "" {
+		id = common.NewDeterministicIdentifier(spec.Name)
+		if identifier, err := common.ParseIdentifier(spec.Name); err == nil {
+			id = identifier
+		}
+	}
+
+	pipeline, err := task.NewPipeline(id, stages)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("Using identifier %s", id.Long())
+	status, err := o.wait(cloud, pipeline)
+	if err != nil {
+		return err
+	}
+	printStages(status)
+
+	if o.Keep {
+		logrus.Infof("Run the pipeline again with --name %s to delete its tasks", id.Long())
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Delete)
+		defer cancel()
+		if err := pipeline.Delete(ctx); err != nil {
+			return err
+		}
+	}
+
+	if phase := status.Summary(); phase != common.PhaseSucceeded {
+		return fmt.Errorf("pipeline %s", phase)
+	}
+	return nil
+}
+
+// wait advances the pipeline until every stage has finished or been skipped.
+func (o *Options) wait(cloud *common.Cloud, pipeline *task.Pipeline) (task.PipelineStatus, error) {
+	phases := map[string]common.Phase{}
+	for {
+		// Create a new context to reset the timeout on every iteration.
+		ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Create)
+		status, err := pipeline.Advance(ctx)
+		cancel()
+		if err != nil {
+			return status, err
+		}
+
+		for _, stage := range status {
+			if phases[stage.Name] != stage.Phase {
+				phases[stage.Name] = stage.Phase
+				logrus.Infof("Stage %s is %s", stage.Name, stage.Phase)
+			}
+			if stage.Error != "" {
+				logrus.Warnf("Failed to read stage %s: %s", stage.Name, stage.Error)
+			}
+		}
+
+		if status.Finished() {
+			return status, nil
+		}
+		time.Sleep(o.Interval)
+	}
+}
+
+// stages translates the pipeline file into stages, resolving the defaults
+// and the working directories.
+func (o *Options) stages(spec Spec, directory string, cloud common.Cloud) ([]task.Stage, error) {
+	var stages []task.Stage
+	for _, stage := range spec.Stages {
+		stageCloud := cloud
+		if provider := firstNonEmpty(stage.Cloud, spec.Cloud); provider != "" {
+			stageCloud.Provider = common.Provider(provider)
+		}
+		if stageCloud.Provider == "" {
+			return nil, fmt.Errorf("stage %s doesn't have a cloud", stage.Name)
+		}
+		if region := firstNonEmpty(stage.Region, spec.Region); region != "" {
+			stageCloud.Region, stageCloud.FallbackRegions = common.ParseRegions(stageCloud.Provider, region)
+		}
+
+		if stage.Script == "" {
+			return nil, fmt.Errorf("stage %s doesn't have a script", stage.Name)
+		}
+		script := stage.Script
+		if !strings.HasPrefix(script, "#!") {
+			script = "#!/bin/sh\n" + script
+		}
+
+		variables := make(map[string]*string)
+		for name, value := range stage.Environment {
+			variables[name] = nil
+			if copy := value; value != "" {
+				variables[name] = &copy
+			}
+		}
+
+		workdir := stage.Workdir
+		if workdir != "" && !filepath.IsAbs(workdir) {
+			workdir = filepath.Join(directory, workdir)
+		}
+		if filepath.IsAbs(stage.Output) || strings.HasPrefix(stage.Output, "../") {
+			return nil, fmt.Errorf("stage %s: output must be inside workdir", stage.Name)
+		}
+
+		cfg := common.Task{
+			Size: common.Size{
+				Machine: firstNonEmpty(stage.Machine, "m"),
+				Storage: valueOr(stage.DiskSize, -1),
+			},
+			Environment: common.Environment{
+				Image:        firstNonEmpty(stage.Image, "ubuntu"),
+				Script:       script,
+				Variables:    variables,
+				Directory:    workdir,
+				DirectoryOut: stage.Output,
+				ExcludeList:  stage.Exclude,
+				Timeout:      time.Duration(valueOr(stage.Timeout, 24*60*60)) * time.Second,
+			},
+			Firewall: common.Firewall{
+				Ingress: common.FirewallRule{
+					Ports: &[]uint16{22},
+				},
+			},
+			Parallelism: uint16(valueOr(stage.Parallelism, 1)),
+			MaxCost:     stage.MaxCost,
+		}
+		cfg.Spot = common.Spot(common.SpotDisabled)
+		if stage.Spot {
+			cfg.Spot = common.Spot(common.SpotEnabled)
+		}
+
+		if err := task.ValidateMachine(stageCloud, cfg.Size.Machine); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+
+		stages = append(stages, task.Stage{
+			Name:  stage.Name,
+			Cloud: stageCloud,
+			Task:  cfg,
+			Needs: stage.Needs,
+		})
+	}
+	return stages, nil
+}
+
+// printStages writes a table with the state of every stage to stderr.
+func printStages(status task.PipelineStatus) {
+	writer := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "STAGE\tPHASE\tMACHINES\tIDENTIFIER")
+	for _, stage := range status {
+		fmt.Fprintf(writer, "%s\t%s\t%d\t%s\n", stage.Name, stage.Phase, len(stage.Machines), stage.Identifier)
+	}
+	writer.Flush()
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func valueOr(value *int, fallback int) int {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,100 @@
+package wait
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type Options struct {
+	Parallelism int
+	Interval    time.Duration
+}
+
+func New(cloud *common.Cloud) *cobra.Command {
+	o := Options{}
+
+	cmd := &cobra.Command{
+		Use:   "wait <name>",
+		Short: "Wait for a task to finish and exit with the same code as its script",
+		Long: `Wait for a task to finish and exit with the same code as its script.
+
+The exit code is the first non-zero exit code reported by the task machines;
+scripts killed by a signal exit with 128+signal (e.g. 137 for SIGKILL) and
+timed out tasks exit with 124.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.Run(cmd, args, cloud)
+		},
+	}
+
+	cmd.Flags().IntVar(&o.Parallelism, "parallelism", 1, "parallelism; defaults to the one used at creation")
+	cmd.Flags().DurationVar(&o.Interval, "interval", 10*time.Second, "polling interval")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, args []string, cloud *common.Cloud) error {
+	id, err := common.ParseIdentifier(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Without --parallelism, wait for as many machines as the task was created with.
+	readManifest := !cmd.Flags().Changed("parallelism")
+	for {
+		code, done, err := o.poll(*cloud, id, readManifest)
+		if err != nil {
+			return err
+		}
+		if done {
+			os.Exit(code)
+		}
+		readManifest = false
+		time.Sleep(o.Interval)
+	}
+}
+
+// poll reads the task status and reports whether it has finished and with which
+// exit code; with readManifest, it takes the parallelism from the task manifest.
+func (o *Options) poll(cloud common.Cloud, id common.Identifier, readManifest bool) (int, bool, error) {
+	// Create a new context to reset the timeout on every iteration.
+	ctx, cancel := context.WithTimeout(context.Background(), cloud.Timeouts.Read)
+	defer cancel()
+
+	tsk, err := task.New(ctx, cloud, id, common.Task{})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err := tsk.Read(ctx); err != nil {
+		return 0, false, err
+	}
+
+	if readManifest {
+		if manifest, err := tsk.Manifest(ctx); err == nil && manifest.Task.Parallelism > 0 {
+			o.Parallelism = int(manifest.Task.Parallelism)
+		}
+	}
+
+	status, err := tsk.Status(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	failed := status.Count(common.PhaseFailed, common.PhaseTimedOut)
+	succeeded := status.Count(common.PhaseSucceeded)
+	logrus.Debug(fmt.Sprintf("%d succeeded, %d failed", succeeded, failed))
+	if failed == 0 && succeeded < o.Parallelism {
+		return 0, false, nil
+	}
+
+	return status.ExitCode(), true, nil
+}
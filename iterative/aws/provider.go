@@ -17,6 +17,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/sizes"
 )
 
 var (
@@ -489,22 +492,9 @@ func GetAvailabilityZone(region string) string {
 }
 
 func getInstanceType(instanceType string, instanceGPU string) string {
-	instanceTypes := map[string]string{
-		"s":       "t2.micro",
-		"m":       "m5.2xlarge",
-		"l":       "m5.8xlarge",
-		"xl":      "m5.16xlarge",
-		"m+t4":    "g4dn.xlarge",
-		"m+k80":   "p2.xlarge",
-		"l+k80":   "p2.8xlarge",
-		"xl+k80":  "p2.16xlarge",
-		"m+v100":  "p3.xlarge",
-		"l+v100":  "p3.8xlarge",
-		"xl+v100": "p3.16xlarge",
-	}
-	if val, ok := instanceTypes[instanceType+"+"+instanceGPU]; ok {
+	if val, ok := sizes.Lookup(common.ProviderAWS, instanceType+"+"+instanceGPU); ok {
 		return val
-	} else if val, ok := instanceTypes[instanceType]; ok && instanceGPU == "" {
+	} else if val, ok := sizes.Lookup(common.ProviderAWS, instanceType); ok && instanceGPU == "" {
 		return val
 	}
 
@@ -18,6 +18,8 @@ import (
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 
 	azresources "terraform-provider-iterative/task/az/resources"
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/sizes"
 )
 
 // ResourceMachineCreate creates AWS instance
@@ -414,23 +416,9 @@ func GetRegion(region string) string {
 }
 
 func getInstanceType(instanceType string, instanceGPU string) string {
-	instanceTypes := map[string]string{
-		"s":       "Standard_B1s",
-		"m":       "Standard_F8s_v2",
-		"l":       "Standard_F32s_v2",
-		"xl":      "Standard_F64s_v2",
-		"m+t4":    "Standard_NC4as_T4_v3",
-		"m+k80":   "Standard_NC6",
-		"l+k80":   "Standard_NC12",
-		"xl+k80":  "Standard_NC24",
-		"m+v100":  "Standard_NC6s_v3",
-		"l+v100":  "Standard_NC12s_v3",
-		"xl+v100": "Standard_NC24s_v3",
-	}
-
-	if val, ok := instanceTypes[instanceType+"+"+instanceGPU]; ok {
+	if val, ok := sizes.Lookup(common.ProviderAZ, instanceType+"+"+instanceGPU); ok {
 		return val
-	} else if val, ok := instanceTypes[instanceType]; ok && instanceGPU == "" {
+	} else if val, ok := sizes.Lookup(common.ProviderAZ, instanceType); ok && instanceGPU == "" {
 		return val
 	}
 
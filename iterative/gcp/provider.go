@@ -14,6 +14,8 @@ import (
 	"time"
 
 	"terraform-provider-iterative/iterative/utils"
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/sizes"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
@@ -438,107 +440,6 @@ func getRegion(region string) string {
 }
 
 func getInstanceType(instanceType string, instanceGPU string) (map[string]map[string]string, error) {
-	instanceTypes := make(map[string]map[string]map[string]string)
-	instanceTypes["s"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-		},
-		"machine": {
-			"type": "g1-small",
-		},
-	}
-	instanceTypes["m"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-		},
-		"machine": {
-			"type": "e2-custom-8-32768",
-		},
-	}
-	instanceTypes["l"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-		},
-		"machine": {
-			"type": "e2-custom-32-131072",
-		},
-	}
-	instanceTypes["xl"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-		},
-		"machine": {
-			"type": "n2-custom-64-262144",
-		},
-	}
-	instanceTypes["m+t4"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "1",
-			"type":  "nvidia-tesla-t4",
-		},
-		"machine": {
-			"type": "n1-standard-4",
-		},
-	}
-	instanceTypes["m+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "1",
-			"type":  "nvidia-tesla-k80",
-		},
-		"machine": {
-			"type": "custom-8-53248",
-		},
-	}
-	instanceTypes["l+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "4",
-			"type":  "nvidia-tesla-k80",
-		},
-		"machine": {
-			"type": "custom-32-131072",
-		},
-	}
-	instanceTypes["xl+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "8",
-			"type":  "nvidia-tesla-k80",
-		},
-		"machine": {
-			"type": "custom-64-212992-ext",
-		},
-	}
-	instanceTypes["m+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "1",
-			"type":  "nvidia-tesla-v100",
-		},
-		"machine": {
-			"type": "custom-8-65536-ext",
-		},
-	}
-	instanceTypes["l+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "4",
-			"type":  "nvidia-tesla-v100",
-		},
-		"machine": {
-			"type": "custom-32-262144-ext",
-		},
-	}
-	instanceTypes["xl+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "8",
-			"type":  "nvidia-tesla-v100",
-		},
-		"machine": {
-			"type": "custom-64-524288-ext",
-		},
-	}
-
 	match := regexp.MustCompile(`^([^+]+)\+([^*]+)\*([1-9]\d*)?$`).FindStringSubmatch(instanceType)
 	if match != nil {
 		return map[string]map[string]string{
@@ -550,11 +451,12 @@ func getInstanceType(instanceType string, instanceGPU string) (map[string]map[st
 				"type": match[1],
 			},
 		}, nil
-	} else if val, ok := instanceTypes[instanceType+"+"+instanceGPU]; ok {
-		return val, nil
-	} else if val, ok := instanceTypes[instanceType]; ok && instanceGPU == "" {
-		return val, nil
-	} else if val, ok := instanceTypes[instanceType]; ok {
+	} else if val, ok := sizes.Lookup(common.ProviderGCP, instanceType+"+"+instanceGPU); ok {
+		return splitInstanceType(val), nil
+	} else if val, ok := sizes.Lookup(common.ProviderGCP, instanceType); ok && instanceGPU == "" {
+		return splitInstanceType(val), nil
+	} else if val, ok := sizes.Lookup(common.ProviderGCP, instanceType); ok {
+		val := splitInstanceType(val)
 		return map[string]map[string]string{
 			"accelerator": {
 				"count": val["accelerator"]["count"],
@@ -596,6 +498,28 @@ func getInstanceType(instanceType string, instanceGPU string) (map[string]map[st
 	}, nil
 }
 
+// splitInstanceType splits a machine+accelerator*count machine type from the
+// generic size catalog into the format returned by getInstanceType.
+func splitInstanceType(machineType string) map[string]map[string]string {
+	instanceType := map[string]map[string]string{
+		"accelerator": {
+			"count": "0",
+			"type":  "",
+		},
+		"machine": {
+			"type": machineType,
+		},
+	}
+
+	if match := regexp.MustCompile(`^([^+]+)\+([^*]+)\*([1-9]\d*)$`).FindStringSubmatch(machineType); match != nil {
+		instanceType["accelerator"]["count"] = match[3]
+		instanceType["accelerator"]["type"] = match[2]
+		instanceType["machine"]["type"] = match[1]
+	}
+
+	return instanceType
+}
+
 // https://github.com/hashicorp/terraform-provider-google/blob/8a362008bd4d36b6a882eb53455f87305e6dff52/google/service_scope.go#L5-L48
 func shorthandServiceScopeLookup(scope string) string {
 	// This is a convenience map of short names used by the gcloud tool
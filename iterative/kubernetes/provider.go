@@ -25,6 +25,9 @@ import (
 	kubernetes "k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	kubernetes_clientcmd "k8s.io/client-go/tools/clientcmd"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/sizes"
 )
 
 // Create a "machine" (actually a Kubernetes job) on the cluster.
@@ -319,122 +322,25 @@ func waitForPods(client kubernetes.Interface, interval time.Duration, timeout ti
 
 // Get the actual instance characteristics from its vendor-agnostic reference.
 func getInstanceType(instanceType string, instanceGPU string) (map[string]map[string]string, error) {
-	// TODO: consider the use of an enumeration instead of a nested string map.
-	instanceTypes := make(map[string]map[string]map[string]string)
-	// Resource amounts mirror their AWS counterparts.
-	instanceTypes["s"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-			"model": "",
-		},
-		"cores":  {"count": "1"},
-		"memory": {"amount": "1Gi"},
-	}
-	instanceTypes["m"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-			"model": "",
-		},
-		"cores":  {"count": "8"},
-		"memory": {"amount": "32Gi"},
-	}
-	instanceTypes["l"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-			"model": "",
-		},
-		"cores":  {"count": "32"},
-		"memory": {"amount": "128Gi"},
-	}
-	instanceTypes["xl"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "0",
-			"type":  "",
-			"model": "",
-		},
-		"cores":  {"count": "64"},
-		"memory": {"amount": "256Gi"},
-	}
-	instanceTypes["m+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "1",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-k80",
-		},
-		"cores":  {"count": "4"},
-		"memory": {"amount": "64Gi"},
-	}
-	instanceTypes["l+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "8",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-k80",
-		},
-		"cores":  {"count": "32"},
-		"memory": {"amount": "512Gi"},
-	}
-	instanceTypes["xl+k80"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "16",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-k80",
-		},
-		"cores":  {"count": "64"},
-		"memory": {"amount": "768Gi"},
-	}
-	instanceTypes["m+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "1",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-v100",
-		},
-		"cores":  {"count": "8"},
-		"memory": {"amount": "64Gi"},
-	}
-	instanceTypes["l+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "4",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-v100",
-		},
-		"cores":  {"count": "32"},
-		"memory": {"amount": "256Gi"},
-	}
-	instanceTypes["xl+v100"] = map[string]map[string]string{
-		"accelerator": {
-			"count": "8",
-			"type":  "nvidia.com/gpu",
-			"model": "nvidia-tesla-v100",
-		},
-		"cores":  {"count": "64"},
-		"memory": {"amount": "512Gi"},
-	}
-
 	size := instanceType
 
 	if instanceGPU != "" {
 		size += "+" + instanceGPU
 	}
 
-	if val, ok := instanceTypes[size]; ok {
-		return val, nil
-	} else if val, ok := instanceTypes[instanceType]; ok {
+	pattern := regexp.MustCompile(`^(\d+)-(\d+)(?:\+([^*]+)\*([1-9]\d*))?$`)
+
+	if val, ok := sizes.Lookup(common.ProviderK8S, size); ok {
+		size = val
+	} else if val, ok := sizes.Lookup(common.ProviderK8S, instanceType); ok {
+		size = val
 		// Allow users to specify custom accelerator selectors.
-		return map[string]map[string]string{
-			"accelerator": {
-				"count": val["accelerator"]["count"],
-				"type":  val["accelerator"]["type"],
-				"model": instanceGPU,
-			},
-			"cores":  val["cores"],
-			"memory": val["memory"],
-		}, nil
+		if match := pattern.FindStringSubmatch(val); match != nil && match[4] != "" {
+			size = fmt.Sprintf("%s-%s+%s*%s", match[1], match[2], instanceGPU, match[4])
+		}
 	}
 
-	if match := regexp.MustCompile(`^(\d+)-(\d+)(?:\+([^*]+)\*([1-9]\d*))?$`).FindStringSubmatch(size); match != nil {
+	if match := pattern.FindStringSubmatch(size); match != nil {
 		return map[string]map[string]string{
 			"accelerator": {
 				"count": match[4],
@@ -10,6 +10,7 @@ func Provider() *schema.Provider {
 			"iterative_machine":    resourceMachine(),
 			"iterative_cml_runner": resourceRunner(),
 			"iterative_task":       resourceTask(),
+			"iterative_pipeline":   resourcePipeline(),
 		},
 		DataSourcesMap: map[string]*schema.Resource{},
 	}
@@ -0,0 +1,360 @@
+package iterative
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/sirupsen/logrus"
+
+	"terraform-provider-iterative/iterative/utils"
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+func resourcePipeline() *schema.Resource {
+	logrus.SetLevel(logrus.DebugLevel)
+	logrus.SetFormatter(&utils.TpiFormatter{})
+
+	return &schema.Resource{
+		CreateContext: resourcePipelineCreate,
+		DeleteContext: resourcePipelineDelete,
+		ReadContext:   resourcePipelineRead,
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+			},
+			"cloud": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+			"region": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Optional: true,
+				Default:  "us-west",
+			},
+			"tags": {
+				Type:     schema.TypeMap,
+				ForceNew: true,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"stage": {
+				Type:     schema.TypeList,
+				ForceNew: true,
+				Required: true,
+				MinItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Required: true,
+						},
+						"needs": {
+							Type:     schema.TypeList,
+							ForceNew: true,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"cloud": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"region": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"machine": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "m",
+						},
+						"disk_size": {
+							Type:     schema.TypeInt,
+							ForceNew: true,
+							Optional: true,
+							Default:  -1,
+						},
+						"spot": {
+							Type:     schema.TypeFloat,
+							ForceNew: true,
+							Optional: true,
+							Default:  -1,
+						},
+						"image": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "ubuntu",
+						},
+						"script": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Required: true,
+						},
+						"workdir": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"output": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"exclude": {
+							Type:     schema.TypeList,
+							ForceNew: true,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"parallelism": {
+							Type:     schema.TypeInt,
+							ForceNew: true,
+							Optional: true,
+							Default:  1,
+						},
+						"max_cost": {
+							Type:     schema.TypeFloat,
+							ForceNew: true,
+							Optional: true,
+							Default:  0,
+						},
+						"environment": {
+							Type:     schema.TypeMap,
+							ForceNew: true,
+							Optional: true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+						"timeout": {
+							Type:     schema.TypeInt,
+							ForceNew: true,
+							Optional: true,
+							Default:  24 * time.Hour / time.Second,
+						},
+					},
+				},
+			},
+			"status": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"stages": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"identifier": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"phase": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(15 * time.Minute),
+			Read:   schema.DefaultTimeout(15 * time.Minute),
+			Delete: schema.DefaultTimeout(15 * time.Minute),
+		},
+	}
+}
+
+func resourcePipelineCreate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	logrus.Info(fmt.Sprintf(logTpl, "Creation"))
+
+	pipeline, err := resourcePipelineBuild(d)
+	if err != nil {
+		return diagnostic(diags, err, diag.Error)
+	}
+
+	id, _ := resourceTaskIdentifier(d)
+	d.SetId(id.Long())
+
+	// Only the stages without needs are created now; the rest are created by
+	// later refreshes, once the stages they need have succeeded.
+	status, err := pipeline.Advance(ctx)
+	if err != nil {
+		diags = diagnostic(diags, err, diag.Error)
+		if err := pipeline.Delete(ctx); err != nil {
+			return diagnostic(diags, err, diag.Error)
+		}
+		d.SetId("")
+		return diags
+	}
+
+	resourcePipelineSetStatus(d, status)
+	return diags
+}
+
+func resourcePipelineRead(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	pipeline, err := resourcePipelineBuild(d)
+	if err != nil {
+		return diagnostic(diags, err, diag.Warning)
+	}
+
+	status, err := pipeline.Advance(ctx)
+	if err != nil {
+		diags = diagnostic(diags, err, diag.Warning)
+	}
+	for _, stage := range status {
+		if stage.Error != "" {
+			diags = diagnostic(diags, fmt.Errorf("failed to read stage %s: %s", stage.Name, stage.Error), diag.Warning)
+		}
+	}
+
+	resourcePipelineSetStatus(d, status)
+	return diags
+}
+
+func resourcePipelineDelete(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	logrus.Info(fmt.Sprintf(logTpl, "Destruction"))
+
+	pipeline, err := resourcePipelineBuild(d)
+	if err != nil {
+		return diagnostic(diags, err, diag.Error)
+	}
+
+	if err := pipeline.Delete(ctx); err != nil {
+		return diagnostic(diags, err, diag.Error)
+	}
+	return diags
+}
+
+func resourcePipelineSetStatus(d *schema.ResourceData, status task.PipelineStatus) {
+	var stages []map[string]interface{}
+	for _, stage := range status {
+		stages = append(stages, map[string]interface{}{
+			"name":       stage.Name,
+			"identifier": stage.Identifier,
+			"phase":      string(stage.Phase),
+		})
+	}
+	d.Set("stages", stages)
+	d.Set("status", string(status.Summary()))
+}
+
+func resourcePipelineBuild(d *schema.ResourceData) (*task.Pipeline, error) {
+	tags := make(map[string]string)
+	for name, value := range d.Get("tags").(map[string]interface{}) {
+		tags[name] = value.(string)
+	}
+
+	timeouts := common.Timeouts{
+		Create: d.Timeout(schema.TimeoutCreate),
+		Read:   d.Timeout(schema.TimeoutRead),
+		Update: d.Timeout(schema.TimeoutRead),
+		Delete: d.Timeout(schema.TimeoutDelete),
+	}
+
+	var stages []task.Stage
+	for _, raw := range d.Get("stage").([]interface{}) {
+		stage := raw.(map[string]interface{})
+		name := stage["name"].(string)
+
+		provider := common.Provider(d.Get("cloud").(string))
+		if cloud := stage["cloud"].(string); cloud != "" {
+			provider = common.Provider(cloud)
+		}
+		regionName := d.Get("region").(string)
+		if stageRegion := stage["region"].(string); stageRegion != "" {
+			regionName = stageRegion
+		}
+		region, fallbackRegions := common.ParseRegions(provider, regionName)
+
+		machine := stage["machine"].(string)
+		if err := task.ValidateMachine(common.Cloud{Provider: provider}, machine); err != nil {
+			return nil, fmt.Errorf("stage %s: %w", name, err)
+		}
+
+		v := resourceTaskVariables(stage["environment"].(map[string]interface{}))
+		resolvedRegion := string(region)
+		v["TPI_REGION"] = &resolvedRegion
+		v["TPI_MACHINE"] = &machine
+
+		output := stage["output"].(string)
+		if filepath.IsAbs(output) || strings.HasPrefix(output, "../") {
+			return nil, fmt.Errorf("stage %s: output must be inside workdir", name)
+		}
+
+		var excludeList []string
+		for _, exclude := range stage["exclude"].([]interface{}) {
+			excludeList = append(excludeList, exclude.(string))
+		}
+
+		var needs []string
+		for _, need := range stage["needs"].([]interface{}) {
+			needs = append(needs, need.(string))
+		}
+
+		stages = append(stages, task.Stage{
+			Name: name,
+			Cloud: common.Cloud{
+				Provider:        provider,
+				Region:          region,
+				FallbackRegions: fallbackRegions,
+				Timeouts:        timeouts,
+				Tags:            tags,
+			},
+			Task: common.Task{
+				Size: common.Size{
+					Machine: machine,
+					Storage: stage["disk_size"].(int),
+				},
+				Environment: common.Environment{
+					Image:        stage["image"].(string),
+					Script:       stage["script"].(string),
+					Variables:    v,
+					Directory:    stage["workdir"].(string),
+					DirectoryOut: output,
+					ExcludeList:  excludeList,
+					Timeout:      time.Duration(stage["timeout"].(int)) * time.Second,
+				},
+				Firewall: common.Firewall{
+					Ingress: common.FirewallRule{
+						Ports: &[]uint16{22},
+					},
+				},
+				Spot:        common.Spot(stage["spot"].(float64)),
+				Parallelism: uint16(stage["parallelism"].(int)),
+				MaxCost:     stage["max_cost"].(float64),
+			},
+			Needs: needs,
+		})
+	}
+
+	id, _ := resourceTaskIdentifier(d)
+	return task.NewPipeline(id, stages)
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/rclone/rclone/lib/bucket"
@@ -31,7 +32,8 @@ func resourceTask() *schema.Resource {
 		CreateContext: resourceTaskCreate,
 		DeleteContext: resourceTaskDelete,
 		ReadContext:   resourceTaskRead,
-		UpdateContext: resourceTaskRead,
+		UpdateContext: resourceTaskUpdate,
+		CustomizeDiff: resourceTaskCustomizeDiff,
 		Schema: map[string]*schema.Schema{
 			"name": {
 				Type:     schema.TypeString,
@@ -97,6 +99,46 @@ func resourceTask() *schema.Resource {
 				},
 			},
 			"status": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"machine": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"phase": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"started": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"finished": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"exit_code": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"result": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"preemptions": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"address": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"exit_codes": {
 				Type:     schema.TypeMap,
 				Computed: true,
 				Elem: &schema.Schema{
@@ -110,6 +152,13 @@ func resourceTask() *schema.Resource {
 					Type: schema.TypeString,
 				},
 			},
+			"estimated_cost": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeFloat,
+				},
+			},
 			"logs": {
 				Type:     schema.TypeList,
 				Computed: true,
@@ -162,18 +211,92 @@ func resourceTask() *schema.Resource {
 								Type: schema.TypeString,
 							},
 						},
+						"per_machine_output": {
+							Type:     schema.TypeBool,
+							ForceNew: true,
+							Optional: true,
+							Default:  false,
+						},
+						"merge": {
+							Type:     schema.TypeString,
+							ForceNew: false,
+							Optional: true,
+							Default:  "",
+						},
+						"bundle": {
+							Type:     schema.TypeBool,
+							ForceNew: true,
+							Optional: true,
+							Default:  false,
+						},
+						"transfers": {
+							Type:     schema.TypeInt,
+							ForceNew: false,
+							Optional: true,
+							Default:  0,
+						},
+						"checkers": {
+							Type:     schema.TypeInt,
+							ForceNew: false,
+							Optional: true,
+							Default:  0,
+						},
+						"bandwidth_limit": {
+							Type:     schema.TypeString,
+							ForceNew: false,
+							Optional: true,
+							Default:  "",
+						},
 					},
 				},
 			},
+			"queue": {
+				Optional: true,
+				ForceNew: true,
+				Type:     schema.TypeSet,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"file": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"prefix": {
+							Type:     schema.TypeString,
+							ForceNew: true,
+							Optional: true,
+							Default:  "",
+						},
+						"retries": {
+							Type:     schema.TypeInt,
+							ForceNew: true,
+							Optional: true,
+							Default:  0,
+						},
+					},
+				},
+			},
+			"queue_status": {
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
 			"parallelism": {
 				Type:     schema.TypeInt,
-				ForceNew: true,
 				Optional: true,
 				Default:  1,
 			},
+			"max_cost": {
+				Type:     schema.TypeFloat,
+				Optional: true,
+				Default:  0,
+			},
 			"environment": {
 				Type:     schema.TypeMap,
-				ForceNew: true,
 				Optional: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
@@ -181,7 +304,6 @@ func resourceTask() *schema.Resource {
 			},
 			"tags": {
 				Type:     schema.TypeMap,
-				ForceNew: true,
 				Optional: true,
 				Elem: &schema.Schema{
 					Type: schema.TypeString,
@@ -189,7 +311,6 @@ func resourceTask() *schema.Resource {
 			},
 			"timeout": {
 				Type:     schema.TypeInt,
-				ForceNew: true,
 				Optional: true,
 				Default:  24 * time.Hour / time.Second,
 			},
@@ -200,7 +321,69 @@ func resourceTask() *schema.Resource {
 			Update: schema.DefaultTimeout(3 * time.Minute),
 			Delete: schema.DefaultTimeout(15 * time.Minute),
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{{
+			// Version 0 stored status as a map of counters.
+			Version: 0,
+			Type: cty.Object(map[string]cty.Type{
+				"status": cty.Map(cty.Number),
+			}),
+			Upgrade: func(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+				delete(rawState, "status")
+				return rawState, nil
+			},
+		}},
+	}
+}
+
+// resourceTaskCustomizeDiff validates the machine type and estimates the cost
+// of the task during the plan, so it can be reviewed before applying.
+func resourceTaskCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	keys := []string{"cloud", "machine", "spot", "parallelism", "timeout"}
+	if d.Id() != "" {
+		changed := false
+		for _, key := range keys {
+			changed = changed || d.HasChange(key)
+		}
+		if !changed {
+			return nil
+		}
+	}
+	if d.NewValueKnown("cloud") && d.NewValueKnown("machine") {
+		cloud := common.Cloud{Provider: common.Provider(d.Get("cloud").(string))}
+		if err := task.ValidateMachine(cloud, d.Get("machine").(string)); err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		if !d.NewValueKnown(key) {
+			return d.SetNewComputed("estimated_cost")
+		}
+	}
+
+	cloud := common.Cloud{Provider: common.Provider(d.Get("cloud").(string))}
+	t := common.Task{
+		Size: common.Size{
+			Machine: d.Get("machine").(string),
+		},
+		Environment: common.Environment{
+			Timeout: time.Duration(d.Get("timeout").(int)) * time.Second,
+		},
+		Spot:        common.Spot(d.Get("spot").(float64)),
+		Parallelism: uint16(d.Get("parallelism").(int)),
 	}
+
+	estimate, err := task.EstimateCost(cloud, t)
+	if err != nil {
+		logrus.Warnf("Failed to estimate cost: %v", err)
+		return d.SetNew("estimated_cost", map[string]interface{}{})
+	}
+
+	logrus.Infof("Estimated cost: %s over the %s timeout", estimate, t.Environment.Timeout)
+	return d.SetNew("estimated_cost", map[string]interface{}{
+		"hourly":  estimate.Hourly,
+		"maximum": estimate.Maximum,
+	})
 }
 
 func resourceTaskCreate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
@@ -217,10 +400,29 @@ func resourceTaskCreate(ctx context.Context, d *schema.ResourceData, m interface
 		return diagnostic(diags, err, diag.Error)
 	}
 
+	// Check before setting the identifier, which would make it look deterministic.
+	_, deterministic := resourceTaskIdentifier(d)
+
 	d.SetId(task.GetIdentifier(ctx).Long())
 	if err := task.Create(ctx); err != nil {
 		diags = diagnostic(diags, err, diag.Error)
-		if err := task.Delete(ctx); err != nil {
+		// Resources created before the failure are rolled back by Create,
+		// except for the resumable ones, which are recorded as progress, and
+		// the ones that couldn't be rolled back. Tasks with a deterministic
+		// identifier get the same one on the next apply, so they're removed
+		// from the state and Create resumes from the progress; if there is
+		// none, they keep it, so Terraform deletes the remaining resources
+		// before creating the task again. Otherwise, attempt a full deletion.
+		var rollbackErr *common.RollbackError
+		var progressErr *common.ProgressError
+		if !errors.As(err, &rollbackErr) && !errors.As(err, &progressErr) {
+			d.SetId("")
+		} else if deterministic && progressErr != nil {
+			diags = diagnostic(diags, errors.New("failed to create; apply again to resume from the last completed step"), diag.Error)
+			d.SetId("")
+		} else if deterministic {
+			diags = diagnostic(diags, errors.New("failed to create; apply again to delete the remaining resources and retry"), diag.Error)
+		} else if err := task.Delete(ctx); err != nil {
 			diags = diagnostic(diags, err, diag.Error)
 		} else {
 			diags = diagnostic(diags, errors.New("failed to create"), diag.Error)
@@ -287,7 +489,28 @@ func resourceTaskRead(ctx context.Context, d *schema.ResourceData, m interface{}
 		utils.SendJitsuEvent("task/read", err, utils.ResourceData(d))
 		return diagnostic(diags, err, diag.Warning)
 	}
-	d.Set("status", status)
+	var machines []map[string]interface{}
+	for _, machine := range status {
+		machines = append(machines, flattenMachineStatus(machine))
+	}
+	d.Set("status", machines)
+
+	exitCodes := map[string]interface{}{}
+	for _, status := range status.ExitStatuses() {
+		exitCodes[status.Machine] = status.Code
+	}
+	d.Set("exit_codes", exitCodes)
+
+	if queue, err := task.Queue(ctx); err == nil {
+		d.Set("queue_status", map[string]interface{}{
+			"done":    queue.Done,
+			"failed":  queue.Failed,
+			"pending": queue.Pending,
+		})
+	} else if err != common.NotFoundError && err != common.NotImplementedError {
+		utils.SendJitsuEvent("task/read", err, utils.ResourceData(d))
+		return diagnostic(diags, err, diag.Warning)
+	}
 
 	logs, err := task.Logs(ctx)
 	if err != nil {
@@ -307,6 +530,28 @@ func resourceTaskRead(ctx context.Context, d *schema.ResourceData, m interface{}
 	return diags
 }
 
+func resourceTaskUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	logrus.Info(fmt.Sprintf(logTpl, "Update"))
+
+	task, err := resourceTaskBuild(ctx, d, m)
+	if err != nil {
+		utils.SendJitsuEvent("task/update", err, utils.ResourceData(d))
+		return diagnostic(diags, err, diag.Error)
+	}
+
+	// Machines take the transfer settings of the storage block from the
+	// environment variables of their template, so changes refresh it too.
+	if d.HasChanges("parallelism", "environment", "tags", "timeout", "max_cost", "storage") {
+		if err := task.Update(ctx); err != nil {
+			utils.SendJitsuEvent("task/update", err, utils.ResourceData(d))
+			return diagnostic(diags, err, diag.Error)
+		}
+	}
+
+	utils.SendJitsuEvent("task/update", err, utils.ResourceData(d))
+	return resourceTaskRead(ctx, d, m)
+}
+
 func resourceTaskDelete(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
 	logrus.Info(fmt.Sprintf(logTpl, "Destruction"))
 
@@ -331,31 +576,18 @@ func resourceTaskBuild(ctx context.Context, d *schema.ResourceData, m interface{
 		tags[name] = value.(string)
 	}
 
-	v := make(map[string]*string)
-	for name, value := range d.Get("environment").(map[string]interface{}) {
-		v[name] = nil
-		if contents := value.(string); contents != "" {
-			v[name] = &contents
-		}
-	}
-
-	val := "true"
-	v["TPI_TASK"] = &val
-	v["CI"] = nil
-	v["CI_*"] = nil
-	v["GITHUB_*"] = nil
-	v["BITBUCKET_*"] = nil
-	v["CML_*"] = nil
-	v["REPO_TOKEN"] = nil
+	v := resourceTaskVariables(d.Get("environment").(map[string]interface{}))
 
-	region := d.Get("region").(string)
+	region, fallbackRegions := common.ParseRegions(common.Provider(d.Get("cloud").(string)), d.Get("region").(string))
+	regionName := string(region)
 	machine := d.Get("machine").(string)
-	v["TPI_REGION"] = &region
+	v["TPI_REGION"] = &regionName
 	v["TPI_MACHINE"] = &machine
 
 	c := common.Cloud{
-		Provider: common.Provider(d.Get("cloud").(string)),
-		Region:   common.Region(d.Get("region").(string)),
+		Provider:        common.Provider(d.Get("cloud").(string)),
+		Region:          region,
+		FallbackRegions: fallbackRegions,
 		Timeouts: common.Timeouts{
 			Create: d.Timeout(schema.TimeoutCreate),
 			Read:   d.Timeout(schema.TimeoutRead),
@@ -368,6 +600,9 @@ func resourceTaskBuild(ctx context.Context, d *schema.ResourceData, m interface{
 	var directory string
 	var directoryOut string
 	var excludeList []string
+	var perMachineOutput bool
+	var outputMerge common.MergePolicy
+	var transfer common.Transfer
 	var remoteStorage *common.RemoteStorage
 	if d.Get("storage").(*schema.Set).Len() > 0 {
 		storage := d.Get("storage").(*schema.Set).List()[0].(map[string]interface{})
@@ -380,6 +615,14 @@ func resourceTaskBuild(ctx context.Context, d *schema.ResourceData, m interface{
 		for _, exclude := range excludes {
 			excludeList = append(excludeList, exclude.(string))
 		}
+		perMachineOutput = storage["per_machine_output"].(bool)
+		outputMerge = common.MergePolicy(storage["merge"].(string))
+		transfer = common.Transfer{
+			Bundle:         storage["bundle"].(bool),
+			Transfers:      storage["transfers"].(int),
+			Checkers:       storage["checkers"].(int),
+			BandwidthLimit: storage["bandwidth_limit"].(string),
+		}
 
 		// Propagate configuration for pre-allocated storage container.
 		containerRaw := storage["container"].(string)
@@ -402,19 +645,31 @@ func resourceTaskBuild(ctx context.Context, d *schema.ResourceData, m interface{
 		}
 	}
 
+	var queue common.Queue
+	if d.Get("queue").(*schema.Set).Len() > 0 {
+		raw := d.Get("queue").(*schema.Set).List()[0].(map[string]interface{})
+		queue.File = raw["file"].(string)
+		queue.Prefix = raw["prefix"].(string)
+		queue.Retries = raw["retries"].(int)
+	}
+
 	t := common.Task{
 		Size: common.Size{
 			Machine: d.Get("machine").(string),
 			Storage: d.Get("disk_size").(int),
 		},
 		Environment: common.Environment{
-			Image:        d.Get("image").(string),
-			Script:       d.Get("script").(string),
-			Variables:    v,
-			Directory:    directory,
-			DirectoryOut: directoryOut,
-			ExcludeList:  excludeList,
-			Timeout:      time.Duration(d.Get("timeout").(int)) * time.Second,
+			Image:            d.Get("image").(string),
+			Script:           d.Get("script").(string),
+			Variables:        v,
+			Directory:        directory,
+			DirectoryOut:     directoryOut,
+			ExcludeList:      excludeList,
+			Timeout:          time.Duration(d.Get("timeout").(int)) * time.Second,
+			Queue:            queue,
+			PerMachineOutput: perMachineOutput,
+			OutputMerge:      outputMerge,
+			Transfer:         transfer,
 		},
 		Firewall: common.Firewall{
 			Ingress: common.FirewallRule{
@@ -426,28 +681,87 @@ func resourceTaskBuild(ctx context.Context, d *schema.ResourceData, m interface{
 		Spot:          common.Spot(d.Get("spot").(float64)),
 		Parallelism:   uint16(d.Get("parallelism").(int)),
 		PermissionSet: d.Get("permission_set").(string),
+		MaxCost:       d.Get("max_cost").(float64),
 	}
 
-	id, err := common.ParseIdentifier(d.Id())
-	if err != nil {
-		if name := d.Get("name").(string); name != "" {
-			if newId, err := common.ParseIdentifier(name); err == nil {
-				id = newId
-			} else {
-				id = common.NewDeterministicIdentifier(name)
-			}
-		} else if name := os.Getenv("GITHUB_RUN_ID"); name != "" {
-			id = common.NewDeterministicIdentifier(name)
-		} else if name := os.Getenv("CI_PIPELINE_ID"); name != "" {
-			id = common.NewDeterministicIdentifier(name)
-		} else if name := os.Getenv("BITBUCKET_STEP_TRIGGERER_UUID"); name != "" {
-			id = common.NewDeterministicIdentifier(name)
-		} else {
-			id = common.NewRandomIdentifier("")
+	id, _ := resourceTaskIdentifier(d)
+	return task.New(ctx, c, id, t)
+}
+
+// resourceTaskVariables returns the given environment variables along with
+// the ones every task inherits from the environment of the provider.
+func resourceTaskVariables(environment map[string]interface{}) map[string]*string {
+	v := make(map[string]*string)
+	for name, value := range environment {
+		v[name] = nil
+		if contents := value.(string); contents != "" {
+			v[name] = &contents
 		}
 	}
 
-	return task.New(ctx, c, id, t)
+	val := "true"
+	v["TPI_TASK"] = &val
+	v["CI"] = nil
+	v["CI_*"] = nil
+	v["GITHUB_*"] = nil
+	v["BITBUCKET_*"] = nil
+	v["CML_*"] = nil
+	v["REPO_TOKEN"] = nil
+
+	return v
+}
+
+// resourceTaskIdentifier returns the identifier of the task and whether it's
+// deterministic, i.e. whether a later apply would reuse it.
+func resourceTaskIdentifier(d *schema.ResourceData) (common.Identifier, bool) {
+	if id, err := common.ParseIdentifier(d.Id()); err == nil {
+		return id, true
+	}
+
+	if name := d.Get("name").(string); name != "" {
+		if id, err := common.ParseIdentifier(name); err == nil {
+			return id, true
+		}
+		return common.NewDeterministicIdentifier(name), true
+	} else if name := os.Getenv("GITHUB_RUN_ID"); name != "" {
+		return common.NewDeterministicIdentifier(name), true
+	} else if name := os.Getenv("CI_PIPELINE_ID"); name != "" {
+		return common.NewDeterministicIdentifier(name), true
+	} else if name := os.Getenv("BITBUCKET_STEP_TRIGGERER_UUID"); name != "" {
+		return common.NewDeterministicIdentifier(name), true
+	}
+
+	return common.NewRandomIdentifier(""), false
+}
+
+func flattenMachineStatus(machine common.MachineStatus) map[string]interface{} {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	exitCode := -1
+	if machine.ExitCode != nil {
+		exitCode = *machine.ExitCode
+	}
+
+	address := ""
+	if machine.Address != nil {
+		address = machine.Address.String()
+	}
+
+	return map[string]interface{}{
+		"machine":     machine.Machine,
+		"phase":       string(machine.Phase),
+		"started":     formatTime(machine.Started),
+		"finished":    formatTime(machine.Finished),
+		"exit_code":   exitCode,
+		"result":      machine.Result,
+		"preemptions": machine.Preemptions,
+		"address":     address,
+	}
 }
 
 func diagnostic(diags diag.Diagnostics, err error, severity diag.Severity) diag.Diagnostics {
@@ -1,23 +1,30 @@
 package resources
 
 import (
+	"context"
+	"strings"
+
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"terraform-provider-iterative/task/aws/client"
+	"terraform-provider-iterative/task/common"
 )
 
 // makeTagSlice creates an `[]ec2/types.Tag` slice of structs from the given
-// `name` and `map[string]string` of tags, using the former to create or
-// overwrite the `Name` tag in the latter.
+// `name` and `map[string]string` of tags, using the former as the `Name` tag
+// instead of the one in the latter, which is left unmodified.
 // See also https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/Using_Tags.html
 func makeTagSlice(name string, tags map[string]string) []types.Tag {
-	if tags == nil {
-		tags = make(map[string]string)
-	}
-
-	tags["Name"] = name
-
-	var result []types.Tag
+	result := []types.Tag{{
+		Key:   aws.String("Name"),
+		Value: aws.String(name),
+	}}
 	for key, value := range tags {
+		if key == "Name" {
+			continue
+		}
 		result = append(result, types.Tag{
 			Key:   aws.String(key),
 			Value: aws.String(value),
@@ -26,3 +33,81 @@ func makeTagSlice(name string, tags map[string]string) []types.Tag {
 
 	return result
 }
+
+// tagMap converts a slice of EC2 tags into a map.
+func tagMap(tags []types.Tag) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range tags {
+		result[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return result
+}
+
+// updateTags replaces the tags of the given EC2 resources with the client tags,
+// removing any key that is no longer present.
+func updateTags(ctx context.Context, client *client.Client, name string, resources []string) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	tags := makeTagSlice(name, client.Tags)
+
+	desired := make(map[string]bool)
+	for _, tag := range tags {
+		desired[aws.ToString(tag.Key)] = true
+	}
+
+	describeInput := ec2.DescribeTagsInput{
+		Filters: []types.Filter{
+			{
+				Name:   aws.String("resource-id"),
+				Values: resources,
+			},
+		},
+	}
+
+	removed := make(map[string]bool)
+	for paginator := ec2.NewDescribeTagsPaginator(client.Services.EC2, &describeInput); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, tag := range page.Tags {
+			// Tags with the aws: prefix are reserved and can't be deleted.
+			if key := aws.ToString(tag.Key); !desired[key] && !strings.HasPrefix(key, "aws:") {
+				removed[key] = true
+			}
+		}
+	}
+
+	if len(removed) > 0 {
+		deleteInput := ec2.DeleteTagsInput{
+			Resources: resources,
+		}
+		for key := range removed {
+			deleteInput.Tags = append(deleteInput.Tags, types.Tag{Key: aws.String(key)})
+		}
+		if _, err := client.Services.EC2.DeleteTags(ctx, &deleteInput); err != nil {
+			return err
+		}
+	}
+
+	createInput := ec2.CreateTagsInput{
+		Resources: resources,
+		Tags:      tags,
+	}
+	_, err := client.Services.EC2.CreateTags(ctx, &createInput)
+	return err
+}
+
+// instancePhase maps EC2 instance states to machine phases; instances going
+// away without a status report are being replaced by the group, so they're
+// considered provisioning rather than failed.
+func instancePhase(state types.InstanceStateName) common.Phase {
+	switch state {
+	case types.InstanceStateNameRunning:
+		return common.PhaseRunning
+	default:
+		return common.PhaseProvisioning
+	}
+}
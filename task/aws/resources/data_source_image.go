@@ -14,17 +14,20 @@ import (
 	"terraform-provider-iterative/task/common"
 )
 
-func NewImage(client *client.Client, identifier string) *Image {
+func NewImage(client *client.Client, identifier string, architecture common.Architecture) *Image {
 	return &Image{
-		client:     client,
-		Identifier: identifier,
+		client:       client,
+		Identifier:   identifier,
+		Architecture: architecture,
 	}
 }
 
 type Image struct {
 	client     *client.Client
 	Identifier string
-	Attributes struct {
+	// Architecture selects the variant of the image aliases.
+	Architecture common.Architecture
+	Attributes   struct {
 		SSHUser string
 	}
 	Resource *types.Image
@@ -36,11 +39,21 @@ func (i *Image) Read(ctx context.Context) error {
 		i.Identifier = "ubuntu"
 	}
 	image := i.Identifier
-	images := map[string]string{
-		"ubuntu": "ubuntu@099720109477:x86_64:*ubuntu/images/hvm-ssd/ubuntu-focal-20.04*",
-		"nvidia": "ubuntu@898082745236:x86_64:Deep Learning AMI GPU CUDA 11.3.* (Ubuntu 20.04) *",
+	images := map[common.Architecture]map[string]string{
+		common.ArchitectureAMD64: {
+			"ubuntu": "ubuntu@099720109477:x86_64:*ubuntu/images/hvm-ssd/ubuntu-focal-20.04*",
+			"nvidia": "ubuntu@898082745236:x86_64:Deep Learning AMI GPU CUDA 11.3.* (Ubuntu 20.04) *",
+		},
+		common.ArchitectureARM64: {
+			"ubuntu": "ubuntu@099720109477:arm64:*ubuntu/images/hvm-ssd/ubuntu-focal-20.04*",
+			"nvidia": "ubuntu@898082745236:arm64:Deep Learning AMI Graviton GPU CUDA 11.4* (Ubuntu 20.04) *",
+		},
+	}
+	architecture := i.Architecture
+	if architecture == "" {
+		architecture = common.ArchitectureAMD64
 	}
-	if val, ok := images[image]; ok {
+	if val, ok := images[architecture][image]; ok {
 		image = val
 	}
 
@@ -51,7 +64,7 @@ func (i *Image) Read(ctx context.Context) error {
 
 	i.Attributes.SSHUser = match[1]
 	owner := match[2]
-	architecture := match[3]
+	imageArchitecture := match[3]
 	name := match[4]
 
 	filters := []types.Filter{
@@ -60,10 +73,10 @@ func (i *Image) Read(ctx context.Context) error {
 			Values: []string{name},
 		},
 	}
-	if architecture != "*" {
+	if imageArchitecture != "*" {
 		filters = append(filters, types.Filter{
 			Name:   aws.String("architecture"),
-			Values: []string{architecture},
+			Values: []string{imageArchitecture},
 		})
 	}
 	if owner != "*" {
@@ -8,17 +8,47 @@ import (
 	"strings"
 	"time"
 
+	"github.com/0x2b3bfa0/logrusctx"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/autoscaling"
 	"github.com/aws/aws-sdk-go-v2/service/autoscaling/types"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/smithy-go"
-	"github.com/0x2b3bfa0/logrusctx"
 
 	"terraform-provider-iterative/task/aws/client"
 	"terraform-provider-iterative/task/common"
 )
 
+// ListAutoScalingGroups returns the auto scaling groups named after a task identifier.
+func ListAutoScalingGroups(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+	for paginator := autoscaling.NewDescribeAutoScalingGroupsPaginator(client.Services.AutoScaling, &autoscaling.DescribeAutoScalingGroupsInput{}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range page.AutoScalingGroups {
+			if id, err := common.ParseIdentifier(aws.ToString(group.AutoScalingGroupName)); err == nil {
+				tags := make(map[string]string)
+				for _, tag := range group.Tags {
+					tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+				}
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "AutoScalingGroup",
+					Name:       aws.ToString(group.AutoScalingGroupName),
+					Created:    aws.ToTime(group.CreatedTime),
+					Tags:       tags,
+					Delete:     NewAutoScalingGroup(client, id, nil, nil, nil, common.SpotDisabled).Delete,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
 func NewAutoScalingGroup(client *client.Client, identifier common.Identifier, subnet *DefaultVPCSubnets, launchTemplate *LaunchTemplate, parallelism *uint16, spot common.Spot) *AutoScalingGroup {
 	a := &AutoScalingGroup{
 		client:     client,
@@ -64,6 +94,19 @@ func (a *AutoScalingGroup) Create(ctx context.Context) error {
 		subnets = append(subnets, aws.ToString(subnet.SubnetId))
 	}
 
+	// Pools of several instance types are filled from the spot pools with the
+	// most spare capacity, which are the least likely to be interrupted.
+	allocationStrategy := "lowest-price"
+	var overrides []types.LaunchTemplateOverrides
+	if instanceTypes := a.Dependencies.LaunchTemplate.InstanceTypes(); len(instanceTypes) > 1 {
+		allocationStrategy = "capacity-optimized"
+		for _, instanceType := range instanceTypes {
+			overrides = append(overrides, types.LaunchTemplateOverrides{
+				InstanceType: aws.String(instanceType),
+			})
+		}
+	}
+
 	input := autoscaling.CreateAutoScalingGroupInput{
 		AutoScalingGroupName: aws.String(a.Identifier),
 		DesiredCapacity:      aws.Int32(0),
@@ -73,7 +116,7 @@ func (a *AutoScalingGroup) Create(ctx context.Context) error {
 			InstancesDistribution: &types.InstancesDistribution{
 				OnDemandBaseCapacity:                aws.Int32(0),
 				OnDemandPercentageAboveBaseCapacity: aws.Int32(onDemandPercentage),
-				SpotAllocationStrategy:              aws.String("lowest-price"),
+				SpotAllocationStrategy:              aws.String(allocationStrategy),
 				SpotMaxPrice:                        aws.String(spotPrice),
 			},
 			LaunchTemplate: &types.LaunchTemplate{
@@ -81,6 +124,7 @@ func (a *AutoScalingGroup) Create(ctx context.Context) error {
 					LaunchTemplateName: aws.String(a.Dependencies.LaunchTemplate.Identifier),
 					Version:            aws.String("$Latest"),
 				},
+				Overrides: overrides,
 			},
 		},
 		VPCZoneIdentifier: aws.String(strings.Join(subnets, ",")),
@@ -105,6 +149,24 @@ func (a *AutoScalingGroup) Create(ctx context.Context) error {
 	return a.Read(ctx)
 }
 
+// Plan describes the auto scaling group that Create would make.
+func (a *AutoScalingGroup) Plan() common.PlannedResource {
+	var subnets []string
+	for _, subnet := range a.Dependencies.DefaultVPCSubnets.Resource {
+		subnets = append(subnets, aws.ToString(subnet.SubnetId))
+	}
+
+	return common.PlannedResource{
+		Type: "AutoScalingGroup",
+		Name: a.Identifier,
+		Attributes: map[string]string{
+			"subnets":     strings.Join(subnets, ","),
+			"parallelism": strconv.Itoa(int(*a.Attributes.Parallelism)),
+			"spot":        common.Spot(a.Attributes.Spot).String(),
+		},
+	}
+}
+
 func (a *AutoScalingGroup) Read(ctx context.Context) error {
 	groupsInput := autoscaling.DescribeAutoScalingGroupsInput{
 		AutoScalingGroupNames: []string{a.Identifier},
@@ -120,7 +182,7 @@ func (a *AutoScalingGroup) Read(ctx context.Context) error {
 	}
 
 	a.Attributes.Addresses = []net.IP{}
-	a.Attributes.Status = common.Status{common.StatusCodeActive: 0}
+	a.Attributes.Status = common.Status{}
 	if len(groups.AutoScalingGroups[0].Instances) > 0 {
 		var instancesInput ec2.DescribeInstancesInput
 		for _, instance := range groups.AutoScalingGroups[0].Instances {
@@ -140,12 +202,16 @@ func (a *AutoScalingGroup) Read(ctx context.Context) error {
 						status += " " + aws.ToString(instance.StateReason.Message)
 					}
 					logrusctx.Debug(ctx, "AutoScaling Group State:", status)
-					if status == "running" {
-						a.Attributes.Status[common.StatusCodeActive]++
+					machine := common.MachineStatus{
+						Machine: aws.ToString(instance.InstanceId),
+						Phase:   instancePhase(instance.State.Name),
+						Started: aws.ToTime(instance.LaunchTime),
 					}
 					if address := net.ParseIP(aws.ToString(instance.PublicIpAddress)); address != nil {
 						a.Attributes.Addresses = append(a.Attributes.Addresses, address)
+						machine.Address = address
 					}
+					a.Attributes.Status = append(a.Attributes.Status, machine)
 				}
 			}
 		}
@@ -185,17 +251,35 @@ func (a *AutoScalingGroup) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update sets the desired capacity of the group to Parallelism, raising its
+// maximum size when needed.
 func (a *AutoScalingGroup) Update(ctx context.Context) error {
 	input := autoscaling.UpdateAutoScalingGroupInput{
 		AutoScalingGroupName: aws.String(a.Identifier),
 		DesiredCapacity:      aws.Int32(int32(*a.Attributes.Parallelism)),
 	}
 
-	if _, err := a.client.Services.AutoScaling.UpdateAutoScalingGroup(ctx, &input); err != nil {
-		return err
+	if a.Resource != nil && aws.ToInt32(a.Resource.MaxSize) < int32(*a.Attributes.Parallelism) {
+		input.MaxSize = aws.Int32(int32(*a.Attributes.Parallelism))
 	}
 
-	return nil
+	_, err := a.client.Services.AutoScaling.UpdateAutoScalingGroup(ctx, &input)
+	return err
+}
+
+// UpdateTags replaces the tags of the existing instances of the group with the
+// client tags; new instances get them from the launch template.
+func (a *AutoScalingGroup) UpdateTags(ctx context.Context) error {
+	if a.Resource == nil {
+		return nil
+	}
+
+	var instances []string
+	for _, instance := range a.Resource.Instances {
+		instances = append(instances, aws.ToString(instance.InstanceId))
+	}
+
+	return updateTags(ctx, a.client, a.Identifier, instances)
 }
 
 func (a *AutoScalingGroup) Delete(ctx context.Context) error {
@@ -20,20 +20,26 @@ const (
 	errBucketAlreadyOwnedByYou = "BucketAlreadyOwnedByYou"
 )
 
-func ListBuckets(ctx context.Context, client *client.Client) ([]common.Identifier, error) {
+func ListBuckets(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
 	output, err := client.Services.S3.ListBuckets(ctx, &s3.ListBucketsInput{})
 	if err != nil {
 		return nil, err
 	}
 
-	ids := []common.Identifier{}
+	result := []common.TaskResource{}
 	for _, b := range output.Buckets {
 		if id, err := common.ParseIdentifier(*b.Name); err == nil {
-			ids = append(ids, id)
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "Bucket",
+				Name:       aws.ToString(b.Name),
+				Created:    aws.ToTime(b.CreationDate),
+				Delete:     NewBucket(client, id).Delete,
+			})
 		}
 	}
 
-	return ids, nil
+	return result, nil
 }
 
 func NewBucket(client *client.Client, identifier common.Identifier) *Bucket {
@@ -78,6 +84,17 @@ func (b *Bucket) Create(ctx context.Context) error {
 	return b.Read(ctx)
 }
 
+// Plan describes the bucket that Create would make.
+func (b *Bucket) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "Bucket",
+		Name: b.Identifier,
+		Attributes: map[string]string{
+			"region": b.client.Region,
+		},
+	}
+}
+
 func (b *Bucket) Read(ctx context.Context) error {
 	input := s3.HeadBucketInput{
 		Bucket: aws.String(b.Identifier),
@@ -16,6 +16,29 @@ import (
 	"terraform-provider-iterative/task/common/ssh"
 )
 
+// ListKeyPairs returns the key pairs named after a task identifier.
+func ListKeyPairs(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	output, err := client.Services.EC2.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []common.TaskResource{}
+	for _, keyPair := range output.KeyPairs {
+		if id, err := common.ParseIdentifier(aws.ToString(keyPair.KeyName)); err == nil {
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "KeyPair",
+				Name:       aws.ToString(keyPair.KeyName),
+				Tags:       tagMap(keyPair.Tags),
+				Delete:     NewKeyPair(client, id).Delete,
+			})
+		}
+	}
+
+	return result, nil
+}
+
 func NewKeyPair(client *client.Client, identifier common.Identifier) *KeyPair {
 	return &KeyPair{
 		client:     client,
@@ -73,6 +96,15 @@ func (k *KeyPair) Create(ctx context.Context) error {
 	return k.Read(ctx)
 }
 
+// Plan describes the key pair that Create would import.
+func (k *KeyPair) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type:       "KeyPair",
+		Name:       k.Identifier,
+		Attributes: map[string]string{},
+	}
+}
+
 func (k *KeyPair) Read(ctx context.Context) error {
 	pair, err := k.client.GetKeyPair(ctx)
 	if err != nil {
@@ -101,8 +133,13 @@ func (k *KeyPair) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update retags the key pair.
 func (k *KeyPair) Update(ctx context.Context) error {
-	return common.NotImplementedError
+	if err := k.Read(ctx); err != nil || k.Resource == nil {
+		return err
+	}
+
+	return updateTags(ctx, k.client, k.Identifier, []string{aws.ToString(k.Resource.KeyPairId)})
 }
 
 func (k *KeyPair) Delete(ctx context.Context) error {
@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,8 +17,35 @@ import (
 	"terraform-provider-iterative/task/aws/client"
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 )
 
+// ListLaunchTemplates returns the launch templates named after a task identifier.
+func ListLaunchTemplates(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+	for paginator := ec2.NewDescribeLaunchTemplatesPaginator(client.Services.EC2, &ec2.DescribeLaunchTemplatesInput{}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, template := range page.LaunchTemplates {
+			if id, err := common.ParseIdentifier(aws.ToString(template.LaunchTemplateName)); err == nil {
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "LaunchTemplate",
+					Name:       aws.ToString(template.LaunchTemplateName),
+					Created:    aws.ToTime(template.CreateTime),
+					Tags:       tagMap(template.Tags),
+					Delete:     NewLaunchTemplate(client, id, nil, nil, nil, nil, nil, common.Task{}).Delete,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
 func NewLaunchTemplate(client *client.Client, identifier common.Identifier, securityGroup *SecurityGroup, permissionSet *PermissionSet, image *Image, keyPair *KeyPair, credentials *Credentials, task common.Task) *LaunchTemplate {
 	l := &LaunchTemplate{
 		client:     client,
@@ -32,8 +61,11 @@ func NewLaunchTemplate(client *client.Client, identifier common.Identifier, secu
 }
 
 type LaunchTemplate struct {
-	client       *client.Client
-	Identifier   string
+	client     *client.Client
+	Identifier string
+	// Created is the creation time of the task, which the machine deadline
+	// counts from; it's zero for tasks being created.
+	Created      time.Time
 	Attributes   common.Task
 	Dependencies struct {
 		KeyPair       *KeyPair
@@ -46,66 +78,14 @@ type LaunchTemplate struct {
 }
 
 func (l *LaunchTemplate) Create(ctx context.Context) error {
-	if l.Attributes.Environment.Variables == nil {
-		l.Attributes.Environment.Variables = make(map[string]*string)
-	}
-
-	timeout := time.Now().Add(l.Attributes.Environment.Timeout)
-	script, err := machine.Script(l.Attributes.Environment.Script, l.Dependencies.Credentials.Resource, l.Attributes.Environment.Variables, &timeout)
+	data, err := l.data()
 	if err != nil {
-		return fmt.Errorf("failed to render machine script: %w", err)
-	}
-	userData := base64.StdEncoding.EncodeToString([]byte(script))
-
-	size := l.Attributes.Size.Machine
-	sizes := map[string]string{
-		"s":       "t2.micro",
-		"m":       "m5.2xlarge",
-		"l":       "m5.8xlarge",
-		"xl":      "m5.16xlarge",
-		"m+t4":    "g4dn.xlarge",
-		"m+k80":   "p2.xlarge",
-		"l+k80":   "p2.8xlarge",
-		"xl+k80":  "p2.16xlarge",
-		"m+v100":  "p3.xlarge",
-		"l+v100":  "p3.8xlarge",
-		"xl+v100": "p3.16xlarge",
-	}
-
-	if val, ok := sizes[size]; ok {
-		size = val
+		return err
 	}
 
 	input := ec2.CreateLaunchTemplateInput{
 		LaunchTemplateName: aws.String(l.Identifier),
-		LaunchTemplateData: &types.RequestLaunchTemplateData{
-			UserData:           aws.String(userData),
-			ImageId:            l.Dependencies.Image.Resource.ImageId,
-			KeyName:            l.Dependencies.KeyPair.Resource.KeyName,
-			InstanceType:       types.InstanceType(size),
-			SecurityGroupIds:   []string{aws.ToString(l.Dependencies.SecurityGroup.Resource.GroupId)},
-			IamInstanceProfile: l.Dependencies.PermissionSet.Resource,
-			BlockDeviceMappings: []types.LaunchTemplateBlockDeviceMappingRequest{
-				{
-					DeviceName: aws.String("/dev/sda1"),
-					Ebs: &types.LaunchTemplateEbsBlockDeviceRequest{
-						DeleteOnTermination: aws.Bool(true),
-						Encrypted:           aws.Bool(false),
-						VolumeType:          types.VolumeType("gp3"),
-					},
-				},
-			},
-			TagSpecifications: []types.LaunchTemplateTagSpecificationRequest{
-				{
-					ResourceType: types.ResourceTypeInstance,
-					Tags:         makeTagSlice(l.Identifier, l.client.Tags),
-				},
-				{
-					ResourceType: types.ResourceTypeVolume,
-					Tags:         makeTagSlice(l.Identifier, l.client.Tags),
-				},
-			},
-		},
+		LaunchTemplateData: data,
 		TagSpecifications: []types.TagSpecification{
 			{
 				ResourceType: types.ResourceTypeLaunchTemplate,
@@ -114,10 +94,6 @@ func (l *LaunchTemplate) Create(ctx context.Context) error {
 		},
 	}
 
-	if size := l.Attributes.Size.Storage; size > 0 {
-		input.LaunchTemplateData.BlockDeviceMappings[0].Ebs.VolumeSize = aws.Int32(int32(size))
-	}
-
 	if _, err = l.client.Services.EC2.CreateLaunchTemplate(ctx, &input); err != nil {
 		var e smithy.APIError
 		if errors.As(err, &e) && e.ErrorCode() == "InvalidLaunchTemplateName.AlreadyExistsException" {
@@ -129,6 +105,94 @@ func (l *LaunchTemplate) Create(ctx context.Context) error {
 	return l.Read(ctx)
 }
 
+// data renders the launch template data from the task attributes.
+func (l *LaunchTemplate) data() (*types.RequestLaunchTemplateData, error) {
+	if l.Attributes.Environment.Variables == nil {
+		l.Attributes.Environment.Variables = make(map[string]*string)
+	}
+
+	timeout := machine.Deadline(l.Created, l.Attributes.Environment.Timeout)
+	script, err := machine.Script(l.Attributes.Environment.Script, l.Dependencies.Credentials.Resource, l.Attributes.Environment.Variables, l.Attributes.Environment.Inputs, &timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render machine script: %w", err)
+	}
+	userData := base64.StdEncoding.EncodeToString([]byte(script))
+
+	data := &types.RequestLaunchTemplateData{
+		UserData:           aws.String(userData),
+		ImageId:            l.Dependencies.Image.Resource.ImageId,
+		KeyName:            l.Dependencies.KeyPair.Resource.KeyName,
+		InstanceType:       types.InstanceType(l.InstanceTypes()[0]),
+		SecurityGroupIds:   []string{aws.ToString(l.Dependencies.SecurityGroup.Resource.GroupId)},
+		IamInstanceProfile: l.Dependencies.PermissionSet.Resource,
+		BlockDeviceMappings: []types.LaunchTemplateBlockDeviceMappingRequest{
+			{
+				DeviceName: aws.String("/dev/sda1"),
+				Ebs: &types.LaunchTemplateEbsBlockDeviceRequest{
+					DeleteOnTermination: aws.Bool(true),
+					Encrypted:           aws.Bool(false),
+					VolumeType:          types.VolumeType("gp3"),
+				},
+			},
+		},
+		TagSpecifications: []types.LaunchTemplateTagSpecificationRequest{
+			{
+				ResourceType: types.ResourceTypeInstance,
+				Tags:         makeTagSlice(l.Identifier, l.client.Tags),
+			},
+			{
+				ResourceType: types.ResourceTypeVolume,
+				Tags:         makeTagSlice(l.Identifier, l.client.Tags),
+			},
+		},
+	}
+
+	if size := l.Attributes.Size.Storage; size > 0 {
+		data.BlockDeviceMappings[0].Ebs.VolumeSize = aws.Int32(int32(size))
+	}
+
+	return data, nil
+}
+
+// InstanceType translates generic machine sizes into EC2 instance types; other
+// values are passed through verbatim.
+func InstanceType(size string) string {
+	if val, ok := sizes.Lookup(common.ProviderAWS, size); ok {
+		return val
+	}
+	return size
+}
+
+// InstanceTypes returns the acceptable EC2 instance types, in order of
+// preference; the launch template uses the first one, and the auto scaling
+// group overrides it with the others.
+func (l *LaunchTemplate) InstanceTypes() []string {
+	var instanceTypes []string
+	for _, machine := range l.Attributes.Size.Machines() {
+		instanceTypes = append(instanceTypes, InstanceType(machine))
+	}
+	return instanceTypes
+}
+
+// Plan describes the launch template that Create would make.
+func (l *LaunchTemplate) Plan() common.PlannedResource {
+	permissionSet := "none"
+	if l.Dependencies.PermissionSet.Resource != nil {
+		permissionSet = aws.ToString(l.Dependencies.PermissionSet.Resource.Arn)
+	}
+
+	return common.PlannedResource{
+		Type: "LaunchTemplate",
+		Name: l.Identifier,
+		Attributes: map[string]string{
+			"instance_type":  strings.Join(l.InstanceTypes(), ","),
+			"image":          fmt.Sprintf("%s (%s)", aws.ToString(l.Dependencies.Image.Resource.ImageId), aws.ToString(l.Dependencies.Image.Resource.Name)),
+			"disk_size":      common.DiskSize(l.Attributes.Size.Storage),
+			"permission_set": permissionSet,
+		},
+	}
+}
+
 func (l *LaunchTemplate) Read(ctx context.Context) error {
 	input := ec2.DescribeLaunchTemplatesInput{
 		LaunchTemplateNames: []string{l.Identifier},
@@ -147,8 +211,38 @@ func (l *LaunchTemplate) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update creates a new version of the launch template with the current attributes
+// and makes it the default one, so new instances pick up the changes.
 func (l *LaunchTemplate) Update(ctx context.Context) error {
-	return common.NotImplementedError
+	data, err := l.data()
+	if err != nil {
+		return err
+	}
+
+	versionInput := ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateName: aws.String(l.Identifier),
+		LaunchTemplateData: data,
+	}
+
+	version, err := l.client.Services.EC2.CreateLaunchTemplateVersion(ctx, &versionInput)
+	if err != nil {
+		return err
+	}
+
+	modifyInput := ec2.ModifyLaunchTemplateInput{
+		LaunchTemplateName: aws.String(l.Identifier),
+		DefaultVersion:     aws.String(strconv.FormatInt(aws.ToInt64(version.LaunchTemplateVersion.VersionNumber), 10)),
+	}
+
+	if _, err := l.client.Services.EC2.ModifyLaunchTemplate(ctx, &modifyInput); err != nil {
+		return err
+	}
+
+	if err := l.Read(ctx); err != nil {
+		return err
+	}
+
+	return updateTags(ctx, l.client, l.Identifier, []string{aws.ToString(l.Resource.LaunchTemplateId)})
 }
 
 func (l *LaunchTemplate) Delete(ctx context.Context) error {
@@ -11,6 +11,31 @@ import (
 	"terraform-provider-iterative/task/common"
 )
 
+// ListSecurityGroups returns the security groups named after a task identifier.
+func ListSecurityGroups(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+	for paginator := ec2.NewDescribeSecurityGroupsPaginator(client.Services.EC2, &ec2.DescribeSecurityGroupsInput{}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, group := range page.SecurityGroups {
+			if id, err := common.ParseIdentifier(aws.ToString(group.GroupName)); err == nil {
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "SecurityGroup",
+					Name:       aws.ToString(group.GroupName),
+					Tags:       tagMap(group.Tags),
+					Delete:     NewSecurityGroup(client, id, nil, common.Firewall{}).Delete,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
 func NewSecurityGroup(client *client.Client, identifier common.Identifier, defaultVPC *DefaultVPC, firewall common.Firewall) *SecurityGroup {
 	s := &SecurityGroup{
 		client:     client,
@@ -108,6 +133,19 @@ func (s *SecurityGroup) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan describes the security group that Create would make.
+func (s *SecurityGroup) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "SecurityGroup",
+		Name: s.Identifier,
+		Attributes: map[string]string{
+			"vpc":     aws.ToString(s.Dependencies.DefaultVPC.Resource.VpcId),
+			"ingress": s.Attributes.Ingress.String(),
+			"egress":  s.Attributes.Egress.String(),
+		},
+	}
+}
+
 func (s *SecurityGroup) Read(ctx context.Context) error {
 	input := ec2.DescribeSecurityGroupsInput{
 		Filters: []types.Filter{
@@ -131,8 +169,13 @@ func (s *SecurityGroup) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update retags the security group; firewall rules can't be changed in place.
 func (s *SecurityGroup) Update(ctx context.Context) error {
-	return common.NotImplementedError
+	if err := s.Read(ctx); err != nil {
+		return err
+	}
+
+	return updateTags(ctx, s.client, s.Identifier, []string{aws.ToString(s.Resource.GroupId)})
 }
 
 func (s *SecurityGroup) Delete(ctx context.Context) error {
@@ -4,13 +4,16 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
 
 	"github.com/0x2b3bfa0/logrusctx"
+	"github.com/aws/aws-sdk-go-v2/aws"
 
 	"terraform-provider-iterative/task/aws/client"
 	"terraform-provider-iterative/task/aws/resources"
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/common/ssh"
 )
 
@@ -22,7 +25,45 @@ func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error)
 		return nil, err
 	}
 
-	return resources.ListBuckets(ctx, client)
+	buckets, err := resources.ListBuckets(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.TaskIdentifiers(buckets), nil
+}
+
+// ListResources returns every resource named after a task identifier, in
+// creation order, including those left behind by failed deletions.
+func ListResources(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error) {
+	lists := []func(context.Context, *client.Client) ([]common.TaskResource, error){
+		resources.ListBuckets,
+		resources.ListSecurityGroups,
+		resources.ListKeyPairs,
+		resources.ListLaunchTemplates,
+		resources.ListAutoScalingGroups,
+	}
+
+	client, err := client.New(ctx, cloud, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []common.TaskResource
+	for _, list := range lists {
+		found, err := list(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+
+	return result, nil
+}
+
+// MachineType translates generic machine sizes into EC2 instance types.
+func MachineType(machine string) string {
+	return resources.InstanceType(machine)
 }
 
 func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (*Task, error) {
@@ -35,6 +76,9 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 	t.Client = client
 	t.Identifier = identifier
 	t.Attributes = task
+	t.RemoteStorage = machine.NewRemoteStorage(func() map[string]string {
+		return t.DataSources.Credentials.Resource
+	}, &t.Attributes.Environment)
 	t.DataSources.DefaultVPC = resources.NewDefaultVPC(
 		t.Client,
 	)
@@ -45,6 +89,7 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 	t.DataSources.Image = resources.NewImage(
 		t.Client,
 		t.Attributes.Environment.Image,
+		sizes.Architecture(common.ProviderAWS, t.Attributes.Size.Machines()[0]),
 	)
 	t.DataSources.PermissionSet = resources.NewPermissionSet(
 		t.Client,
@@ -112,6 +157,8 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 
 // Task represents a task running in aws with all its dependent resources.
 type Task struct {
+	machine.RemoteStorage
+
 	Client      *client.Client
 	Identifier  common.Identifier
 	Attributes  common.Task
@@ -135,57 +182,110 @@ type Task struct {
 func (t *Task) Create(ctx context.Context) error {
 	logrusctx.Info(ctx, "Creating resources...")
 	steps := []common.Step{{
+		Name:        "permission-set",
 		Description: "Parsing PermissionSet...",
 		Action:      t.DataSources.PermissionSet.Read,
 	}, {
+		Name:        "default-vpc",
 		Description: "Importing DefaultVPC...",
 		Action:      t.DataSources.DefaultVPC.Read,
 	}, {
-		Description: "Importing DefaultVPCSubnets...",
-		Action:      t.DataSources.DefaultVPCSubnets.Read,
+		Name:         "default-vpc-subnets",
+		Description:  "Importing DefaultVPCSubnets...",
+		Action:       t.DataSources.DefaultVPCSubnets.Read,
+		Dependencies: []string{"default-vpc"},
 	}, {
+		Name:        "image",
 		Description: "Reading Image...",
 		Action:      t.DataSources.Image.Read,
 	}}
 	if t.Resources.Bucket != nil {
 		steps = append(steps, common.Step{
+			Name:        "bucket",
 			Description: "Creating Bucket...",
 			Action:      t.Resources.Bucket.Create,
+			Rollback: func(ctx context.Context) error {
+				// The bucket can only contain data uploaded after reading credentials.
+				if remote, ok := t.DataSources.Credentials.Resource["RCLONE_REMOTE"]; ok {
+					if err := machine.Delete(ctx, remote); err != nil && err != common.NotFoundError {
+						return err
+					}
+				}
+				return t.Resources.Bucket.Delete(ctx)
+			},
+			Resume: t.Resources.Bucket.Read,
 		})
 	} else if t.DataSources.Bucket != nil {
 		steps = append(steps, common.Step{
+			Name:        "bucket",
 			Description: "Verifying bucket...",
 			Action:      t.DataSources.Bucket.Read,
 		})
 	}
 	steps = append(steps, []common.Step{{
-		Description: "Creating SecurityGroup...",
-		Action:      t.Resources.SecurityGroup.Create,
+		Name:         "security-group",
+		Description:  "Creating SecurityGroup...",
+		Action:       t.Resources.SecurityGroup.Create,
+		Dependencies: []string{"default-vpc"},
+		Rollback:     t.Resources.SecurityGroup.Delete,
+		Resume:       t.Resources.SecurityGroup.Read,
 	}, {
+		Name:        "key-pair",
 		Description: "Creating KeyPair...",
 		Action:      t.Resources.KeyPair.Create,
+		Rollback:    t.Resources.KeyPair.Delete,
+		Resume:      t.Resources.KeyPair.Read,
 	}, {
-		Description: "Reading Credentials...",
-		Action:      t.DataSources.Credentials.Read,
+		Name:         "credentials",
+		Description:  "Reading Credentials...",
+		Action:       t.DataSources.Credentials.Read,
+		Dependencies: []string{"bucket"},
 	}, {
-		Description: "Creating LaunchTemplate...",
-		Action:      t.Resources.LaunchTemplate.Create,
+		Name:         "launch-template",
+		Description:  "Creating LaunchTemplate...",
+		Action:       t.Resources.LaunchTemplate.Create,
+		Dependencies: []string{"permission-set", "image", "security-group", "key-pair", "credentials"},
+		Rollback:     t.Resources.LaunchTemplate.Delete,
+		Resume:       t.Resources.LaunchTemplate.Read,
 	}, {
-		Description: "Creating AutoScalingGroup...",
-		Action:      t.Resources.AutoScalingGroup.Create,
+		Name:         "auto-scaling-group",
+		Description:  "Creating AutoScalingGroup...",
+		Action:       t.Resources.AutoScalingGroup.Create,
+		Dependencies: []string{"default-vpc-subnets", "launch-template"},
+		Rollback:     t.Resources.AutoScalingGroup.Delete,
+		Resume:       t.Resources.AutoScalingGroup.Read,
+	}, {
+		Name:         "manifest",
+		Description:  "Writing Manifest...",
+		Action:       t.writeManifest,
+		Dependencies: []string{"image", "credentials"},
 	}}...)
 
+	start := []string{"auto-scaling-group", "manifest"}
 	if t.Attributes.Environment.Directory != "" {
 		steps = append(steps, common.Step{
-			Description: "Uploading Directory...",
-			Action:      t.Push,
+			Name:         "push",
+			Description:  "Uploading Directory...",
+			Action:       t.Push,
+			Dependencies: []string{"credentials"},
 		})
+		start = append(start, "push")
+	}
+	if t.Attributes.Environment.Queue.Enabled() {
+		steps = append(steps, common.Step{
+			Name:         "queue",
+			Description:  "Uploading Work Items...",
+			Action:       t.UploadQueue,
+			Dependencies: []string{"credentials"},
+		})
+		start = append(start, "queue")
 	}
 	steps = append(steps, common.Step{
-		Description: "Starting task...",
-		Action:      t.Start,
+		Description:  "Starting task...",
+		Action:       t.Start,
+		Dependencies: start,
 	})
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunStepsWithProgress(ctx, steps, common.NewProgress(t.Identifier)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Creation completed")
@@ -195,6 +295,45 @@ func (t *Task) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan resolves the data sources and describes the resources that Create
+// would make, without creating anything.
+func (t *Task) Plan(ctx context.Context) ([]common.PlannedResource, error) {
+	logrusctx.Info(ctx, "Planning resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}, {
+		Description: "Importing DefaultVPC...",
+		Action:      t.DataSources.DefaultVPC.Read,
+	}, {
+		Description: "Importing DefaultVPCSubnets...",
+		Action:      t.DataSources.DefaultVPCSubnets.Read,
+	}, {
+		Description: "Reading Image...",
+		Action:      t.DataSources.Image.Read,
+	}}
+	if t.DataSources.Bucket != nil {
+		steps = append(steps, common.Step{
+			Description: "Verifying bucket...",
+			Action:      t.DataSources.Bucket.Read,
+		})
+	}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return nil, err
+	}
+
+	plan := []common.PlannedResource{}
+	if t.Resources.Bucket != nil {
+		plan = append(plan, t.Resources.Bucket.Plan())
+	}
+	return append(plan,
+		t.Resources.SecurityGroup.Plan(),
+		t.Resources.KeyPair.Plan(),
+		t.Resources.LaunchTemplate.Plan(),
+		t.Resources.AutoScalingGroup.Plan(),
+	), nil
+}
+
 func (t *Task) Read(ctx context.Context) error {
 	logrusctx.Info(ctx, "Reading resources... (this may happen several times)")
 	steps := []common.Step{{
@@ -225,6 +364,15 @@ func (t *Task) Read(ctx context.Context) error {
 	}, {
 		Description: "Reading Credentials...",
 		Action:      t.DataSources.Credentials.Read,
+	}, {
+		Description: "Reading Manifest...",
+		Action: func(ctx context.Context) error {
+			if err := machine.ApplyManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], &t.Client.Cloud, &t.Attributes); err != nil {
+				return err
+			}
+			t.Client.Tags = t.Client.Cloud.Tags
+			return nil
+		},
 	}, {
 		Description: "Reading LaunchTemplate...",
 		Action:      t.Resources.LaunchTemplate.Read,
@@ -232,13 +380,60 @@ func (t *Task) Read(ctx context.Context) error {
 		Description: "Reading AutoScalingGroup...",
 		Action:      t.Resources.AutoScalingGroup.Read,
 	}}
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Read completed")
 	t.Attributes.Addresses = t.Resources.AutoScalingGroup.Attributes.Addresses
 	t.Attributes.Status = t.Resources.AutoScalingGroup.Attributes.Status
 	t.Attributes.Events = t.Resources.AutoScalingGroup.Attributes.Events
+	preemptions, err := machine.Preemptions(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		logrusctx.Warnf(ctx, "Failed to read preemption reports: %v", err)
+	}
+	t.Attributes.Events = append(t.Attributes.Events, preemptions...)
+	return nil
+}
+
+// Update applies the current attributes to an existing task: it retags the
+// resources, refreshes the launch template so new instances pick up changes to
+// the environment and timeout, and rescales the auto scaling group.
+func (t *Task) Update(ctx context.Context) error {
+	if err := t.Read(ctx); err != nil {
+		return err
+	}
+
+	// Machine deadlines count from the creation of the task, not from updates.
+	created, err := machine.CreationTime(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		return err
+	}
+	t.Resources.LaunchTemplate.Created = created
+
+	logrusctx.Info(ctx, "Updating resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}, {
+		Description: "Updating SecurityGroup...",
+		Action:      t.Resources.SecurityGroup.Update,
+	}, {
+		Description: "Updating KeyPair...",
+		Action:      t.Resources.KeyPair.Update,
+	}, {
+		Description: "Updating LaunchTemplate...",
+		Action:      t.Resources.LaunchTemplate.Update,
+	}, {
+		Description: "Updating AutoScalingGroup...",
+		Action:      t.Resources.AutoScalingGroup.Update,
+	}, {
+		Description: "Updating Instance tags...",
+		Action:      t.Resources.AutoScalingGroup.UpdateTags,
+	}}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Update completed")
 	return nil
 }
 
@@ -291,7 +486,10 @@ func (t *Task) Delete(ctx context.Context) error {
 			Action:      t.Resources.Bucket.Delete,
 		})
 	}
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	if err := common.DeleteProgress(t.Identifier); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Deletion completed")
@@ -302,23 +500,8 @@ func (t *Task) Logs(ctx context.Context) ([]string, error) {
 	return machine.Logs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
 }
 
-// Pull downloads the output directory from remote storage.
-func (t *Task) Pull(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.Directory,
-		machine.LimitTransfer(
-			t.Attributes.Environment.DirectoryOut,
-			t.Attributes.Environment.ExcludeList))
-}
-
-// Push uploads the work directory to remote storage.
-func (t *Task) Push(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.Attributes.Environment.Directory,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.ExcludeList,
-	)
+func (t *Task) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	return machine.StreamLogs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], cursor)
 }
 
 func (t *Task) Start(ctx context.Context) error {
@@ -341,6 +524,16 @@ func (t *Task) Events(ctx context.Context) []common.Event {
 	return t.Attributes.Events
 }
 
+// writeManifest records the task specification along with the resolved image
+// and instance type in the remote storage.
+func (t *Task) writeManifest(ctx context.Context) error {
+	manifest := common.NewManifest(t.Identifier, t.Client.Cloud, t.Attributes)
+	manifest.Region = common.Region(t.Client.Region)
+	manifest.Image = aws.ToString(t.DataSources.Image.Resource.ImageId)
+	manifest.MachineType = strings.Join(t.Resources.LaunchTemplate.InstanceTypes(), ",")
+	return machine.WriteManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], manifest)
+}
+
 func (t *Task) Status(ctx context.Context) (common.Status, error) {
 	return machine.Status(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], t.Attributes.Status)
 }
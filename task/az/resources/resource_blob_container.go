@@ -48,6 +48,17 @@ func (b *BlobContainer) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan describes the blob container that Create would make.
+func (b *BlobContainer) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "BlobContainer",
+		Name: b.Identifier,
+		Attributes: map[string]string{
+			"storage_account": b.Dependencies.StorageAccount.Identifier,
+		},
+	}
+}
+
 func (b *BlobContainer) Read(ctx context.Context) error {
 	container, err := b.client.Services.BlobContainers.Get(ctx, b.Dependencies.ResourceGroup.Identifier, b.Dependencies.StorageAccount.Identifier, b.Identifier)
 	if err != nil {
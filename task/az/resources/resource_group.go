@@ -11,8 +11,8 @@ import (
 	"terraform-provider-iterative/task/common"
 )
 
-func ListResourceGroups(ctx context.Context, client *client.Client) ([]common.Identifier, error) {
-	ids := []common.Identifier{}
+func ListResourceGroups(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
 
 	for page, err := client.Services.Groups.List(ctx, "", nil); page.NotDone(); err = page.Next() {
 		if err != nil {
@@ -21,12 +21,27 @@ func ListResourceGroups(ctx context.Context, client *client.Client) ([]common.Id
 
 		for _, group := range page.Values() {
 			if id, err := common.ParseIdentifier(*group.Name); err == nil {
-				ids = append(ids, id)
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "ResourceGroup",
+					Name:       to.String(group.Name),
+					Tags:       tagMap(group.Tags),
+					Delete:     NewResourceGroup(client, id).Delete,
+				})
 			}
 		}
 	}
 
-	return ids, nil
+	return result, nil
+}
+
+// tagMap converts Azure tags into a map of strings.
+func tagMap(tags map[string]*string) map[string]string {
+	result := make(map[string]string)
+	for key, value := range tags {
+		result[key] = to.String(value)
+	}
+	return result
 }
 
 func NewResourceGroup(client *client.Client, identifier common.Identifier) *ResourceGroup {
@@ -58,6 +73,17 @@ func (r *ResourceGroup) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan describes the resource group that Create would make.
+func (r *ResourceGroup) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "ResourceGroup",
+		Name: r.Identifier,
+		Attributes: map[string]string{
+			"location": r.client.Region,
+		},
+	}
+}
+
 func (r *ResourceGroup) Read(ctx context.Context) error {
 	resourceGroup, err := r.client.Services.Groups.Get(ctx, r.Identifier)
 	if err != nil {
@@ -71,8 +97,20 @@ func (r *ResourceGroup) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update replaces the tags of the resource group with the client tags.
 func (r *ResourceGroup) Update(ctx context.Context) error {
-	return common.NotImplementedError
+	resourceGroup, err := r.client.Services.Groups.Update(
+		ctx,
+		r.Identifier,
+		resources.GroupPatchable{
+			Tags: r.client.Tags,
+		})
+	if err != nil {
+		return err
+	}
+
+	r.Resource = &resourceGroup
+	return nil
 }
 
 func (r *ResourceGroup) Delete(ctx context.Context) error {
@@ -97,6 +97,19 @@ func (s *SecurityGroup) Create(ctx context.Context) error {
 	return s.Read(ctx)
 }
 
+// Plan describes the network security group that Create would make.
+func (s *SecurityGroup) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "SecurityGroup",
+		Name: s.Identifier,
+		Attributes: map[string]string{
+			"resource_group": s.Dependencies.ResourceGroup.Identifier,
+			"ingress":        s.Attributes.Ingress.String(),
+			"egress":         s.Attributes.Egress.String(),
+		},
+	}
+}
+
 func (s *SecurityGroup) Read(ctx context.Context) error {
 	securityGroup, err := s.client.Services.SecurityGroups.Get(ctx, s.Dependencies.ResourceGroup.Identifier, s.Identifier, "")
 	if err != nil {
@@ -59,6 +59,19 @@ func (s *StorageAccount) Create(ctx context.Context) error {
 	return s.Read(ctx)
 }
 
+// Plan describes the storage account that Create would make.
+func (s *StorageAccount) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "StorageAccount",
+		Name: s.Identifier,
+		Attributes: map[string]string{
+			"resource_group": s.Dependencies.ResourceGroup.Identifier,
+			"sku":            string(storage.SkuNameStandardLRS),
+			"kind":           string(storage.KindBlobStorage),
+		},
+	}
+}
+
 func (s *StorageAccount) Read(ctx context.Context) error {
 	account, err := s.client.Services.StorageAccounts.GetProperties(ctx, s.Dependencies.ResourceGroup.Identifier, s.Identifier, "")
 	if err != nil {
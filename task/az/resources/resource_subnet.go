@@ -56,6 +56,19 @@ func (s *Subnet) Create(ctx context.Context) error {
 	return s.Read(ctx)
 }
 
+// Plan describes the subnet that Create would make.
+func (s *Subnet) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "Subnet",
+		Name: s.Identifier,
+		Attributes: map[string]string{
+			"virtual_network": s.Dependencies.VirtualNetwork.Identifier,
+			"security_group":  s.Dependencies.SecurityGroup.Identifier,
+			"address_prefix":  "10.0.0.0/16",
+		},
+	}
+}
+
 func (s *Subnet) Read(ctx context.Context) error {
 	subnet, err := s.client.Services.Subnets.Get(ctx, s.Dependencies.ResourceGroup.Identifier, s.Dependencies.VirtualNetwork.Identifier, s.Identifier, "")
 	if err != nil {
@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"net"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2020-06-30/compute"
@@ -19,8 +22,34 @@ import (
 	"terraform-provider-iterative/task/az/client"
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 )
 
+// ListVirtualMachineScaleSets returns the scale sets named after a task identifier.
+func ListVirtualMachineScaleSets(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+
+	for page, err := client.Services.VirtualMachineScaleSets.ListAll(ctx); page.NotDone(); err = page.NextWithContext(ctx) {
+		if err != nil {
+			return nil, err
+		}
+
+		for _, scaleSet := range page.Values() {
+			if id, err := common.ParseIdentifier(to.String(scaleSet.Name)); err == nil {
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "VirtualMachineScaleSet",
+					Name:       to.String(scaleSet.Name),
+					Tags:       tagMap(scaleSet.Tags),
+					Delete:     NewVirtualMachineScaleSet(client, id, NewResourceGroup(client, id), nil, nil, nil, nil, &common.Task{}).Delete,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
 func NewVirtualMachineScaleSet(client *client.Client, identifier common.Identifier, resourceGroup *ResourceGroup, subnet *Subnet, securityGroup *SecurityGroup, permissionSet *PermissionSet, credentials *Credentials, task *common.Task) *VirtualMachineScaleSet {
 	v := &VirtualMachineScaleSet{
 		client:     client,
@@ -42,6 +71,9 @@ func NewVirtualMachineScaleSet(client *client.Client, identifier common.Identifi
 type VirtualMachineScaleSet struct {
 	client     *client.Client
 	Identifier string
+	// Created is the creation time of the task, which the machine deadline
+	// counts from; it's zero for tasks being created.
+	Created    time.Time
 	Attributes struct {
 		Size        common.Size
 		Environment common.Environment
@@ -63,41 +95,56 @@ type VirtualMachineScaleSet struct {
 }
 
 func (v *VirtualMachineScaleSet) Create(ctx context.Context) error {
-	keyPair, err := v.client.GetKeyPair(ctx)
+	settings, err := v.settings(ctx)
 	if err != nil {
 		return err
 	}
 
-	publicKey, err := keyPair.PublicString()
+	future, err := v.client.Services.VirtualMachineScaleSets.CreateOrUpdate(
+		ctx,
+		v.Dependencies.ResourceGroup.Identifier,
+		v.Identifier,
+		settings,
+	)
 	if err != nil {
 		return err
 	}
 
+	if err := future.WaitForCompletionRef(ctx, v.client.Services.VirtualMachineScaleSets.Client); err != nil {
+		return err
+	}
+
+	return v.Read(ctx)
+}
+
+// settings renders the scale set model from the task attributes.
+func (v *VirtualMachineScaleSet) settings(ctx context.Context) (compute.VirtualMachineScaleSet, error) {
+	keyPair, err := v.client.GetKeyPair(ctx)
+	if err != nil {
+		return compute.VirtualMachineScaleSet{}, err
+	}
+
+	publicKey, err := keyPair.PublicString()
+	if err != nil {
+		return compute.VirtualMachineScaleSet{}, err
+	}
+
 	if v.Attributes.Environment.Variables == nil {
 		v.Attributes.Environment.Variables = make(map[string]*string)
 	}
 
-	timeout := time.Now().Add(v.Attributes.Environment.Timeout)
-	script, err := machine.Script(v.Attributes.Environment.Script, v.Dependencies.Credentials.Resource, v.Attributes.Environment.Variables, &timeout)
+	timeout := machine.Deadline(v.Created, v.Attributes.Environment.Timeout)
+	script, err := machine.Script(v.Attributes.Environment.Script, v.Dependencies.Credentials.Resource, v.Attributes.Environment.Variables, v.Attributes.Environment.Inputs, &timeout)
 	if err != nil {
-		return fmt.Errorf("failed to render machine script: %w", err)
+		return compute.VirtualMachineScaleSet{}, fmt.Errorf("failed to render machine script: %w", err)
 	}
 	// default image to ubuntu in not present
 	if v.Attributes.Environment.Image == "" {
 		v.Attributes.Environment.Image = "ubuntu"
 	}
-	image := v.Attributes.Environment.Image
-	images := map[string]string{
-		"ubuntu": "ubuntu@Canonical:0001-com-ubuntu-server-focal:20_04-lts:latest",
-		"nvidia": "ubuntu@microsoft-dsvm:ubuntu-2004:2004-gen2:latest",
-	}
-	if val, ok := images[image]; ok {
-		image = val
-	}
-
-	imageParts := regexp.MustCompile(`^([^@]+)@([^:]+):([^:]+):([^:]+):([^:]+)(:?(#plan)?)$`).FindStringSubmatch(image)
-	if imageParts == nil {
-		return errors.New("invalid machine image format: use publisher:offer:sku:version")
+	imageParts, err := parseImage(v.Attributes.Environment.Image, sizes.Architecture(common.ProviderAZ, v.Attributes.Size.Machine))
+	if err != nil {
+		return compute.VirtualMachineScaleSet{}, err
 	}
 
 	sshUser := imageParts[1]
@@ -107,24 +154,7 @@ func (v *VirtualMachineScaleSet) Create(ctx context.Context) error {
 	version := imageParts[5]
 	plan := imageParts[6]
 
-	size := v.Attributes.Size.Machine
-	sizes := map[string]string{
-		"s":       "Standard_B1s",
-		"m":       "Standard_F8s_v2",
-		"l":       "Standard_F32s_v2",
-		"xl":      "Standard_F64s_v2",
-		"m+t4":    "Standard_NC4as_T4_v3",
-		"m+k80":   "Standard_NC6",
-		"l+k80":   "Standard_NC12",
-		"xl+k80":  "Standard_NC24",
-		"m+v100":  "Standard_NC6s_v3",
-		"l+v100":  "Standard_NC12s_v3",
-		"xl+v100": "Standard_NC24s_v3",
-	}
-
-	if val, ok := sizes[size]; ok {
-		size = val
-	}
+	size := VMSize(v.Attributes.Size.Machine)
 
 	settings := compute.VirtualMachineScaleSet{
 		Tags:     v.client.Tags,
@@ -220,21 +250,7 @@ func (v *VirtualMachineScaleSet) Create(ctx context.Context) error {
 		}
 	}
 
-	future, err := v.client.Services.VirtualMachineScaleSets.CreateOrUpdate(
-		ctx,
-		v.Dependencies.ResourceGroup.Identifier,
-		v.Identifier,
-		settings,
-	)
-	if err != nil {
-		return err
-	}
-
-	if err := future.WaitForCompletionRef(ctx, v.client.Services.VirtualMachineScaleSets.Client); err != nil {
-		return err
-	}
-
-	return v.Read(ctx)
+	return settings, nil
 }
 
 func (v *VirtualMachineScaleSet) Read(ctx context.Context) error {
@@ -247,20 +263,10 @@ func (v *VirtualMachineScaleSet) Read(ctx context.Context) error {
 	}
 
 	v.Attributes.Events = []common.Event{}
-	v.Attributes.Status = common.Status{common.StatusCodeActive: 0}
 	scaleSetView, err := v.client.Services.VirtualMachineScaleSets.GetInstanceView(ctx, v.Dependencies.ResourceGroup.Identifier, v.Identifier)
 	if err != nil {
 		return err
 	}
-	if scaleSetView.VirtualMachine.StatusesSummary != nil {
-		for _, status := range *scaleSetView.VirtualMachine.StatusesSummary {
-			code := to.String(status.Code)
-			logrusctx.Debug(ctx, "ScaleSet Status Summary:", code, int(to.Int32(status.Count)))
-			if code == "ProvisioningState/succeeded" {
-				v.Attributes.Status[common.StatusCodeActive] = int(to.Int32(status.Count))
-			}
-		}
-	}
 	if scaleSetView.Statuses != nil {
 		for _, status := range *scaleSetView.Statuses {
 			statusTime := time.Unix(0, 0)
@@ -285,10 +291,18 @@ func (v *VirtualMachineScaleSet) Read(ctx context.Context) error {
 		return err
 	}
 
+	machineAddresses := map[string]net.IP{}
 	for machineListPages.NotDone() {
 		for _, machine := range machineListPages.Values() {
 			if address := net.ParseIP(to.String(machine.PublicIPAddressPropertiesFormat.IPAddress)); address != nil {
 				v.Attributes.Addresses = append(v.Attributes.Addresses, address)
+				if configuration := machine.PublicIPAddressPropertiesFormat.IPConfiguration; configuration != nil {
+					// Configuration identifiers look like .../virtualMachines/{instance}/networkInterfaces/...
+					if _, suffix, ok := strings.Cut(to.String(configuration.ID), "/virtualMachines/"); ok {
+						instance, _, _ := strings.Cut(suffix, "/")
+						machineAddresses[instance] = address
+					}
+				}
 			}
 		}
 		if err := machineListPages.NextWithContext(ctx); err != nil {
@@ -296,10 +310,39 @@ func (v *VirtualMachineScaleSet) Read(ctx context.Context) error {
 		}
 	}
 
+	v.Attributes.Status = common.Status{}
+	virtualMachinePages, err := v.client.Services.VirtualMachineScaleSetVMs.List(ctx, v.Dependencies.ResourceGroup.Identifier, v.Identifier, "", "", "instanceView")
+	if err != nil {
+		return err
+	}
+
+	for virtualMachinePages.NotDone() {
+		for _, virtualMachine := range virtualMachinePages.Values() {
+			logrusctx.Debug(ctx, "ScaleSet VM State:", to.String(virtualMachine.Name), to.String(virtualMachine.ProvisioningState))
+			machine := common.MachineStatus{
+				Machine: to.String(virtualMachine.Name),
+				Phase:   virtualMachinePhase(virtualMachine),
+				Address: machineAddresses[to.String(virtualMachine.InstanceID)],
+			}
+			if view := virtualMachine.InstanceView; view != nil && view.Statuses != nil {
+				for _, status := range *view.Statuses {
+					if to.String(status.Code) == "ProvisioningState/succeeded" && status.Time != nil {
+						machine.Started = status.Time.Time
+					}
+				}
+			}
+			v.Attributes.Status = append(v.Attributes.Status, machine)
+		}
+		if err := virtualMachinePages.NextWithContext(ctx); err != nil {
+			return err
+		}
+	}
+
 	v.Resource = &scaleSet
 	return nil
 }
 
+// Update sets the capacity of the scale set to Parallelism.
 func (v *VirtualMachineScaleSet) Update(ctx context.Context) error {
 	if err := v.Read(ctx); err != nil {
 		return err
@@ -323,6 +366,36 @@ func (v *VirtualMachineScaleSet) Update(ctx context.Context) error {
 	return nil
 }
 
+// UpdateModel applies the current attributes to the scale set model, including
+// its tags, so new virtual machines pick up the changes.
+func (v *VirtualMachineScaleSet) UpdateModel(ctx context.Context) error {
+	if err := v.Read(ctx); err != nil {
+		return err
+	}
+
+	settings, err := v.settings(ctx)
+	if err != nil {
+		return err
+	}
+
+	settings.Sku.Capacity = v.Resource.Sku.Capacity
+	future, err := v.client.Services.VirtualMachineScaleSets.CreateOrUpdate(
+		ctx,
+		v.Dependencies.ResourceGroup.Identifier,
+		v.Identifier,
+		settings,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := future.WaitForCompletionRef(ctx, v.client.Services.VirtualMachineScaleSets.Client); err != nil {
+		return err
+	}
+
+	return v.Read(ctx)
+}
+
 func (v *VirtualMachineScaleSet) Delete(ctx context.Context) error {
 	future, err := v.client.Services.VirtualMachineScaleSets.Delete(ctx, v.Dependencies.ResourceGroup.Identifier, v.Identifier)
 	if err != nil {
@@ -339,3 +412,103 @@ func (v *VirtualMachineScaleSet) Delete(ctx context.Context) error {
 	v.Resource = nil
 	return nil
 }
+
+// virtualMachinePhase maps the state of scale set virtual machines to machine phases;
+// machines going away without a status report are being replaced by the scale
+// set, so they're considered provisioning rather than failed.
+func virtualMachinePhase(virtualMachine compute.VirtualMachineScaleSetVM) common.Phase {
+	switch to.String(virtualMachine.ProvisioningState) {
+	case "Failed":
+		return common.PhaseFailed
+	case "Succeeded":
+		if view := virtualMachine.InstanceView; view != nil && view.Statuses != nil {
+			for _, status := range *view.Statuses {
+				if code := to.String(status.Code); strings.HasPrefix(code, "PowerState/") && code != "PowerState/running" {
+					return common.PhaseProvisioning
+				}
+			}
+		}
+		return common.PhaseRunning
+	default:
+		return common.PhaseProvisioning
+	}
+}
+
+// parseImage translates image aliases for the given machine architecture and
+// splits the result into its user@publisher:offer:sku:version[:#plan] parts.
+func parseImage(image string, architecture common.Architecture) ([]string, error) {
+	images := map[common.Architecture]map[string]string{
+		common.ArchitectureAMD64: {
+			"ubuntu": "ubuntu@Canonical:0001-com-ubuntu-server-focal:20_04-lts:latest",
+			"nvidia": "ubuntu@microsoft-dsvm:ubuntu-2004:2004-gen2:latest",
+		},
+		common.ArchitectureARM64: {
+			"ubuntu": "ubuntu@Canonical:0001-com-ubuntu-server-focal:20_04-lts-arm64:latest",
+		},
+	}
+	if val, ok := images[architecture][image]; ok {
+		image = val
+	} else if _, ok := images[common.ArchitectureAMD64][image]; ok {
+		return nil, fmt.Errorf("image %s isn't available for %s machines", image, architecture)
+	}
+
+	imageParts := regexp.MustCompile(`^([^@]+)@([^:]+):([^:]+):([^:]+):([^:]+)(:?(#plan)?)$`).FindStringSubmatch(image)
+	if imageParts == nil {
+		return nil, errors.New("invalid machine image format: use publisher:offer:sku:version")
+	}
+	return imageParts, nil
+}
+
+// ImageReference returns the publisher:offer:sku:version reference of the
+// given image, resolving the generic image names for the machine architecture.
+func ImageReference(image string, architecture common.Architecture) (string, error) {
+	if image == "" {
+		image = "ubuntu"
+	}
+	imageParts, err := parseImage(image, architecture)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(imageParts[2:6], ":"), nil
+}
+
+// VMSize translates generic machine sizes into Azure virtual machine sizes;
+// other values are passed through verbatim.
+func VMSize(size string) string {
+	if val, ok := sizes.Lookup(common.ProviderAZ, size); ok {
+		return val
+	}
+	return size
+}
+
+// Plan describes the virtual machine scale set that Create would make.
+func (v *VirtualMachineScaleSet) Plan() (common.PlannedResource, error) {
+	image, err := ImageReference(v.Attributes.Environment.Image, sizes.Architecture(common.ProviderAZ, v.Attributes.Size.Machine))
+	if err != nil {
+		return common.PlannedResource{}, err
+	}
+
+	permissionSet := "none"
+	if v.Dependencies.PermissionSet.Resource != nil {
+		var identities []string
+		for identity := range v.Dependencies.PermissionSet.Resource.UserAssignedIdentities {
+			identities = append(identities, identity)
+		}
+		sort.Strings(identities)
+		permissionSet = strings.Join(identities, ",")
+	}
+
+	return common.PlannedResource{
+		Type: "VirtualMachineScaleSet",
+		Name: v.Identifier,
+		Attributes: map[string]string{
+			"vm_size":        VMSize(v.Attributes.Size.Machine),
+			"image":          image,
+			"disk_size":      common.DiskSize(v.Attributes.Size.Storage),
+			"subnet":         v.Dependencies.Subnet.Identifier,
+			"parallelism":    strconv.Itoa(int(*v.Attributes.Parallelism)),
+			"spot":           common.Spot(v.Attributes.Spot).String(),
+			"permission_set": permissionSet,
+		},
+	}, nil
+}
@@ -0,0 +1,28 @@
+package resources_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/az/resources"
+	"terraform-provider-iterative/task/common"
+)
+
+// TestImageReference tests the resolution of image aliases for each architecture.
+func TestImageReference(t *testing.T) {
+	image, err := resources.ImageReference("", common.ArchitectureAMD64)
+	require.NoError(t, err)
+	require.Equal(t, "Canonical:0001-com-ubuntu-server-focal:20_04-lts:latest", image)
+
+	image, err = resources.ImageReference("ubuntu", common.ArchitectureARM64)
+	require.NoError(t, err)
+	require.Equal(t, "Canonical:0001-com-ubuntu-server-focal:20_04-lts-arm64:latest", image)
+
+	_, err = resources.ImageReference("nvidia", common.ArchitectureARM64)
+	require.EqualError(t, err, "image nvidia isn't available for arm64 machines")
+
+	image, err = resources.ImageReference("user@publisher:offer:sku:1.0", common.ArchitectureARM64)
+	require.NoError(t, err)
+	require.Equal(t, "publisher:offer:sku:1.0", image)
+}
@@ -58,6 +58,18 @@ func (v *VirtualNetwork) Create(ctx context.Context) error {
 	return v.Read(ctx)
 }
 
+// Plan describes the virtual network that Create would make.
+func (v *VirtualNetwork) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "VirtualNetwork",
+		Name: v.Identifier,
+		Attributes: map[string]string{
+			"resource_group": v.Dependencies.ResourceGroup.Identifier,
+			"address_space":  "10.0.0.0/8",
+		},
+	}
+}
+
 func (v *VirtualNetwork) Read(ctx context.Context) error {
 	virtualNetwork, err := v.client.Services.VirtualNetworks.Get(ctx, v.Dependencies.ResourceGroup.Identifier, v.Identifier, "")
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 	"terraform-provider-iterative/task/az/resources"
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/common/ssh"
 )
 
@@ -19,7 +20,39 @@ func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error)
 		return nil, err
 	}
 
-	return resources.ListResourceGroups(ctx, client)
+	groups, err := resources.ListResourceGroups(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.TaskIdentifiers(groups), nil
+}
+
+// ListResources returns the resource groups and scale sets named after a task
+// identifier, in creation order; every other resource of a task lives in its
+// resource group and is deleted along with it.
+func ListResources(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error) {
+	client, err := client.New(ctx, cloud, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := resources.ListResourceGroups(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	scaleSets, err := resources.ListVirtualMachineScaleSets(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(groups, scaleSets...), nil
+}
+
+// MachineType translates generic machine sizes into Azure virtual machine sizes.
+func MachineType(machine string) string {
+	return resources.VMSize(machine)
 }
 
 func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (*Task, error) {
@@ -32,6 +65,9 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 	t.Client = client
 	t.Identifier = identifier
 	t.Attributes = task
+	t.RemoteStorage = machine.NewRemoteStorage(func() map[string]string {
+		return t.DataSources.Credentials.Resource
+	}, &t.Attributes.Environment)
 	t.DataSources.PermissionSet = resources.NewPermissionSet(
 		t.Client,
 		t.Attributes.PermissionSet,
@@ -103,6 +139,8 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 }
 
 type Task struct {
+	machine.RemoteStorage
+
 	Client      *client.Client
 	Identifier  common.Identifier
 	Attributes  common.Task
@@ -125,51 +163,101 @@ type Task struct {
 func (t *Task) Create(ctx context.Context) error {
 	logrusctx.Info(ctx, "Creating resources...")
 	steps := []common.Step{{
+		Name:        "resource-group",
 		Description: "Creating ResourceGroup...",
 		Action:      t.Resources.ResourceGroup.Create,
+		Rollback:    t.Resources.ResourceGroup.Delete,
+		Resume:      t.Resources.ResourceGroup.Read,
 	}}
 	if t.Resources.BlobContainer != nil {
 		steps = append(steps, []common.Step{{
-			Description: "Creating StorageAccount...",
-			Action:      t.Resources.StorageAccount.Create,
+			Name:         "storage-account",
+			Description:  "Creating StorageAccount...",
+			Action:       t.Resources.StorageAccount.Create,
+			Dependencies: []string{"resource-group"},
+			Rollback:     t.Resources.StorageAccount.Delete,
+			Resume:       t.Resources.StorageAccount.Read,
 		}, {
-			Description: "Creating BlobContainer...",
-			Action:      t.Resources.BlobContainer.Create,
+			Name:         "blob-container",
+			Description:  "Creating BlobContainer...",
+			Action:       t.Resources.BlobContainer.Create,
+			Dependencies: []string{"storage-account"},
+			Rollback:     t.Resources.BlobContainer.Delete,
+			Resume:       t.Resources.BlobContainer.Read,
 		}}...)
 	} else if t.DataSources.BlobContainer != nil {
 		steps = append(steps, common.Step{
+			Name:        "blob-container",
 			Description: "Reading BlobContainer...",
 			Action:      t.DataSources.BlobContainer.Read,
 		})
 	}
 
 	steps = append(steps, []common.Step{{
-		Description: "Creating Credentials...",
-		Action:      t.DataSources.Credentials.Read,
+		Name:         "credentials",
+		Description:  "Creating Credentials...",
+		Action:       t.DataSources.Credentials.Read,
+		Dependencies: []string{"resource-group", "blob-container"},
+	}, {
+		Name:         "virtual-network",
+		Description:  "Creating VirtualNetwork...",
+		Action:       t.Resources.VirtualNetwork.Create,
+		Dependencies: []string{"resource-group"},
+		Rollback:     t.Resources.VirtualNetwork.Delete,
+		Resume:       t.Resources.VirtualNetwork.Read,
 	}, {
-		Description: "Creating VirtualNetwork...",
-		Action:      t.Resources.VirtualNetwork.Create,
+		Name:         "security-group",
+		Description:  "Creating SecurityGroup...",
+		Action:       t.Resources.SecurityGroup.Create,
+		Dependencies: []string{"resource-group"},
+		Rollback:     t.Resources.SecurityGroup.Delete,
+		Resume:       t.Resources.SecurityGroup.Read,
 	}, {
-		Description: "Creating SecurityGroup...",
-		Action:      t.Resources.SecurityGroup.Create,
+		Name:         "subnet",
+		Description:  "Creating Subnet...",
+		Action:       t.Resources.Subnet.Create,
+		Dependencies: []string{"virtual-network", "security-group"},
+		Rollback:     t.Resources.Subnet.Delete,
+		Resume:       t.Resources.Subnet.Read,
 	}, {
-		Description: "Creating Subnet...",
-		Action:      t.Resources.Subnet.Create,
+		Name:         "virtual-machine-scale-set",
+		Description:  "Creating VirtualMachineScaleSet...",
+		Action:       t.Resources.VirtualMachineScaleSet.Create,
+		Dependencies: []string{"subnet", "credentials"},
+		Rollback:     t.Resources.VirtualMachineScaleSet.Delete,
+		Resume:       t.Resources.VirtualMachineScaleSet.Read,
 	}, {
-		Description: "Creating VirtualMachineScaleSet...",
-		Action:      t.Resources.VirtualMachineScaleSet.Create,
+		Name:         "manifest",
+		Description:  "Writing Manifest...",
+		Action:       t.writeManifest,
+		Dependencies: []string{"credentials"},
 	}}...)
+
+	start := []string{"virtual-machine-scale-set", "manifest"}
 	if t.Attributes.Environment.Directory != "" {
 		steps = append(steps, common.Step{
-			Description: "Uploading Directory...",
-			Action:      t.Push,
+			Name:         "push",
+			Description:  "Uploading Directory...",
+			Action:       t.Push,
+			Dependencies: []string{"credentials"},
 		})
+		start = append(start, "push")
+	}
+	if t.Attributes.Environment.Queue.Enabled() {
+		steps = append(steps, common.Step{
+			Name:         "queue",
+			Description:  "Uploading Work Items...",
+			Action:       t.UploadQueue,
+			Dependencies: []string{"credentials"},
+		})
+		start = append(start, "queue")
 	}
 	steps = append(steps, common.Step{
-		Description: "Starting task...",
-		Action:      t.Start,
+		Description:  "Starting task...",
+		Action:       t.Start,
+		Dependencies: start,
 	})
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunStepsWithProgress(ctx, steps, common.NewProgress(t.Identifier)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Creation completed")
@@ -179,6 +267,40 @@ func (t *Task) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan resolves the data sources and describes the resources that Create
+// would make, without creating anything.
+func (t *Task) Plan(ctx context.Context) ([]common.PlannedResource, error) {
+	logrusctx.Info(ctx, "Planning resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}}
+	if t.DataSources.BlobContainer != nil {
+		steps = append(steps, common.Step{
+			Description: "Reading BlobContainer...",
+			Action:      t.DataSources.BlobContainer.Read,
+		})
+	}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return nil, err
+	}
+
+	plan := []common.PlannedResource{t.Resources.ResourceGroup.Plan()}
+	if t.Resources.BlobContainer != nil {
+		plan = append(plan, t.Resources.StorageAccount.Plan(), t.Resources.BlobContainer.Plan())
+	}
+	scaleSet, err := t.Resources.VirtualMachineScaleSet.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return append(plan,
+		t.Resources.VirtualNetwork.Plan(),
+		t.Resources.SecurityGroup.Plan(),
+		t.Resources.Subnet.Plan(),
+		scaleSet,
+	), nil
+}
+
 func (t *Task) Read(ctx context.Context) error {
 	logrusctx.Info(ctx, "Reading resources... (this may happen several times)")
 	steps := []common.Step{{
@@ -203,6 +325,11 @@ func (t *Task) Read(ctx context.Context) error {
 	steps = append(steps, []common.Step{{
 		Description: "Reading Credentials...",
 		Action:      t.DataSources.Credentials.Read,
+	}, {
+		Description: "Reading Manifest...",
+		Action: func(ctx context.Context) error {
+			return machine.ApplyManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], &t.Client.Cloud, &t.Attributes)
+		},
 	}, {
 		Description: "Reading VirtualNetwork...",
 		Action:      t.Resources.VirtualNetwork.Read,
@@ -216,13 +343,51 @@ func (t *Task) Read(ctx context.Context) error {
 		Description: "Reading VirtualMachineScaleSet...",
 		Action:      t.Resources.VirtualMachineScaleSet.Read,
 	}}...)
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Read completed")
 	t.Attributes.Addresses = t.Resources.VirtualMachineScaleSet.Attributes.Addresses
 	t.Attributes.Status = t.Resources.VirtualMachineScaleSet.Attributes.Status
 	t.Attributes.Events = t.Resources.VirtualMachineScaleSet.Attributes.Events
+	preemptions, err := machine.Preemptions(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		logrusctx.Warnf(ctx, "Failed to read preemption reports: %v", err)
+	}
+	t.Attributes.Events = append(t.Attributes.Events, preemptions...)
+	return nil
+}
+
+// Update applies the current attributes to an existing task: it retags the
+// resource group, refreshes the scale set model so new machines pick up changes
+// to the environment and timeout, and rescales the scale set.
+func (t *Task) Update(ctx context.Context) error {
+	if err := t.Read(ctx); err != nil {
+		return err
+	}
+
+	// Machine deadlines count from the creation of the task, not from updates.
+	created, err := machine.CreationTime(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		return err
+	}
+	t.Resources.VirtualMachineScaleSet.Created = created
+
+	logrusctx.Info(ctx, "Updating resources...")
+	steps := []common.Step{{
+		Description: "Updating ResourceGroup...",
+		Action:      t.Resources.ResourceGroup.Update,
+	}, {
+		Description: "Updating VirtualMachineScaleSet model...",
+		Action:      t.Resources.VirtualMachineScaleSet.UpdateModel,
+	}, {
+		Description: "Updating VirtualMachineScaleSet...",
+		Action:      t.Resources.VirtualMachineScaleSet.Update,
+	}}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Update completed")
 	return nil
 }
 
@@ -283,7 +448,10 @@ func (t *Task) Delete(ctx context.Context) error {
 		Description: "Deleting ResourceGroup...",
 		Action:      t.Resources.ResourceGroup.Delete,
 	})
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	if err := common.DeleteProgress(t.Identifier); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Deletion completed")
@@ -294,23 +462,8 @@ func (t *Task) Logs(ctx context.Context) ([]string, error) {
 	return machine.Logs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
 }
 
-// Pull downloads the output directory from remote storage.
-func (t *Task) Pull(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.Directory,
-		machine.LimitTransfer(
-			t.Attributes.Environment.DirectoryOut,
-			t.Attributes.Environment.ExcludeList))
-}
-
-// Push uploads the work directory to remote storage.
-func (t *Task) Push(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.Attributes.Environment.Directory,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.ExcludeList,
-	)
+func (t *Task) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	return machine.StreamLogs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], cursor)
 }
 
 func (t *Task) Start(ctx context.Context) error {
@@ -333,6 +486,21 @@ func (t *Task) Events(ctx context.Context) []common.Event {
 	return t.Attributes.Events
 }
 
+// writeManifest records the task specification along with the resolved image
+// and virtual machine size in the remote storage.
+func (t *Task) writeManifest(ctx context.Context) error {
+	image, err := resources.ImageReference(t.Attributes.Environment.Image, sizes.Architecture(common.ProviderAZ, t.Attributes.Size.Machine))
+	if err != nil {
+		return err
+	}
+
+	manifest := common.NewManifest(t.Identifier, t.Client.Cloud, t.Attributes)
+	manifest.Region = common.Region(t.Client.Region)
+	manifest.Image = image
+	manifest.MachineType = resources.VMSize(t.Attributes.Size.Machine)
+	return machine.WriteManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], manifest)
+}
+
 func (t *Task) Status(ctx context.Context) (common.Status, error) {
 	return machine.Status(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], t.Attributes.Status)
 }
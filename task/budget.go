@@ -0,0 +1,163 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/0x2b3bfa0/logrusctx"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/pricing"
+)
+
+// budgetGuard wraps a task with a maximum cost: every Read accumulates the
+// spend from the uptime of the task machines and the costs they report and,
+// once it exceeds the limit, stops the task and records a budget-exceeded
+// event.
+type budgetGuard struct {
+	Task
+	provider *Provider
+	// hourly is the price of a single machine per hour.
+	hourly float64
+	limit  float64
+	// restore makes the next Read take the limit from the task manifest,
+	// for partial specifications without one.
+	restore bool
+	event   *common.Event
+}
+
+// newBudgetGuard creates a task that enforces task.MaxCost. Machines also get
+// the limit and their hourly price through the TPI_MAX_COST and
+// TPI_MACHINE_COST variables, so they can stop the task by themselves while
+// nobody is reading it. Tasks without a known price aren't guarded, and
+// partial specifications get the limit from the task manifest.
+func newBudgetGuard(ctx context.Context, provider *Provider, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+	if task.Partial() && task.MaxCost <= 0 {
+		t, err := provider.New(ctx, cloud, identifier, task)
+		if err != nil {
+			return nil, err
+		}
+		return &budgetGuard{Task: t, provider: provider, restore: true}, nil
+	}
+
+	price, err := lookupPrice(provider, task)
+	if err != nil {
+		logrusctx.Warnf(ctx, "The maximum cost of $%.2f won't be enforced: %v", task.MaxCost, err)
+		return provider.New(ctx, cloud, identifier, task)
+	}
+
+	hourly := pricing.NewEstimate(price, task.Spot, 1, 0).Hourly
+	maxCost := strconv.FormatFloat(task.MaxCost, 'f', -1, 64)
+	machineCost := strconv.FormatFloat(hourly, 'f', -1, 64)
+
+	variables := common.Variables{}
+	for name, value := range task.Environment.Variables {
+		variables[name] = value
+	}
+	variables["TPI_MAX_COST"] = &maxCost
+	variables["TPI_MACHINE_COST"] = &machineCost
+	task.Environment.Variables = variables
+
+	t, err := provider.New(ctx, cloud, identifier, task)
+	if err != nil {
+		return nil, err
+	}
+
+	return &budgetGuard{Task: t, provider: provider, hourly: hourly, limit: task.MaxCost}, nil
+}
+
+func (b *budgetGuard) Read(ctx context.Context) error {
+	if err := b.Task.Read(ctx); err != nil {
+		return err
+	}
+
+	if b.restore {
+		if err := b.restoreLimit(ctx); err != nil {
+			return err
+		}
+		b.restore = false
+	}
+	if b.limit <= 0 {
+		return nil
+	}
+
+	status, err := b.Task.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Machines report their own spend and the event of stopping the task.
+	var reported map[string]float64
+	var stopped *common.Event
+	if remote, err := b.Task.Storage(ctx); err == nil {
+		if reported, err = machine.Costs(ctx, remote); err != nil {
+			return err
+		}
+		if stopped, err = machine.BudgetExceeded(ctx, remote); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, common.NotImplementedError) && !errors.Is(err, common.NotFoundError) {
+		return err
+	}
+
+	b.event = nil
+	now := time.Now()
+	exceeded, ok := pricing.BudgetExceeded(b.hourly, b.limit, status, reported, now)
+	switch {
+	case stopped != nil:
+		b.event = stopped
+	case ok:
+		b.event = &common.Event{
+			Time: exceeded,
+			Code: common.EventBudgetExceeded,
+			Description: []string{
+				fmt.Sprintf("Spend of $%.2f exceeded the maximum cost of $%.2f", pricing.Spend(b.hourly, status, reported, now), b.limit),
+			},
+		}
+	default:
+		return nil
+	}
+
+	for _, machine := range status {
+		if !machine.Phase.Finished() {
+			logrusctx.Warnf(ctx, "Stopping task: %s", b.event.Description[0])
+			return b.Task.Stop(ctx)
+		}
+	}
+	return nil
+}
+
+// restoreLimit reads the maximum cost and the machine price from the task
+// manifest; tasks created without a maximum cost or a manifest aren't guarded.
+func (b *budgetGuard) restoreLimit(ctx context.Context) error {
+	manifest, err := b.Task.Manifest(ctx)
+	if errors.Is(err, common.NotFoundError) || errors.Is(err, common.NotImplementedError) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if manifest.Task.MaxCost <= 0 {
+		return nil
+	}
+
+	price, err := lookupPrice(b.provider, manifest.Task)
+	if err != nil {
+		logrusctx.Warnf(ctx, "The maximum cost of $%.2f won't be enforced: %v", manifest.Task.MaxCost, err)
+		return nil
+	}
+	b.hourly = pricing.NewEstimate(price, manifest.Task.Spot, 1, 0).Hourly
+	b.limit = manifest.Task.MaxCost
+	return nil
+}
+
+func (b *budgetGuard) Events(ctx context.Context) []common.Event {
+	events := b.Task.Events(ctx)
+	if b.event != nil {
+		events = append(events, *b.event)
+	}
+	return events
+}
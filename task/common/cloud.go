@@ -2,6 +2,7 @@ package common
 
 import (
 	"errors"
+	"strings"
 	"time"
 )
 
@@ -10,7 +11,10 @@ type Cloud struct {
 	Provider    Provider
 	Credentials Credentials
 	Region      Region
-	Tags        map[string]string
+	// FallbackRegions lists, in order of preference, the regions where the
+	// task is recreated when Region lacks capacity.
+	FallbackRegions []Region
+	Tags            map[string]string
 }
 
 type Timeouts struct {
@@ -21,6 +25,28 @@ type Timeouts struct {
 }
 
 type Region string
+
+// ParseRegions splits a comma-separated list of regions into the preferred
+// region and the fallback ones. Kubernetes regions are comma-separated node
+// selectors instead, and don't have fallbacks.
+func ParseRegions(provider Provider, value string) (Region, []Region) {
+	if provider == ProviderK8S {
+		return Region(value), nil
+	}
+
+	var regions []Region
+	for _, region := range strings.Split(value, ",") {
+		if region = strings.TrimSpace(region); region != "" {
+			regions = append(regions, Region(region))
+		}
+	}
+
+	if len(regions) == 0 {
+		return "", nil
+	}
+	return regions[0], regions[1:]
+}
+
 type Provider string
 
 const (
@@ -28,6 +54,8 @@ const (
 	ProviderGCP Provider = "gcp"
 	ProviderAZ  Provider = "az"
 	ProviderK8S Provider = "k8s"
+	// ProviderLocal runs tasks as local processes, using a local directory as storage.
+	ProviderLocal Provider = "local"
 )
 
 type Credentials struct {
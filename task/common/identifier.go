@@ -74,6 +74,13 @@ func NewRandomIdentifier(name string) Identifier {
 	return NewRandomIdentifierWithPrefix(defaultIdentifierPrefix, name)
 }
 
+// Derive returns a deterministic Identifier for a resource named name that
+// belongs to the one identified by i, like a stage of a pipeline. Repeated
+// calls with the same name are guaranteed to generate the same Identifier.
+func (i Identifier) Derive(name string) Identifier {
+	return Identifier{prefix: i.prefix, name: i.name + "-" + name, salt: hash(i.salt+"-"+name, shortLength/2)}
+}
+
 func (i Identifier) Long() string {
 	name := normalize(i.name, nameLength)
 	return fmt.Sprintf("%s-%s-%s-%s", i.prefix, name, i.salt, hash(name+i.salt, shortLength/2))
@@ -49,6 +49,21 @@ func TestIdentifier(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("derivation", func(t *testing.T) {
+		identifier := NewDeterministicIdentifier(name)
+		parsed, err := ParseIdentifier(identifier.Long())
+		require.NoError(t, err)
+
+		first := identifier.Derive("first")
+		require.Equal(t, first.Long(), parsed.Derive("first").Long())
+		require.NotEqual(t, first.Long(), identifier.Derive("second").Long())
+		require.NotEqual(t, first.Long(), NewDeterministicIdentifier("other").Derive("first").Long())
+
+		derived, err := ParseIdentifier(first.Long())
+		require.NoError(t, err)
+		require.Equal(t, first.Long(), derived.Long())
+	})
+
 	t.Run("randomness", func(t *testing.T) {
 		name := "test"
 
@@ -0,0 +1,343 @@
+package machine
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0x2b3bfa0/logrusctx"
+	units "github.com/docker/go-units"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+const (
+	// bundleInput is the directory of the task storage with the archives of
+	// the working directory, unpacked by machines when they start.
+	bundleInput = "bundle/input"
+	// bundleOutput is the directory of the task storage where machines upload
+	// the archives of their working directory, with the same layout as data.
+	bundleOutput = "bundle/output"
+	// bundlePartSize is the size of the files packed into every archive,
+	// before compression.
+	bundlePartSize = 256 << 20
+	// bundleSuffix is the extension of bundle archives.
+	bundleSuffix = ".tar.zst"
+)
+
+// PushBundle packs the source directory into compressed archives, skipping
+// the files matched by the given exclusion rules, and uploads them to the task
+// storage in remote, replacing the previous ones.
+func PushBundle(ctx context.Context, source, remote string, exclude []string) error {
+	ctx, err := transferFilter(ctx, exclude)
+	if err != nil {
+		return err
+	}
+
+	sourceFileSystem, err := fs.NewFs(ctx, source)
+	if err != nil {
+		return err
+	}
+
+	bundleFileSystem, err := fs.NewFs(ctx, remote+"/"+bundleInput)
+	if err != nil {
+		return err
+	}
+	if err := operations.Delete(ctx, bundleFileSystem); err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return err
+	}
+
+	count, size, err := operations.Count(ctx, sourceFileSystem)
+	if err != nil {
+		return err
+	}
+	logrusctx.Infof(ctx, "Bundling %s (%d files)...", units.HumanSize(float64(size)), count)
+
+	defer progress(10 * time.Second)()
+
+	writer := &bundleWriter{ctx: ctx, remote: bundleFileSystem}
+	err = walk.ListR(ctx, sourceFileSystem, "", false, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			name := entry.Remote()
+			info, err := os.Lstat(filepath.Join(source, filepath.FromSlash(name)))
+			if err != nil {
+				return err
+			}
+			if err := writer.add(name, info, filepath.Join(source, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writer.abort(err)
+		return err
+	}
+	return writer.close()
+}
+
+// PullBundle downloads the archives uploaded by machines to the task storage
+// in remote and unpacks them into the data directory of destination, with the
+// same layout as the data directory of the task storage.
+func PullBundle(ctx context.Context, remote, destination string) error {
+	if err := os.MkdirAll(filepath.Join(destination, "data"), 0755); err != nil {
+		return err
+	}
+
+	bundleFileSystem, err := fs.NewFs(ctx, remote+"/"+bundleOutput)
+	if err != nil {
+		return err
+	}
+
+	var parts []fs.Object
+	err = walk.ListR(ctx, bundleFileSystem, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if object, ok := entry.(fs.Object); ok && strings.HasSuffix(object.Remote(), bundleSuffix) {
+				parts = append(parts, object)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	sort.Slice(parts, func(a, b int) bool {
+		return parts[a].Remote() < parts[b].Remote()
+	})
+
+	for _, part := range parts {
+		logrusctx.Infof(ctx, "Unbundling %s (%s)...", part.Remote(), units.HumanSize(float64(part.Size())))
+		directory := filepath.Join(destination, "data", filepath.FromSlash(path.Dir(part.Remote())))
+		if err := unbundle(ctx, part, directory); err != nil {
+			return fmt.Errorf("failed to unbundle %s: %w", part.Remote(), err)
+		}
+	}
+	return nil
+}
+
+// bundleWriter packs files into compressed archives of bundlePartSize, each
+// one uploaded while it's written.
+type bundleWriter struct {
+	ctx    context.Context
+	remote fs.Fs
+
+	part       int
+	size       int64
+	pipe       *io.PipeWriter
+	compressor *zstd.Encoder
+	archive    *tar.Writer
+	upload     chan error
+}
+
+// add writes the file with the given name and information, read from the
+// given path, to the current archive, starting a new one when it's full.
+func (w *bundleWriter) add(name string, info os.FileInfo, file string) error {
+	if w.archive != nil && w.size >= bundlePartSize {
+		if err := w.close(); err != nil {
+			return err
+		}
+	}
+	if w.archive == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := w.archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	reader, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	written, err := io.Copy(w.archive, reader)
+	w.size += written
+	return err
+}
+
+// open starts a new archive, uploading it as it's written.
+func (w *bundleWriter) open() error {
+	reader, writer := io.Pipe()
+	compressor, err := zstd.NewWriter(writer)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("part-%05d%s", w.part, bundleSuffix)
+	w.upload = make(chan error, 1)
+	go func() {
+		_, err := operations.Rcat(w.ctx, w.remote, name, reader, time.Now())
+		// Unblock the writer if the upload failed.
+		reader.CloseWithError(err)
+		w.upload <- err
+	}()
+
+	w.part++
+	w.size = 0
+	w.pipe = writer
+	w.compressor = compressor
+	w.archive = tar.NewWriter(compressor)
+	return nil
+}
+
+// close finishes the current archive and waits for its upload.
+func (w *bundleWriter) close() error {
+	if w.archive == nil {
+		return nil
+	}
+	if err := w.archive.Close(); err != nil {
+		w.abort(err)
+		return err
+	}
+	if err := w.compressor.Close(); err != nil {
+		w.abort(err)
+		return err
+	}
+	w.pipe.Close()
+	err := <-w.upload
+	w.archive = nil
+	return err
+}
+
+// abort discards the current archive, so its upload fails instead of storing
+// a truncated one.
+func (w *bundleWriter) abort(err error) {
+	if w.archive == nil {
+		return
+	}
+	w.pipe.CloseWithError(err)
+	<-w.upload
+	w.archive = nil
+}
+
+// unbundle unpacks the given archive into directory.
+func unbundle(ctx context.Context, part fs.Object, directory string) error {
+	reader, err := part.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	decompressor, err := zstd.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer decompressor.Close()
+
+	archive := tar.NewReader(decompressor)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target, err := bundleTarget(directory, header.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		// Files replace symbolic links instead of being written through them.
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, header.FileInfo().Mode().Perm()|0700); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeSymlink:
+			os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeLink:
+			os.Remove(target)
+			source, err := bundleTarget(directory, header.Linkname)
+			if err != nil {
+				return err
+			}
+			if err := os.Link(source, target); err != nil {
+				return err
+			}
+			continue
+		case tar.TypeReg:
+		default:
+			continue
+		}
+
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, archive); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+// bundleTarget returns the path of the archive entry with the given name in
+// directory. Rooting names before joining them keeps them inside directory,
+// and entries under symbolic links, which could point anywhere, are rejected.
+func bundleTarget(directory, name string) (string, error) {
+	name = path.Clean("/" + name)
+	parent := directory
+	for _, element := range strings.Split(path.Dir(name), "/")[1:] {
+		if element == "" {
+			continue
+		}
+		parent = filepath.Join(parent, element)
+		info, err := os.Lstat(parent)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("entry %s is under a symbolic link", name[1:])
+		}
+	}
+	return filepath.Join(directory, filepath.FromSlash(name)), nil
+}
@@ -0,0 +1,119 @@
+package machine_test
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+func TestBundle(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+
+	source := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(source, "output", "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "output", "nested", "result"), []byte("result"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "output", "run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "output", "ignored.tmp"), []byte("ignored"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(source, "input"), []byte("input"), 0644))
+	require.NoError(t, machine.PushBundle(ctx, source, remote, []string{"output/*.tmp"}))
+
+	// Machines upload their working directory with the same archive format.
+	require.NoError(t, os.Rename(filepath.Join(remote, "bundle", "input"), filepath.Join(remote, "bundle", "output")))
+
+	// Archives keep file modes, like the ones of scripts.
+	staging := t.TempDir()
+	require.NoError(t, machine.PullBundle(ctx, remote, staging))
+	info, err := os.Stat(filepath.Join(staging, "data", "output", "run.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	destination := t.TempDir()
+	require.NoError(t, machine.Pull(ctx, remote, common.Environment{
+		Directory:    destination,
+		DirectoryOut: "output",
+		Transfer:     common.Transfer{Bundle: true, Transfers: 2, BandwidthLimit: "10M"},
+	}))
+
+	contents, err := os.ReadFile(filepath.Join(destination, "output", "nested", "result"))
+	require.NoError(t, err)
+	require.Equal(t, "result", string(contents))
+
+	require.NoFileExists(t, filepath.Join(destination, "output", "ignored.tmp"))
+	require.NoFileExists(t, filepath.Join(destination, "input"))
+
+	// Tasks whose machines haven't uploaded anything yet have nothing to pull.
+	require.NoError(t, machine.PullBundle(ctx, t.TempDir(), t.TempDir()))
+}
+
+// writeBundle writes an archive with the given entries, where symbolic links
+// have a Linkname, to the bundle output directory of remote.
+func writeBundle(t *testing.T, remote string, entries []tar.Header, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(remote, "bundle", "output"), 0755))
+	file, err := os.Create(filepath.Join(remote, "bundle", "output", "part-00000.tar.zst"))
+	require.NoError(t, err)
+	defer file.Close()
+
+	compressor, err := zstd.NewWriter(file)
+	require.NoError(t, err)
+	archive := tar.NewWriter(compressor)
+	for _, header := range entries {
+		header := header
+		header.Mode = 0644
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(contents))
+		}
+		require.NoError(t, archive.WriteHeader(&header))
+		if header.Typeflag == tar.TypeReg {
+			_, err := archive.Write([]byte(contents))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, archive.Close())
+	require.NoError(t, compressor.Close())
+}
+
+func TestBundleSymlinks(t *testing.T) {
+	ctx := context.Background()
+	outside := t.TempDir()
+
+	// Entries under symbolic links are rejected, wherever the links point.
+	remote := t.TempDir()
+	writeBundle(t, remote, []tar.Header{
+		{Name: "escape", Typeflag: tar.TypeSymlink, Linkname: outside},
+		{Name: "escape/file", Typeflag: tar.TypeReg},
+	}, "escaped")
+	require.ErrorContains(t, machine.PullBundle(ctx, remote, t.TempDir()), "entry escape/file is under a symbolic link")
+	require.NoFileExists(t, filepath.Join(outside, "file"))
+
+	// Files replace symbolic links instead of being written through them.
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "target"), []byte("original"), 0644))
+	remote = t.TempDir()
+	writeBundle(t, remote, []tar.Header{
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: filepath.Join(outside, "target")},
+		{Name: "link", Typeflag: tar.TypeReg},
+	}, "replaced")
+	staging := t.TempDir()
+	require.NoError(t, machine.PullBundle(ctx, remote, staging))
+
+	contents, err := os.ReadFile(filepath.Join(outside, "target"))
+	require.NoError(t, err)
+	require.Equal(t, "original", string(contents))
+	contents, err = os.ReadFile(filepath.Join(staging, "data", "link"))
+	require.NoError(t, err)
+	require.Equal(t, "replaced", string(contents))
+}
+
+func TestValidateTransfer(t *testing.T) {
+	require.NoError(t, machine.ValidateTransfer(common.Transfer{Transfers: 8, BandwidthLimit: "10M:1M"}))
+	require.Error(t, machine.ValidateTransfer(common.Transfer{BandwidthLimit: "fast"}))
+	require.Error(t, machine.ValidateTransfer(common.Transfer{Checkers: -1}))
+}
@@ -0,0 +1,63 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// eventsFile is the path of the events recorded by the tool itself in the task
+// storage, like moving the task to another region; machines write reports instead.
+const eventsFile = "events.json"
+
+// WriteEvents records the given events in the task storage in remote,
+// replacing the previous ones.
+func WriteEvents(ctx context.Context, remote string, events []common.Event) error {
+	contents, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	_, err = operations.Rcat(ctx, remoteFileSystem, eventsFile, io.NopCloser(bytes.NewReader(contents)), time.Now())
+	return err
+}
+
+// ReadEvents returns the events recorded in the task storage in remote, if any.
+func ReadEvents(ctx context.Context, remote string) ([]common.Event, error) {
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := remoteFileSystem.NewObject(ctx, eventsFile)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	reader, err := object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var events []common.Event
+	if err := json.NewDecoder(reader).Decode(&events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
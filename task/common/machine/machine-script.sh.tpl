@@ -1,6 +1,6 @@
 #!/bin/bash
-sudo mkdir --parents /opt/task/directory
-chmod u=rwx,g=rwx,o=rwx /opt/task/directory
+sudo mkdir --parents /opt/task/directory /opt/task/checkpoint
+chmod u=rwx,g=rwx,o=rwx /opt/task/directory /opt/task/checkpoint
 
 base64 --decode << END | sudo tee /usr/bin/tpi-task > /dev/null
 {{.TaskScript}}
@@ -15,6 +15,20 @@ source /opt/task/credentials
 END
 chmod u=rwx,g=rx,o=rx /usr/bin/tpi-task-shutdown
 
+sudo tee /usr/bin/tpi-task-budget << 'END'
+#!/bin/bash
+source /opt/task/credentials
+TPI_TASK_SPEND="$(RCLONE_CONFIG= rclone cat "$RCLONE_REMOTE/reports" --include "cost-*" | awk '{spend += $1} END {printf "%f", spend}')"
+if awk -v spend="$TPI_TASK_SPEND" -v limit="$TPI_MAX_COST" 'BEGIN {exit !(spend > limit)}'; then
+  TPI_BUDGET_MESSAGE="Spend of \$$TPI_TASK_SPEND exceeded the maximum cost of \$$TPI_MAX_COST"
+  echo "budget-exceeded: $TPI_BUDGET_MESSAGE"
+  # The report records the event for readers, since the machines are gone by then.
+  printf '%s %s\n' "$(date --utc +%Y-%m-%dT%H:%M:%SZ)" "$TPI_BUDGET_MESSAGE" | RCLONE_CONFIG= rclone rcat "$RCLONE_REMOTE/reports/budget-$1"
+  leo stop --cloud="$TPI_TASK_CLOUD_PROVIDER" --region="$TPI_TASK_CLOUD_REGION" "$TPI_TASK_IDENTIFIER"
+fi
+END
+chmod u=rwx,g=rx,o=rx /usr/bin/tpi-task-budget
+
 sudo tee /usr/bin/tpi-task-studio-log << 'END'
 #!/bin/bash
 URL="${DVC_STUDIO_URL:-https://studio.iterative.ai}"
@@ -50,6 +64,88 @@ fi
 END
 chmod u=rwx,g=rx,o=rx /usr/bin/tpi-task-studio-log
 
+sudo tee /usr/bin/tpi-task-queue << 'END'
+#!/bin/bash
+# Runs the task script once for every work item claimed from the queue, until every item is done or failed.
+# Items whose script fails go back to the queue, recorded through retried-<item>-<attempt> reports, until they run out of retries.
+# Machines lease their current item through a marker renewed every minute; items of machines that stopped renewing them go back to the queue.
+source /opt/task/credentials
+TPI_QUEUE_DIRECTORY="$(mktemp --directory)"
+TPI_QUEUE_LEASE_TIMEOUT=300
+rclone copyto "$RCLONE_REMOTE/queue/items" "$TPI_QUEUE_DIRECTORY/items" || exit 1
+TPI_QUEUE_SIZE="$(wc -l < "$TPI_QUEUE_DIRECTORY/items")"
+TPI_QUEUE_FAILURES=0
+
+tpi_queue_leased(){
+  rclone cat "$RCLONE_REMOTE/reports" --include "lease-*" 2> /dev/null |
+    awk -v now="$(date +%s)" -v timeout="$TPI_QUEUE_LEASE_TIMEOUT" -v identity="$TPI_MACHINE_IDENTITY" '$2 != identity && now - $3 < timeout {print $1}'
+}
+
+tpi_queue_lease(){
+  echo "$1 $TPI_MACHINE_IDENTITY $(date +%s)" > "$TPI_QUEUE_DIRECTORY/lease-$TPI_MACHINE_IDENTITY"
+  rclone copy "$TPI_QUEUE_DIRECTORY" "$RCLONE_REMOTE/reports" --include "lease-$TPI_MACHINE_IDENTITY"
+}
+
+tpi_queue_release(){
+  rm --force "$TPI_QUEUE_DIRECTORY/lease-$TPI_MACHINE_IDENTITY"
+  rclone deletefile "$RCLONE_REMOTE/reports/lease-$TPI_MACHINE_IDENTITY" 2> /dev/null
+}
+
+# Prints the first item that isn't finished or leased, starting at a different offset on every machine so they rarely compete.
+tpi_queue_next(){
+  { rclone lsf "$RCLONE_REMOTE/reports" --files-only --include "done-*" --include "failed-*" 2> /dev/null | cut --delimiter=- --fields=2; tpi_queue_leased; } |
+    awk -v size="$TPI_QUEUE_SIZE" -v offset="$((${TPI_TASK_INDEX:-0} * TPI_QUEUE_SIZE / ${TPI_TASK_COUNT:-1}))" \
+      '{taken[$1]} END {for (step = 0; step < size; step++) {item = (offset + step) % size + 1; if (!(item in taken)) {print item; exit}}}'
+}
+
+while sleep 60; do
+  read -r TPI_WORK_ITEM_NUMBER _ 2> /dev/null < "$TPI_QUEUE_DIRECTORY/lease-$TPI_MACHINE_IDENTITY" && tpi_queue_lease "$TPI_WORK_ITEM_NUMBER"
+done &
+TPI_QUEUE_RENEWAL_PID=$!
+
+while true; do
+  TPI_WORK_ITEM_NUMBER="$(tpi_queue_next)"
+  if test -z "$TPI_WORK_ITEM_NUMBER"; then
+    # Wait for the items leased by other machines, in case they go back to the queue.
+    test -z "$(tpi_queue_leased)" && break
+    sleep 30
+    continue
+  fi
+
+  tpi_queue_lease "$TPI_WORK_ITEM_NUMBER"
+  # Machines claiming the same item at once see each other's lease, and back off.
+  if tpi_queue_leased | grep --quiet --line-regexp "$TPI_WORK_ITEM_NUMBER"; then
+    tpi_queue_release
+    sleep $((RANDOM % 10 + 1))
+    continue
+  fi
+
+  export TPI_WORK_ITEM="$(sed --quiet "${TPI_WORK_ITEM_NUMBER}p" "$TPI_QUEUE_DIRECTORY/items")"
+  echo "Running work item $TPI_WORK_ITEM_NUMBER of $TPI_QUEUE_SIZE: $TPI_WORK_ITEM"
+  /usr/bin/tpi-task
+  TPI_WORK_ITEM_CODE=$?
+
+  TPI_WORK_ITEM_REPORT="done-$TPI_WORK_ITEM_NUMBER"
+  if test "$TPI_WORK_ITEM_CODE" != 0; then
+    TPI_WORK_ITEM_RETRIES="$(rclone lsf "$RCLONE_REMOTE/reports" --files-only --include "retried-$TPI_WORK_ITEM_NUMBER-*" 2> /dev/null | wc -l)"
+    if (( TPI_WORK_ITEM_RETRIES < ${TPI_QUEUE_RETRIES:-0} )); then
+      TPI_WORK_ITEM_REPORT="retried-$TPI_WORK_ITEM_NUMBER-$((TPI_WORK_ITEM_RETRIES + 1))"
+    else
+      TPI_WORK_ITEM_REPORT="failed-$TPI_WORK_ITEM_NUMBER"
+      TPI_QUEUE_FAILURES=$((TPI_QUEUE_FAILURES + 1))
+    fi
+  fi
+  echo "$TPI_MACHINE_IDENTITY $TPI_WORK_ITEM_CODE" > "$TPI_QUEUE_DIRECTORY/$TPI_WORK_ITEM_REPORT"
+  rclone copy "$TPI_QUEUE_DIRECTORY" "$RCLONE_REMOTE/reports" --include "$TPI_WORK_ITEM_REPORT"
+  tpi_queue_release
+done
+
+kill "$TPI_QUEUE_RENEWAL_PID"
+tpi_queue_release
+test "$TPI_QUEUE_FAILURES" = 0
+END
+chmod u=rwx,g=rx,o=rx /usr/bin/tpi-task-queue
+
 base64 --decode << END | sudo tee /opt/task/variables > /dev/null
 {{.Environment}}
 END
@@ -64,11 +160,14 @@ while IFS= read -rd $'\0' variable; do
   export "$(perl -0777p -e 's/\\"/"/g;' -e 's/(.+?)="(.+)"/$1=$2/sg' <<< "$variable")"
 done < <(perl -0777pe 's/\n*(.+?=".*?((?<!\\)"|\\\\"))\n*/$1\x00/sg' /opt/task/variables)
 
-TPI_MACHINE_IDENTITY="$(uuidgen)"
 TPI_LOG_DIRECTORY="$(mktemp --directory)"
 TPI_DATA_DIRECTORY="/opt/task/directory"
+TPI_CHECKPOINT_DIRECTORY="/opt/task/checkpoint"
 
 TPI_START_COMMAND="/bin/bash -lc 'exec /usr/bin/tpi-task'"
+if test -n "$TPI_WORK_QUEUE"; then
+  TPI_START_COMMAND="/bin/bash -lc 'exec /usr/bin/tpi-task-queue'"
+fi
 TPI_REMAINING_RUN_TIME=$(({{.Timeout}}-$(date +%s)))
 if (( TPI_REMAINING_RUN_TIME < 1 )); then
   TPI_START_COMMAND="/bin/bash -c 'sleep infinity'"
@@ -77,28 +176,55 @@ fi
 
 source /opt/task/credentials
 
+# Use the cloud machine identifier as identity, so status reports can be matched with machines.
+case "$TPI_TASK_CLOUD_PROVIDER" in
+aws)
+  TPI_METADATA_TOKEN="$(curl --silent --fail --max-time 5 --request PUT --header "X-aws-ec2-metadata-token-ttl-seconds: 60" http://169.254.169.254/latest/api/token)"
+  TPI_MACHINE_IDENTITY="$(curl --silent --fail --max-time 5 --header "X-aws-ec2-metadata-token: $TPI_METADATA_TOKEN" http://169.254.169.254/latest/meta-data/instance-id)"
+  ;;
+gcp)
+  TPI_MACHINE_IDENTITY="$(curl --silent --fail --max-time 5 --header "Metadata-Flavor: Google" http://metadata.google.internal/computeMetadata/v1/instance/name)"
+  ;;
+az)
+  TPI_MACHINE_IDENTITY="$(curl --silent --fail --max-time 5 --header "Metadata: true" "http://169.254.169.254/metadata/instance/compute/name?api-version=2021-02-01&format=text")"
+  ;;
+esac
+test -n "$TPI_MACHINE_IDENTITY" || TPI_MACHINE_IDENTITY="$(uuidgen)"
+
 sudo tee /etc/systemd/system/tpi-task.service > /dev/null <<END
 [Unit]
   After=default.target
 [Service]
   Type=simple
   ExecStart=-$TPI_START_COMMAND
-  ExecStop=/bin/bash -c 'source /opt/task/credentials; /usr/bin/tpi-task-studio-log && systemctl is-system-running | grep stopping || echo "{\\\\"result\\\\": \\\\"\$SERVICE_RESULT\\\\", \\\\"code\\\\": \\\\"\$EXIT_STATUS\\\\", \\\\"status\\\\": \\\\"\$EXIT_CODE\\\\"}" > "$TPI_LOG_DIRECTORY/status-$TPI_MACHINE_IDENTITY" && RCLONE_CONFIG= rclone copy "$TPI_LOG_DIRECTORY" "\$RCLONE_REMOTE/reports"'
+  ExecStop=/bin/bash -c 'source /opt/task/credentials; test -x /usr/bin/tpi-task-sync && /usr/bin/tpi-task-sync; /usr/bin/tpi-task-studio-log && systemctl is-system-running | grep stopping || echo "{\\\\"result\\\\": \\\\"\$SERVICE_RESULT\\\\", \\\\"code\\\\": \\\\"\$EXIT_STATUS\\\\", \\\\"status\\\\": \\\\"\$EXIT_CODE\\\\"}" > "$TPI_LOG_DIRECTORY/status-$TPI_MACHINE_IDENTITY" && RCLONE_CONFIG= rclone copy "$TPI_LOG_DIRECTORY" "\$RCLONE_REMOTE/reports"'
   ExecStopPost=/usr/bin/tpi-task-shutdown
   Environment=HOME=/root
   EnvironmentFile=/opt/task/variables
+  EnvironmentFile=-/opt/task/checkpoint-variables
+  EnvironmentFile=-/opt/task/machine-variables
   WorkingDirectory=/opt/task/directory
   RuntimeMaxSec=$TPI_REMAINING_RUN_TIME
+  TimeoutStopSec=infinity
 [Install]
   WantedBy=default.target
 END
 
-curl --location --remote-name https://github.com/iterative/terraform-provider-iterative/releases/latest/download/leo_linux_amd64
+case "$(uname -m)" in
+  aarch64|arm64) TPI_MACHINE_ARCHITECTURE=arm64;;
+  *) TPI_MACHINE_ARCHITECTURE=amd64;;
+esac
+
+curl --location --remote-name "https://github.com/iterative/terraform-provider-iterative/releases/latest/download/leo_linux_$TPI_MACHINE_ARCHITECTURE"
 sudo mv leo* /usr/bin/leo
 sudo chmod u=rwx,g=rx,o=rx /usr/bin/leo
 sudo chown root:root /usr/bin/leo
 
-curl --location --remote-name https://github.com/iterative/cml/releases/latest/download/cml-linux
+TPI_CML_BINARY=cml-linux
+if test "$TPI_MACHINE_ARCHITECTURE" = arm64; then
+  TPI_CML_BINARY=cml-linux-arm64
+fi
+curl --location --output cml-linux "https://github.com/iterative/cml/releases/latest/download/$TPI_CML_BINARY"
 chmod u=rwx,g=rx,o=rx cml-linux
 sudo mv cml-linux /usr/bin/cml
 
@@ -113,15 +239,160 @@ extract_here(){
 }
 
 if ! command -v rclone 2>&1 > /dev/null; then
-  curl --remote-name https://downloads.rclone.org/rclone-current-linux-amd64.zip
-  extract_here rclone-current-linux-amd64.zip
-  sudo cp rclone-*-linux-amd64/rclone /usr/bin
+  curl --remote-name "https://downloads.rclone.org/rclone-current-linux-$TPI_MACHINE_ARCHITECTURE.zip"
+  extract_here "rclone-current-linux-$TPI_MACHINE_ARCHITECTURE.zip"
+  sudo cp rclone-*-linux-"$TPI_MACHINE_ARCHITECTURE"/rclone /usr/bin
   sudo chmod u=rwx,g=rx,o=rx /usr/bin/rclone
   sudo chown root:root /usr/bin/rclone
-  rm --recursive rclone-*-linux-amd64*
+  rm --recursive rclone-*-linux-"$TPI_MACHINE_ARCHITECTURE"*
+fi
+
+# Machines with an output directory of their own don't copy the ones of other machines.
+TPI_DATA_EXCLUDE=()
+test -n "$TPI_PER_MACHINE_OUTPUT" && TPI_DATA_EXCLUDE=(--exclude "/machines/**")
+rclone copy "$RCLONE_REMOTE/data" /opt/task/directory "${TPI_DATA_EXCLUDE[@]}"
+
+# Bundled tasks transfer their working directory as compressed archives, which is much faster than many small files.
+tpi_unbundle(){
+  rclone lsf --files-only "$1" 2> /dev/null | grep '\.tar\.zst$' | while read -r part; do
+    rclone cat "$1/$part" | zstd --decompress --stdout | tar --extract --directory "$2"
+  done
+}
+# Machines split their working directory into archives of about 256 MiB of files, like the ones uploaded on creation,
+# and only delete the archives left from the previous bundle after uploading the new ones.
+tpi_bundle(){
+  local lists list entry part=0 size=0
+  lists="$(mktemp --directory)"
+  while IFS= read -r -d '' entry; do
+    if (( size >= 268435456 )); then
+      part=$((part + 1))
+      size=0
+    fi
+    printf '%s\0' "${entry#* }" >> "$lists/$(printf 'part-%05d' "$part")"
+    size=$((size + ${entry%% *}))
+  done < <(find "$1" -mindepth 1 -printf '%s %P\0')
+  for list in "$lists"/part-*; do
+    test -f "$list" || continue
+    tar --create --directory "$1" --no-recursion --null --files-from "$list" | zstd --stdout --quiet | rclone rcat "$2/${list##*/}.tar.zst"
+  done
+  rclone lsf --files-only "$2" 2> /dev/null | grep '\.tar\.zst$' | while read -r part; do
+    test -f "$lists/${part%.tar.zst}" || rclone deletefile "$2/$part"
+  done
+  rm --recursive --force "$lists"
+}
+if test -n "$TPI_BUNDLE"; then
+  command -v zstd > /dev/null || { sudo apt-get -o DPkg::Lock::Timeout=300 update && sudo apt-get -o DPkg::Lock::Timeout=300 install --yes zstd; } || sudo yum install --assumeyes zstd
+  tpi_unbundle "$RCLONE_REMOTE/bundle/input" /opt/task/directory
+fi
+
+# Pipeline stages copy the outputs of the stages they need straight from their storage, after the working directory, so they take precedence.
+# Stages that can't copy them fail without running the task script.
+base64 --decode << END | sudo tee /opt/task/inputs > /dev/null
+{{.Inputs}}
+END
+chmod u=rw,g=,o= /opt/task/inputs
+
+tpi_input(){
+  rclone copy "$1" "$TPI_DATA_DIRECTORY/$2" || TPI_INPUTS_FAILED="$2"
+}
+source /opt/task/inputs
+if test -n "$TPI_INPUTS_FAILED"; then
+  sudo mkdir --parents /etc/systemd/system/tpi-task.service.d
+  sudo tee /etc/systemd/system/tpi-task.service.d/inputs.conf > /dev/null <<END
+[Service]
+  ExecStart=
+  ExecStart=-/bin/bash -c 'echo "Failed to copy input $TPI_INPUTS_FAILED" >&2; exit 1'
+END
+fi
+
+# Machines recreated with the same identity keep counting their preemptions, but start with a clean status.
+rclone copy "$RCLONE_REMOTE/reports" "$TPI_LOG_DIRECTORY" --include "preempted-$TPI_MACHINE_IDENTITY"
+rclone deletefile "$RCLONE_REMOTE/reports/status-$TPI_MACHINE_IDENTITY" 2> /dev/null
+
+# Every machine leases a unique index below TPI_TASK_COUNT through a marker in the task storage, renewed while it runs.
+# Machines recreated with the same identity keep their index, and replacements take over the ones that stopped being renewed.
+TPI_TASK_COUNT="${TPI_TASK_COUNT:-1}"
+TPI_TASK_INDEX_LEASE_TIMEOUT=300
+
+tpi_task_index_leases(){
+  rclone cat "$RCLONE_REMOTE/reports" --include "index-*" 2> /dev/null |
+    awk -v now="$(date +%s)" -v timeout="$TPI_TASK_INDEX_LEASE_TIMEOUT" -v identity="$TPI_MACHINE_IDENTITY" '$2 == identity || now - $3 < timeout {print $1, $2}'
+}
+
+tpi_task_index_renew(){
+  echo "$1 $TPI_MACHINE_IDENTITY $(date +%s)" > "$TPI_LOG_DIRECTORY/index-$TPI_MACHINE_IDENTITY"
+  rclone copy "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports" --include "index-$TPI_MACHINE_IDENTITY"
+}
+
+TPI_TASK_INDEX="$(tpi_task_index_leases | awk -v identity="$TPI_MACHINE_IDENTITY" -v count="$TPI_TASK_COUNT" '$2 == identity && $1 < count {print $1; exit}')"
+while test -z "$TPI_TASK_INDEX"; do
+  for TPI_TASK_INDEX_CANDIDATE in $(seq 0 $((TPI_TASK_COUNT - 1))); do
+    tpi_task_index_leases | grep --quiet "^$TPI_TASK_INDEX_CANDIDATE " && continue
+    tpi_task_index_renew "$TPI_TASK_INDEX_CANDIDATE"
+    # Machines claiming the same index at once see each other's lease, and back off.
+    if test "$(tpi_task_index_leases | grep --count "^$TPI_TASK_INDEX_CANDIDATE ")" = 1; then
+      TPI_TASK_INDEX="$TPI_TASK_INDEX_CANDIDATE"
+      break
+    fi
+    rclone deletefile "$RCLONE_REMOTE/reports/index-$TPI_MACHINE_IDENTITY"
+  done
+  test -n "$TPI_TASK_INDEX" || sleep $((RANDOM % 30 + 5))
+done
+tpi_task_index_renew "$TPI_TASK_INDEX"
+sudo tee /opt/task/machine-variables > /dev/null <<END
+TPI_MACHINE_IDENTITY=$TPI_MACHINE_IDENTITY
+TPI_TASK_INDEX=$TPI_TASK_INDEX
+TPI_TASK_COUNT=$TPI_TASK_COUNT
+END
+
+# Machines that find a checkpoint left by the previous holder of their task index resume from it.
+# Every resume is recorded under the task index, so the count survives respawns.
+TPI_CHECKPOINT_REMOTE="$RCLONE_REMOTE/checkpoint/$TPI_TASK_INDEX"
+TPI_RESUMED=false
+TPI_RESUME_COUNT=0
+if test -n "$(rclone lsf --recursive --files-only "$TPI_CHECKPOINT_REMOTE" 2> /dev/null | head -1)"; then
+  rclone copy "$TPI_CHECKPOINT_REMOTE" "$TPI_CHECKPOINT_DIRECTORY"
+  rclone copy "$RCLONE_REMOTE/reports" "$TPI_LOG_DIRECTORY" --include "resumed-$TPI_TASK_INDEX"
+  date --utc +%Y-%m-%dT%H:%M:%SZ >> "$TPI_LOG_DIRECTORY/resumed-$TPI_TASK_INDEX"
+  rclone copy "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports" --include "resumed-$TPI_TASK_INDEX"
+  TPI_RESUMED=true
+  TPI_RESUME_COUNT="$(grep --count . "$TPI_LOG_DIRECTORY/resumed-$TPI_TASK_INDEX")"
+fi
+sudo tee /opt/task/checkpoint-variables > /dev/null <<END
+TPI_CHECKPOINT_DIR=$TPI_CHECKPOINT_DIRECTORY
+TPI_RESUMED=$TPI_RESUMED
+TPI_RESUME_COUNT=$TPI_RESUME_COUNT
+END
+
+# Machines with an output directory of their own sync to it, after picking up the outputs of the machine they replace.
+TPI_DATA_REMOTE="$RCLONE_REMOTE/data"
+TPI_BUNDLE_REMOTE="$RCLONE_REMOTE/bundle/output"
+if test -n "$TPI_PER_MACHINE_OUTPUT"; then
+  TPI_DATA_REMOTE="$RCLONE_REMOTE/data/machines/$TPI_TASK_INDEX"
+  TPI_BUNDLE_REMOTE="$RCLONE_REMOTE/bundle/output/machines/$TPI_TASK_INDEX"
+  rclone copy "$TPI_DATA_REMOTE" "$TPI_DATA_DIRECTORY"
+fi
+test -n "$TPI_BUNDLE" && tpi_unbundle "$TPI_BUNDLE_REMOTE" "$TPI_DATA_DIRECTORY"
+
+# Bundles pack the whole working directory, so bundled tasks don't upload it whenever it changes, but only when the task script finishes,
+# before reporting its status, and when the machine is preempted.
+if test -n "$TPI_BUNDLE" && ! test -v TPI_DISABLE_DATA_DIRECTORY_SYNCHRONIZATION; then
+  sudo tee /usr/bin/tpi-task-sync > /dev/null <<END
+#!/bin/bash
+source /opt/task/credentials
+$(declare -f tpi_bundle)
+tpi_bundle "$TPI_DATA_DIRECTORY" "$TPI_BUNDLE_REMOTE"
+END
+  sudo chmod u=rwx,g=rx,o=rx /usr/bin/tpi-task-sync
 fi
 
-rclone copy "$RCLONE_REMOTE/data" /opt/task/directory
+tpi_sync_data(){
+  if test -n "$TPI_BUNDLE"; then
+    tpi_bundle "$TPI_DATA_DIRECTORY" "$TPI_BUNDLE_REMOTE"
+  else
+    rclone sync "$TPI_DATA_DIRECTORY" "$TPI_DATA_REMOTE"
+  fi
+}
 
 yes | /etc/profile.d/install-driver-prompt.sh # for GCP GPU machines
 
@@ -148,14 +419,68 @@ while sleep 5; do
   NEW_TPI_LOG_DIRECTORY_HASH="$(md5sum "$TPI_LOG_DIRECTORY"/*)"
   if test "$NEW_TPI_LOG_DIRECTORY_HASH" != "$TPI_LOG_DIRECTORY_HASH"; then
     TPI_LOG_DIRECTORY_HASH="$NEW_TPI_LOG_DIRECTORY_HASH"
-    rclone sync "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports"
+    rclone copy "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports"
   fi
 done &
 
-while ! test -v TPI_DISABLE_DATA_DIRECTORY_SYNCHRONIZATION && sleep 10; do
+# Every machine reports its own spend, so any of them can stop the task when the total exceeds the maximum cost.
+# The spend carries over from the previous report, so it survives reboots and machines recreated with the same identity.
+TPI_MACHINE_SPEND="$(rclone cat "$RCLONE_REMOTE/reports/cost-$TPI_MACHINE_IDENTITY" 2> /dev/null)"
+TPI_MACHINE_START="$(date +%s)"
+while test -n "$TPI_MAX_COST" && sleep 60; do
+  awk -v spend="${TPI_MACHINE_SPEND:-0}" -v elapsed="$(($(date +%s) - TPI_MACHINE_START))" -v cost="$TPI_MACHINE_COST" \
+    'BEGIN {printf "%f\n", spend + elapsed / 3600 * cost}' > "$TPI_LOG_DIRECTORY/cost-$TPI_MACHINE_IDENTITY"
+  rclone copy "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports" --include "cost-*"
+  /usr/bin/tpi-task-budget "$TPI_MACHINE_IDENTITY"
+done &
+
+while ! test -v TPI_DISABLE_DATA_DIRECTORY_SYNCHRONIZATION && test -z "$TPI_BUNDLE" && sleep 10; do
   NEW_TPI_DATA_DIRECTORY_EPOCH="$(find "$TPI_DATA_DIRECTORY" -printf "%T@\n" | sort | tail -1)"
   if test "$NEW_TPI_DATA_DIRECTORY_EPOCH" != "$TPI_DATA_DIRECTORY_EPOCH"; then
     TPI_DATA_DIRECTORY_EPOCH="$NEW_TPI_DATA_DIRECTORY_EPOCH"
-    rclone sync "$TPI_DATA_DIRECTORY" "$RCLONE_REMOTE/data"
+    tpi_sync_data
+  fi
+done &
+
+# Checkpoints are usually smaller and more valuable than the rest of the data, so they're uploaded on their own schedule.
+while sleep "${TPI_CHECKPOINT_INTERVAL:-60}"; do
+  NEW_TPI_CHECKPOINT_DIRECTORY_EPOCH="$(find "$TPI_CHECKPOINT_DIRECTORY" -printf "%T@\n" | sort | tail -1)"
+  if test "$NEW_TPI_CHECKPOINT_DIRECTORY_EPOCH" != "$TPI_CHECKPOINT_DIRECTORY_EPOCH"; then
+    TPI_CHECKPOINT_DIRECTORY_EPOCH="$NEW_TPI_CHECKPOINT_DIRECTORY_EPOCH"
+    rclone copy "$TPI_CHECKPOINT_DIRECTORY" "$TPI_CHECKPOINT_REMOTE"
+  fi
+done &
+
+while sleep 60; do
+  tpi_task_index_renew "$TPI_TASK_INDEX"
+done &
+
+# Spot machines get a short notice before being reclaimed: record it and flush the data and reports while there's time.
+tpi_preemption_notice(){
+  case "$TPI_TASK_CLOUD_PROVIDER" in
+  aws)
+    TPI_METADATA_TOKEN="$(curl --silent --fail --max-time 2 --request PUT --header "X-aws-ec2-metadata-token-ttl-seconds: 60" http://169.254.169.254/latest/api/token)"
+    curl --silent --fail --max-time 2 --header "X-aws-ec2-metadata-token: $TPI_METADATA_TOKEN" http://169.254.169.254/latest/meta-data/spot/instance-action > /dev/null
+    ;;
+  gcp)
+    curl --silent --fail --max-time 2 --header "Metadata-Flavor: Google" http://metadata.google.internal/computeMetadata/v1/instance/preempted | grep --quiet TRUE
+    ;;
+  az)
+    curl --silent --fail --max-time 2 --header "Metadata: true" "http://169.254.169.254/metadata/scheduledevents?api-version=2020-07-01" | grep --quiet '"EventType": *"Preempt"'
+    ;;
+  *)
+    false
+    ;;
+  esac
+}
+
+while sleep 5; do
+  if tpi_preemption_notice; then
+    date --utc +%Y-%m-%dT%H:%M:%SZ >> "$TPI_LOG_DIRECTORY/preempted-$TPI_MACHINE_IDENTITY"
+    echo '{"result": "preempted", "code": "", "status": ""}' > "$TPI_LOG_DIRECTORY/status-$TPI_MACHINE_IDENTITY"
+    rclone copy "$TPI_CHECKPOINT_DIRECTORY" "$TPI_CHECKPOINT_REMOTE"
+    test -v TPI_DISABLE_DATA_DIRECTORY_SYNCHRONIZATION || tpi_sync_data
+    rclone copy "$TPI_LOG_DIRECTORY" "$RCLONE_REMOTE/reports"
+    break
   fi
 done &
@@ -0,0 +1,88 @@
+package machine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// manifestFile is the path of the task manifest in the task storage.
+const manifestFile = "manifest.json"
+
+// WriteManifest writes the task manifest to the given remote.
+func WriteManifest(ctx context.Context, remote string, manifest common.Manifest) error {
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	_, err = operations.Rcat(ctx, remoteFileSystem, manifestFile, io.NopCloser(bytes.NewReader(contents)), time.Now())
+	return err
+}
+
+// ReadManifest reads the task manifest from the given remote, returning
+// common.NotFoundError for tasks created without one.
+func ReadManifest(ctx context.Context, remote string) (*common.Manifest, error) {
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := remoteFileSystem.NewObject(ctx, manifestFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorDirNotFound) {
+			return nil, common.NotFoundError
+		}
+		return nil, err
+	}
+
+	reader, err := object.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return common.ParseManifest(contents)
+}
+
+// CreationTime returns the creation time recorded in the manifest of the given
+// remote, or the zero time for tasks created without one.
+func CreationTime(ctx context.Context, remote string) (time.Time, error) {
+	manifest, err := ReadManifest(ctx, remote)
+	if err == common.NotFoundError {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return manifest.Created, nil
+}
+
+// ApplyManifest fills the unspecified attributes of cloud and task with the
+// ones recorded in the manifest of the given remote, if there is one.
+func ApplyManifest(ctx context.Context, remote string, cloud *common.Cloud, task *common.Task) error {
+	manifest, err := ReadManifest(ctx, remote)
+	if err == common.NotFoundError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	manifest.ApplyDefaults(cloud, task)
+	return nil
+}
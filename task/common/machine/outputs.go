@@ -0,0 +1,139 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/0x2b3bfa0/logrusctx"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// machineOutputs is the directory of the task storage where machines with an
+// output directory of their own sync their working directory, named after
+// their task index.
+const machineOutputs = "data/machines"
+
+// machineObject is a file written by the machine with the given index.
+type machineObject struct {
+	machine string
+	object  fs.Object
+}
+
+// PullMachineOutputs downloads the outputs of every machine from the task
+// storage in remote to destination, combining them with the given policy and
+// skipping the files matched by the given exclusion rules.
+func PullMachineOutputs(ctx context.Context, remote, destination string, policy common.MergePolicy, exclude []string) error {
+	remoteFileSystem, err := fs.NewFs(ctx, remote+"/"+machineOutputs)
+	if err != nil {
+		return err
+	}
+
+	entries, err := remoteFileSystem.List(ctx, "")
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var machines []string
+	for _, entry := range entries {
+		if directory, ok := entry.(fs.Directory); ok {
+			machines = append(machines, path.Base(directory.Remote()))
+		}
+	}
+
+	if policy == common.MergeNone {
+		for _, machine := range machines {
+			logrusctx.Infof(ctx, "Downloading the output of machine %s...", machine)
+			source := remote + "/" + machineOutputs + "/" + machine
+			if err := Transfer(ctx, source, filepath.Join(destination, "machines", machine), exclude); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ctx, err = transferFilter(ctx, exclude)
+	if err != nil {
+		return err
+	}
+
+	files := map[string]machineObject{}
+	for _, machine := range machines {
+		machineFileSystem, err := fs.NewFs(ctx, remote+"/"+machineOutputs+"/"+machine)
+		if err != nil {
+			return err
+		}
+		err = walk.ListR(ctx, machineFileSystem, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				object, ok := entry.(fs.Object)
+				if !ok {
+					continue
+				}
+				current := machineObject{machine: machine, object: object}
+				previous, ok := files[object.Remote()]
+				if !ok {
+					files[object.Remote()] = current
+					continue
+				}
+				switch policy {
+				case common.MergeNewest:
+					if object.ModTime(ctx).After(previous.object.ModTime(ctx)) {
+						files[object.Remote()] = current
+					}
+				case common.MergeStrict:
+					same, err := sameContents(ctx, previous.object, object)
+					if err != nil {
+						return err
+					}
+					if !same {
+						return fmt.Errorf("machines %s and %s wrote different contents to %s", previous.machine, machine, object.Remote())
+					}
+				default:
+					return fmt.Errorf("unknown output merge policy %#v", policy)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	destinationFileSystem, err := fs.NewFs(ctx, destination)
+	if err != nil {
+		return err
+	}
+
+	logrusctx.Infof(ctx, "Merging the outputs of %d machines (%d files)...", len(machines), len(files))
+	defer progress(10 * time.Second)()
+
+	for name, file := range files {
+		if _, err := operations.Copy(ctx, destinationFileSystem, nil, name, file.object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameContents reports whether both objects have the same contents, comparing
+// their hashes when their backends have one in common, or else their sizes.
+func sameContents(ctx context.Context, a, b fs.Object) (bool, error) {
+	if a.Size() != b.Size() {
+		return false, nil
+	}
+	equal, hashType, err := operations.CheckHashes(ctx, a, b)
+	if err != nil {
+		return false, err
+	}
+	return equal || hashType == hash.None, nil
+}
@@ -0,0 +1,59 @@
+package machine_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+func TestPullMachineOutputs(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+
+	write := func(name, contents string, modified time.Time) {
+		file := filepath.Join(remote, "data", "machines", name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		require.NoError(t, os.WriteFile(file, []byte(contents), 0644))
+		require.NoError(t, os.Chtimes(file, modified, modified))
+	}
+	read := func(file string) string {
+		contents, err := os.ReadFile(file)
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	now := time.Now()
+	write("0/output/shared", "same", now)
+	write("0/output/result", "older", now.Add(-time.Hour))
+	write("0/output/first", "first", now)
+	write("1/output/shared", "same", now)
+	write("1/output/result", "newer", now)
+	write("1/input", "input", now)
+
+	destination := t.TempDir()
+	exclude := machine.LimitTransfer("output", nil)
+	require.NoError(t, machine.PullMachineOutputs(ctx, remote, destination, common.MergeNone, exclude))
+	require.Equal(t, "older", read(filepath.Join(destination, "machines", "0", "output", "result")))
+	require.Equal(t, "newer", read(filepath.Join(destination, "machines", "1", "output", "result")))
+	require.NoFileExists(t, filepath.Join(destination, "machines", "1", "input"))
+
+	destination = t.TempDir()
+	require.NoError(t, machine.PullMachineOutputs(ctx, remote, destination, common.MergeNewest, exclude))
+	require.Equal(t, "newer", read(filepath.Join(destination, "output", "result")))
+	require.Equal(t, "first", read(filepath.Join(destination, "output", "first")))
+	require.Equal(t, "same", read(filepath.Join(destination, "output", "shared")))
+	require.NoFileExists(t, filepath.Join(destination, "input"))
+
+	err := machine.PullMachineOutputs(ctx, remote, t.TempDir(), common.MergeStrict, exclude)
+	require.EqualError(t, err, "machines 0 and 1 wrote different contents to output/result")
+
+	// Tasks whose machines haven't synced anything yet have nothing to pull.
+	require.NoError(t, machine.PullMachineOutputs(ctx, t.TempDir(), t.TempDir(), common.MergeNone, nil))
+}
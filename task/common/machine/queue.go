@@ -0,0 +1,146 @@
+package machine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// queueFile is the path of the work item list in the task storage. Machines
+// claim items by their line number, leasing them through lease-<identity>
+// reports, and acknowledge them with done-<line> or failed-<line> reports.
+const queueFile = "queue/items"
+
+// WorkItems returns the work items of the given queue: the non-empty lines of
+// its file, or the paths of the objects under its prefix.
+func WorkItems(ctx context.Context, queue common.Queue) ([]string, error) {
+	var items []string
+	switch {
+	case queue.File != "" && queue.Prefix != "":
+		return nil, errors.New("queue can't have both a file and a prefix")
+	case queue.File != "":
+		file, err := os.Open(queue.File)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if item := strings.TrimSpace(scanner.Text()); item != "" {
+				items = append(items, item)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	case queue.Prefix != "":
+		prefixFileSystem, err := fs.NewFs(ctx, queue.Prefix)
+		if err != nil {
+			return nil, err
+		}
+		err = walk.ListR(ctx, prefixFileSystem, "", false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				items = append(items, entry.Remote())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("queue doesn't have any work items")
+	}
+	return items, nil
+}
+
+// UploadQueue writes the work items of the given queue to the task storage in
+// remote, one per line.
+func UploadQueue(ctx context.Context, remote string, queue common.Queue) error {
+	items, err := WorkItems(ctx, queue)
+	if err != nil {
+		return err
+	}
+
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return err
+	}
+
+	contents := strings.Join(items, "\n") + "\n"
+	_, err = operations.Rcat(ctx, remoteFileSystem, queueFile, io.NopCloser(strings.NewReader(contents)), time.Now())
+	return err
+}
+
+// QueueStatus counts the work items in the task storage in remote by state,
+// returning common.NotFoundError for tasks without a queue. Items being run
+// are counted as pending until they're done or failed.
+func QueueStatus(ctx context.Context, remote string) (common.QueueStatus, error) {
+	var status common.QueueStatus
+
+	remoteFileSystem, err := fs.NewFs(ctx, remote)
+	if err != nil {
+		return status, err
+	}
+
+	object, err := remoteFileSystem.NewObject(ctx, queueFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorDirNotFound) {
+			return status, common.NotFoundError
+		}
+		return status, err
+	}
+
+	reader, err := object.Open(ctx)
+	if err != nil {
+		return status, err
+	}
+	defer reader.Close()
+
+	contents := new(bytes.Buffer)
+	if _, err := io.Copy(contents, reader); err != nil {
+		return status, err
+	}
+	total := strings.Count(contents.String(), "\n")
+
+	entries, err := remoteFileSystem.List(ctx, "reports")
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return status, err
+	}
+	// Items run more than once, after their lease expired, count as done if
+	// any of the runs succeeded.
+	failed := map[string]bool{}
+	for _, entry := range entries {
+		base := path.Base(entry.Remote())
+		if item := strings.TrimPrefix(base, "done-"); item != base {
+			status.Done++
+			failed[item] = false
+		} else if item := strings.TrimPrefix(base, "failed-"); item != base {
+			if _, ok := failed[item]; !ok {
+				failed[item] = true
+			}
+		}
+	}
+	for _, value := range failed {
+		if value {
+			status.Failed++
+		}
+	}
+
+	status.Pending = total - status.Done - status.Failed
+	return status, nil
+}
@@ -0,0 +1,57 @@
+package machine_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+func TestWorkItems(t *testing.T) {
+	ctx := context.Background()
+
+	file := filepath.Join(t.TempDir(), "items.txt")
+	require.NoError(t, os.WriteFile(file, []byte("first\n\nsecond \nthird"), 0644))
+	items, err := machine.WorkItems(ctx, common.Queue{File: file})
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second", "third"}, items)
+
+	items, err = machine.WorkItems(ctx, common.Queue{Prefix: "./testdata/transferTest"})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"a.txt", "main.tf", "temp/a.txt", "temp/b.txt"}, items)
+
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	_, err = machine.WorkItems(ctx, common.Queue{File: file})
+	require.EqualError(t, err, "queue doesn't have any work items")
+}
+
+func TestQueueStatus(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+
+	_, err := machine.QueueStatus(ctx, remote)
+	require.ErrorIs(t, err, common.NotFoundError)
+
+	file := filepath.Join(t.TempDir(), "items.txt")
+	require.NoError(t, os.WriteFile(file, []byte("a\nb\nc\nd\n"), 0644))
+	require.NoError(t, machine.UploadQueue(ctx, remote, common.Queue{File: file}))
+
+	status, err := machine.QueueStatus(ctx, remote)
+	require.NoError(t, err)
+	require.Equal(t, common.QueueStatus{Pending: 4}, status)
+
+	// The second item failed once and succeeded after its lease expired.
+	require.NoError(t, os.MkdirAll(filepath.Join(remote, "reports"), 0755))
+	for _, name := range []string{"done-1", "failed-2", "done-2", "failed-3", "lease-machine"} {
+		require.NoError(t, os.WriteFile(filepath.Join(remote, "reports", name), nil, 0644))
+	}
+
+	status, err = machine.QueueStatus(ctx, remote)
+	require.NoError(t, err)
+	require.Equal(t, common.QueueStatus{Done: 2, Failed: 1, Pending: 1}, status)
+}
@@ -0,0 +1,79 @@
+package machine
+
+import (
+	"context"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// RemoteStorage implements the task operations on the task storage for the
+// providers that keep it in an rclone remote, all of them on top of Storage.
+// Provider tasks embed it to share them.
+type RemoteStorage struct {
+	credentials func() map[string]string
+	environment *common.Environment
+}
+
+// NewRemoteStorage returns the storage operations of a task with the given
+// environment, whose machine credentials hold the connection string of its
+// storage in RCLONE_REMOTE once read.
+func NewRemoteStorage(credentials func() map[string]string, environment *common.Environment) RemoteStorage {
+	return RemoteStorage{credentials: credentials, environment: environment}
+}
+
+// Storage returns the rclone connection string of the task storage, or
+// common.NotFoundError before the task has been created or read.
+func (r RemoteStorage) Storage(ctx context.Context) (string, error) {
+	remote, ok := r.credentials()["RCLONE_REMOTE"]
+	if !ok {
+		return "", common.NotFoundError
+	}
+	return remote, nil
+}
+
+// Push uploads the work directory to the task storage.
+func (r RemoteStorage) Push(ctx context.Context) error {
+	remote, err := r.Storage(ctx)
+	if err != nil {
+		return err
+	}
+	return Push(ctx, remote, *r.environment)
+}
+
+// Pull downloads the output directory from the task storage, or the one of
+// every machine for tasks with per-machine outputs.
+func (r RemoteStorage) Pull(ctx context.Context) error {
+	remote, err := r.Storage(ctx)
+	if err != nil {
+		return err
+	}
+	return Pull(ctx, remote, *r.environment)
+}
+
+// UploadQueue writes the work items of the task to the task storage, where
+// machines claim them from.
+func (r RemoteStorage) UploadQueue(ctx context.Context) error {
+	remote, err := r.Storage(ctx)
+	if err != nil {
+		return err
+	}
+	return UploadQueue(ctx, remote, r.environment.Queue)
+}
+
+// Queue counts the work items of the task by state.
+func (r RemoteStorage) Queue(ctx context.Context) (common.QueueStatus, error) {
+	remote, err := r.Storage(ctx)
+	if err != nil {
+		return common.QueueStatus{}, err
+	}
+	return QueueStatus(ctx, remote)
+}
+
+// Manifest reads the manifest written to the task storage at creation.
+func (r RemoteStorage) Manifest(ctx context.Context) (*common.Manifest, error) {
+	remote, err := r.Storage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ReadManifest(ctx, remote)
+}
@@ -0,0 +1,43 @@
+package machine_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+func TestRemoteStorage(t *testing.T) {
+	ctx := context.Background()
+
+	file := filepath.Join(t.TempDir(), "items.txt")
+	require.NoError(t, os.WriteFile(file, []byte("a\nb\n"), 0644))
+	environment := common.Environment{Queue: common.Queue{File: file}}
+
+	// Tasks that haven't been created or read don't have a storage yet.
+	credentials := map[string]string{}
+	storage := machine.NewRemoteStorage(func() map[string]string { return credentials }, &environment)
+	_, err := storage.Storage(ctx)
+	require.ErrorIs(t, err, common.NotFoundError)
+	_, err = storage.Queue(ctx)
+	require.ErrorIs(t, err, common.NotFoundError)
+	require.ErrorIs(t, storage.UploadQueue(ctx), common.NotFoundError)
+
+	credentials["RCLONE_REMOTE"] = t.TempDir()
+	remote, err := storage.Storage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, credentials["RCLONE_REMOTE"], remote)
+
+	require.NoError(t, storage.UploadQueue(ctx))
+	status, err := storage.Queue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, common.QueueStatus{Pending: 2}, status)
+
+	_, err = storage.Manifest(ctx)
+	require.ErrorIs(t, err, common.NotFoundError)
+}
@@ -19,7 +19,28 @@ var machineScript string
 
 var machineScriptTemplate = template.Must(template.New("machine-script").Parse(machineScript))
 
-func Script(script string, credentials map[string]string, variables common.Variables, timeout *time.Time) (string, error) {
+// Deadline returns the time when the machines of a task created at the given
+// time stop running its script; tasks still being created count from now, so
+// rendering the script again keeps the deadline until the timeout changes.
+func Deadline(created time.Time, timeout time.Duration) time.Time {
+	if created.IsZero() {
+		created = time.Now()
+	}
+	return created.Add(timeout)
+}
+
+// Inputs returns the shell commands that copy the given inputs into the
+// working directory of a machine, as calls to a tpi_input function with the
+// source connection string and the destination.
+func Inputs(inputs []common.Input) string {
+	commands := ""
+	for _, input := range inputs {
+		commands += "tpi_input " + shellescape.Quote(input.Source) + " " + shellescape.Quote(input.Destination) + "\n"
+	}
+	return commands
+}
+
+func Script(script string, credentials map[string]string, variables common.Variables, inputs []common.Input, timeout *time.Time) (string, error) {
 	timeoutString := "infinity"
 	if timeout != nil {
 		timeoutString = fmt.Sprintf("%d", timeout.Unix())
@@ -41,11 +62,13 @@ func Script(script string, credentials map[string]string, variables common.Varia
 		TaskScript  string
 		Environment string
 		Credentials string
+		Inputs      string
 		Timeout     string
 	}{
 		TaskScript:  base64.StdEncoding.EncodeToString([]byte(script)),
 		Environment: base64.StdEncoding.EncodeToString([]byte(environment)),
 		Credentials: base64.StdEncoding.EncodeToString([]byte(exportCredentials)),
+		Inputs:      base64.StdEncoding.EncodeToString([]byte(Inputs(inputs))),
 		Timeout:     timeoutString,
 	}
 
@@ -19,7 +19,7 @@ func TestScript(t *testing.T) {
 #!/bin/sh
 echo "done"
 `[:1]
-	output, err := machine.Script(script, nil, nil, nil)
+	output, err := machine.Script(script, nil, nil, nil, nil)
 	require.NoError(t, err)
 	g.Assert(t, "machine_script_minimal", []byte(output))
 
@@ -31,8 +31,18 @@ echo "done"
 	variables := common.Variables{
 		"KEY": &value,
 	}
+	inputs := []common.Input{{
+		Source:      ":s3,region='us-west-1':bucket/data/output",
+		Destination: "prepare",
+	}}
 	timeout := time.Unix(1659919333, 0)
-	output, err = machine.Script(script, credentials, variables, &timeout)
+	output, err = machine.Script(script, credentials, variables, inputs, &timeout)
 	require.NoError(t, err)
 	g.Assert(t, "machine_script_full", []byte(output))
 }
+
+func TestDeadline(t *testing.T) {
+	created := time.Unix(1659919333, 0)
+	require.Equal(t, created.Add(time.Hour), machine.Deadline(created, time.Hour))
+	require.WithinDuration(t, time.Now().Add(time.Hour), machine.Deadline(time.Time{}, time.Hour), time.Minute)
+}
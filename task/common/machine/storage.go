@@ -10,6 +10,7 @@ import (
 	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -55,7 +56,42 @@ func init() {
 	}
 }
 
+// report is a single file written by a task machine under the reports directory.
+type report struct {
+	// Identity is the machine identity the report belongs to.
+	Identity string
+	Contents string
+	Modified time.Time
+	// Offset is the position of Contents within the file.
+	Offset int64
+}
+
 func Reports(ctx context.Context, remote, prefix string) ([]string, error) {
+	reports, err := readReports(ctx, remote, prefix, reportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []string
+	for _, report := range reports {
+		logs = append(logs, report.Contents)
+	}
+
+	return logs, nil
+}
+
+// reportOptions limits the parts of reports being read.
+type reportOptions struct {
+	// Offsets maps machine identities to the position where reading starts;
+	// unchanged reports are skipped altogether, and reports shorter than
+	// their offset are read again from the beginning.
+	Offsets map[string]int64
+	// Limit is the maximum number of bytes to read from every report.
+	Limit int64
+}
+
+// readReports reads the reports with the given prefix.
+func readReports(ctx context.Context, remote, prefix string, options reportOptions) ([]report, error) {
 	remoteFileSystem, err := fs.NewFs(ctx, remote)
 	if err != nil {
 		return nil, err
@@ -66,76 +102,293 @@ func Reports(ctx context.Context, remote, prefix string) ([]string, error) {
 		return nil, err
 	}
 
-	var logs []string
+	var reports []report
 	for _, entry := range entries {
 		path := entry.Remote()
-		if base := filepath.Base(path); !strings.HasPrefix(base, prefix+"-") {
+		base := filepath.Base(path)
+		if !strings.HasPrefix(base, prefix+"-") {
 			continue
 		}
+		identity := strings.TrimPrefix(base, prefix+"-")
 
-		object, err := remoteFileSystem.NewObject(ctx, path)
-		if err != nil {
-			return nil, err
+		object, ok := entry.(fs.Object)
+		if !ok {
+			continue
+		}
+
+		offset := options.Offsets[identity]
+		if object.Size() == offset && offset > 0 {
+			continue
+		} else if object.Size() < offset {
+			offset = 0
+		}
+
+		var openOptions []fs.OpenOption
+		if options.Limit > 0 {
+			openOptions = append(openOptions, &fs.RangeOption{Start: offset, End: offset + options.Limit - 1})
+		} else if offset > 0 {
+			openOptions = append(openOptions, &fs.SeekOption{Offset: offset})
 		}
-		reader, err := object.Open(ctx)
+		reader, err := object.Open(ctx, openOptions...)
 		if err != nil {
 			return nil, err
 		}
 		buffer := new(bytes.Buffer)
 		if _, err := io.Copy(buffer, reader); err != nil {
+			reader.Close()
 			return nil, err
 		}
-		logs = append(logs, buffer.String())
+		reports = append(reports, report{
+			Identity: identity,
+			Contents: buffer.String(),
+			Modified: object.ModTime(ctx),
+			Offset:   offset,
+		})
 		reader.Close()
 	}
 
-	return logs, nil
+	return reports, nil
 }
 
 func Logs(ctx context.Context, remote string) ([]string, error) {
 	return Reports(ctx, remote, "task")
 }
 
-func Status(ctx context.Context, remote string, initialStatus common.Status) (common.Status, error) {
-	reports, err := Reports(ctx, remote, "status")
+// StreamLogs returns the task log lines written after the given cursor, along
+// with the updated cursor. Only complete lines are returned, and only the new
+// bytes of every log are downloaded.
+func StreamLogs(ctx context.Context, remote string, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	offsets := map[string]int64{}
+	for machine, position := range cursor {
+		offsets[machine] = position.Offset
+	}
+
+	reports, err := readReports(ctx, remote, "task", reportOptions{Offsets: offsets})
 	if err != nil {
-		return initialStatus, err
+		return nil, cursor, err
+	}
+
+	result := cursor.Copy()
+	var lines []common.LogLine
+	for _, report := range reports {
+		// Leave incomplete lines for the next call.
+		end := strings.LastIndex(report.Contents, "\n") + 1
+		for _, line := range strings.SplitAfter(report.Contents[:end], "\n") {
+			if line = strings.TrimSuffix(line, "\n"); line != "" {
+				lines = append(lines, common.ParseLogLine(report.Identity, line))
+			}
+		}
+		result[report.Identity] = common.LogPosition{Offset: report.Offset + int64(end)}
+	}
+
+	return lines, result, nil
+}
+
+// Status combines the machine states known to the cloud provider with the
+// status reports written by machines after running the task script. The
+// machines argument is not modified.
+func Status(ctx context.Context, remote string, machines common.Status) (common.Status, error) {
+	status := append(common.Status{}, machines...)
+
+	reports, err := readReports(ctx, remote, "status", reportOptions{})
+	if err != nil {
+		return status, err
+	}
+
+	// Only the first line of the logs is needed to find out the start time.
+	logs, err := readReports(ctx, remote, "task", reportOptions{Limit: 64})
+	if err != nil {
+		return status, err
+	}
+
+	preemptions, err := readReports(ctx, remote, "preempted", reportOptions{})
+	if err != nil {
+		return status, err
+	}
+
+	// find returns the status of the given machine, adding it if missing.
+	find := func(identity string) *common.MachineStatus {
+		for i, machine := range status {
+			if machine.Machine == identity {
+				return &status[i]
+			}
+		}
+		status = append(status, common.MachineStatus{Machine: identity})
+		return &status[len(status)-1]
 	}
 
 	for _, report := range reports {
 		var statusReport StatusReport
-		if err := json.Unmarshal([]byte(report), &statusReport); err != nil {
-			return initialStatus, err
+		if err := json.Unmarshal([]byte(report.Contents), &statusReport); err != nil {
+			return status, err
 		}
-		if statusReport.Code != "" {
-			if statusReport.Code == "0" {
-				initialStatus[common.StatusCodeSucceeded] += 1
-			} else {
-				initialStatus[common.StatusCodeFailed] += 1
+
+		machine := find(report.Identity)
+		machine.Finished = report.Modified
+		if machine.Started.IsZero() {
+			for _, log := range logs {
+				if log.Identity == report.Identity {
+					machine.Started = firstTimestamp(log.Contents)
+				}
 			}
-		} else if statusReport.Result == "timeout" {
-			initialStatus[common.StatusCodeFailed] += 1
+		}
+
+		machine.Result = statusReport.Result
+		if code, ok := exitCode(statusReport.Code); ok {
+			machine.ExitCode = &code
+		}
+
+		switch {
+		case statusReport.Result == common.ResultPreempted:
+			machine.Phase = common.PhasePreempted
+		case statusReport.Result == "timeout":
+			machine.Phase = common.PhaseTimedOut
+		case statusReport.Code == "0":
+			machine.Phase = common.PhaseSucceeded
+		case statusReport.Code != "":
+			machine.Phase = common.PhaseFailed
 		}
 	}
-	return initialStatus, nil
+
+	for _, report := range preemptions {
+		find(report.Identity).Preemptions = len(preemptionTimes(report.Contents))
+	}
+
+	return status, nil
 }
 
-func Transfer(ctx context.Context, source, destination string, exclude []string) error {
-	ctx, fi := filter.AddConfig(ctx)
+// Preemptions returns an event for every preemption notice received by the
+// task machines, in chronological order.
+func Preemptions(ctx context.Context, remote string) ([]common.Event, error) {
+	reports, err := readReports(ctx, remote, "preempted", reportOptions{})
+	if err != nil {
+		return nil, err
+	}
 
-	rules := append([]string{}, defaultTransferExcludes...)
-	if len(exclude) > 0 {
-		rules = append(rules, exclude...)
+	var events []common.Event
+	for _, report := range reports {
+		for _, timestamp := range preemptionTimes(report.Contents) {
+			events = append(events, common.Event{
+				Time:        timestamp,
+				Code:        common.EventPreempted,
+				Description: []string{report.Identity},
+			})
+		}
 	}
-	for _, filterRule := range rules {
-		if !isRcloneFilter(filterRule) {
-			filterRule = filepath.Join("/", filterRule)
-			filterRule = "- " + filterRule
+
+	sort.SliceStable(events, func(a, b int) bool {
+		return events[a].Time.Before(events[b].Time)
+	})
+	return events, nil
+}
+
+// Costs returns the accumulated cost reported by every task machine, keyed by
+// machine identity. Machines carry their cost over across reboots, and reports
+// outlive the machines that wrote them.
+func Costs(ctx context.Context, remote string) (map[string]float64, error) {
+	reports, err := readReports(ctx, remote, "cost", reportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	costs := map[string]float64{}
+	for _, report := range reports {
+		cost, err := strconv.ParseFloat(strings.TrimSpace(report.Contents), 64)
+		if err != nil {
+			continue
 		}
-		if err := fi.AddRule(filterRule); err != nil {
-			return err
+		costs[report.Identity] = cost
+	}
+	return costs, nil
+}
+
+// BudgetExceeded returns the event recorded by the first machine that stopped
+// the task for exceeding its maximum cost, or nil if none did.
+func BudgetExceeded(ctx context.Context, remote string) (*common.Event, error) {
+	reports, err := readReports(ctx, remote, "budget", reportOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var event *common.Event
+	for _, report := range reports {
+		timestamp, description, _ := strings.Cut(strings.TrimSpace(report.Contents), " ")
+		exceeded, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			exceeded = report.Modified
+		}
+		if event == nil || exceeded.Before(event.Time) {
+			event = &common.Event{
+				Time:        exceeded,
+				Code:        common.EventBudgetExceeded,
+				Description: []string{description},
+			}
+		}
+	}
+	return event, nil
+}
+
+// preemptionTimes parses a preemption report, which has the time of a notice
+// on every line; lines with invalid times are counted with a zero time.
+func preemptionTimes(contents string) []time.Time {
+	var times []time.Time
+	for _, line := range strings.Split(contents, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			timestamp, _ := time.Parse(time.RFC3339, line)
+			times = append(times, timestamp)
 		}
 	}
+	return times
+}
+
+// signals maps the names of common Linux signals to their numbers.
+var signals = map[string]int{
+	"HUP":  1,
+	"INT":  2,
+	"QUIT": 3,
+	"ILL":  4,
+	"TRAP": 5,
+	"ABRT": 6,
+	"BUS":  7,
+	"FPE":  8,
+	"KILL": 9,
+	"USR1": 10,
+	"SEGV": 11,
+	"USR2": 12,
+	"PIPE": 13,
+	"ALRM": 14,
+	"TERM": 15,
+}
+
+// exitCode parses the $EXIT_STATUS reported by systemd, which is either a
+// numeric exit code or the name of the signal that killed the process; the
+// latter are converted to 128+signal, like shells do.
+func exitCode(status string) (int, bool) {
+	if code, err := strconv.Atoi(status); err == nil {
+		return code, true
+	}
+	if signal, ok := signals[strings.TrimPrefix(status, "SIG")]; ok {
+		return 128 + signal, true
+	}
+	return 0, false
+}
+
+// firstTimestamp returns the timestamp prefixing the first line of a task log.
+func firstTimestamp(log string) time.Time {
+	line, _, _ := strings.Cut(log, "\n")
+	timestamp, _, _ := strings.Cut(line, " ")
+	result, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return result
+}
+
+func Transfer(ctx context.Context, source, destination string, exclude []string) error {
+	ctx, err := transferFilter(ctx, exclude)
+	if err != nil {
+		return err
+	}
 
 	sourceFileSystem, err := fs.NewFs(ctx, source)
 	if err != nil {
@@ -158,6 +411,27 @@ func Transfer(ctx context.Context, source, destination string, exclude []string)
 	return sync.CopyDir(ctx, destinationFileSystem, sourceFileSystem, true)
 }
 
+// transferFilter returns a context that limits transfers to the files not
+// matched by the default exclusion rules nor by the given ones.
+func transferFilter(ctx context.Context, exclude []string) (context.Context, error) {
+	ctx, fi := filter.AddConfig(ctx)
+
+	rules := append([]string{}, defaultTransferExcludes...)
+	if len(exclude) > 0 {
+		rules = append(rules, exclude...)
+	}
+	for _, filterRule := range rules {
+		if !isRcloneFilter(filterRule) {
+			filterRule = filepath.Join("/", filterRule)
+			filterRule = "- " + filterRule
+		}
+		if err := fi.AddRule(filterRule); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
 func Delete(ctx context.Context, destination string) error {
 	destinationFileSystem, err := fs.NewFs(ctx, destination)
 	if err != nil {
@@ -230,6 +504,7 @@ const (
 	RcloneBackendAzureBlob          = "azureblob"
 	RcloneBackendS3                 = "s3"
 	RcloneBackendGoogleCloudStorage = "googlecloudstorage"
+	RcloneBackendLocal              = "local"
 )
 
 // RcloneConnection is used to construct an rclone connection string.
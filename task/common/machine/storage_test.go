@@ -6,9 +6,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
 )
 
@@ -100,6 +102,159 @@ func TestTransferExcludes(t *testing.T) {
 	}
 }
 
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+	reports := filepath.Join(remote, "reports")
+	require.NoError(t, os.MkdirAll(reports, 0755))
+
+	for name, contents := range map[string]string{
+		"status-running":   `{"result": "success", "code": "0", "status": "exited"}`,
+		"status-gone":      `{"result": "exit-code", "code": "2", "status": "exited"}`,
+		"status-slow":      `{"result": "timeout", "code": "TERM", "status": "killed"}`,
+		"status-spot":      `{"result": "preempted", "code": "", "status": ""}`,
+		"preempted-spot":   "2022-03-01T12:30:00Z\n2022-03-01T13:30:00Z\n",
+		"task-gone":        "2022-03-01T12:25:50Z first line\n2022-03-01T12:26:50Z second line\n",
+		"task-running":     "2022-03-01T12:25:50Z first line\n",
+		"machine-whatever": "unrelated",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(reports, name), []byte(contents), 0644))
+	}
+
+	started := time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC)
+	machines := common.Status{{
+		Machine: "running",
+		Phase:   common.PhaseRunning,
+		Started: started,
+	}, {
+		Machine: "other",
+		Phase:   common.PhaseProvisioning,
+	}}
+
+	for i := 0; i < 2; i++ {
+		status, err := machine.Status(ctx, remote, machines)
+		require.NoError(t, err)
+		require.Len(t, status, 5)
+
+		byMachine := map[string]common.MachineStatus{}
+		phases := map[string]common.Phase{}
+		for _, machine := range status {
+			byMachine[machine.Machine] = machine
+			phases[machine.Machine] = machine.Phase
+		}
+		require.Equal(t, map[string]common.Phase{
+			"running": common.PhaseSucceeded,
+			"other":   common.PhaseProvisioning,
+			"gone":    common.PhaseFailed,
+			"slow":    common.PhaseTimedOut,
+			"spot":    common.PhasePreempted,
+		}, phases)
+
+		require.Equal(t, started, byMachine["running"].Started)
+		require.Equal(t, 0, *byMachine["running"].ExitCode)
+		require.False(t, byMachine["running"].Finished.IsZero())
+		require.Equal(t, 2, *byMachine["gone"].ExitCode)
+		require.Equal(t, time.Date(2022, 3, 1, 12, 25, 50, 0, time.UTC), byMachine["gone"].Started)
+		require.Equal(t, 143, *byMachine["slow"].ExitCode)
+		require.Equal(t, "timeout", byMachine["slow"].Result)
+		require.Nil(t, byMachine["other"].ExitCode)
+		require.Equal(t, 2, byMachine["spot"].Preemptions)
+		require.Equal(t, 0, byMachine["running"].Preemptions)
+	}
+
+	// The given machines must not be modified.
+	require.Equal(t, common.PhaseRunning, machines[0].Phase)
+	require.Nil(t, machines[0].ExitCode)
+}
+
+func TestPreemptions(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+	reports := filepath.Join(remote, "reports")
+	require.NoError(t, os.MkdirAll(reports, 0755))
+
+	for name, contents := range map[string]string{
+		"preempted-a": "2022-03-01T12:30:00Z\n2022-03-01T14:30:00Z\n",
+		"preempted-b": "2022-03-01T13:30:00Z\n",
+		"status-a":    `{"result": "preempted", "code": "", "status": ""}`,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(reports, name), []byte(contents), 0644))
+	}
+
+	events, err := machine.Preemptions(ctx, remote)
+	require.NoError(t, err)
+	require.Equal(t, []common.Event{{
+		Time:        time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+		Code:        common.EventPreempted,
+		Description: []string{"a"},
+	}, {
+		Time:        time.Date(2022, 3, 1, 13, 30, 0, 0, time.UTC),
+		Code:        common.EventPreempted,
+		Description: []string{"b"},
+	}, {
+		Time:        time.Date(2022, 3, 1, 14, 30, 0, 0, time.UTC),
+		Code:        common.EventPreempted,
+		Description: []string{"a"},
+	}}, events)
+}
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+
+	events, err := machine.ReadEvents(ctx, remote)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	recorded := []common.Event{{
+		Time:        time.Date(2022, 3, 1, 12, 30, 0, 0, time.UTC),
+		Code:        common.EventRegionFallback,
+		Description: []string{"first", "second", "no capacity"},
+	}}
+	require.NoError(t, machine.WriteEvents(ctx, remote, recorded))
+	events, err = machine.ReadEvents(ctx, remote)
+	require.NoError(t, err)
+	require.Equal(t, recorded, events)
+}
+
+func TestStreamLogs(t *testing.T) {
+	ctx := context.Background()
+	remote := t.TempDir()
+	reports := filepath.Join(remote, "reports")
+	require.NoError(t, os.MkdirAll(reports, 0755))
+
+	log := filepath.Join(reports, "task-machine")
+	require.NoError(t, os.WriteFile(log, []byte("2022-03-01T12:25:50Z first\n2022-03-01T12:25:51Z sec"), 0644))
+
+	lines, cursor, err := machine.StreamLogs(ctx, remote, nil)
+	require.NoError(t, err)
+	require.Equal(t, []common.LogLine{{
+		Machine: "machine",
+		Time:    time.Date(2022, 3, 1, 12, 25, 50, 0, time.UTC),
+		Stream:  common.LogStreamCombined,
+		Text:    "first",
+	}}, lines)
+
+	// Incomplete lines are returned once they're complete.
+	file, err := os.OpenFile(log, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString("ond\nthird\n")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	lines, cursor, err = machine.StreamLogs(ctx, remote, cursor)
+	require.NoError(t, err)
+	require.Len(t, lines, 2)
+	require.Equal(t, "second", lines[0].Text)
+	require.Equal(t, time.Date(2022, 3, 1, 12, 25, 51, 0, time.UTC), lines[0].Time)
+	require.Equal(t, "third", lines[1].Text)
+	require.True(t, lines[1].Time.IsZero())
+
+	lines, _, err = machine.StreamLogs(ctx, remote, cursor)
+	require.NoError(t, err)
+	require.Empty(t, lines)
+}
+
 func listDir(dir string) []string {
 	var entries []string
 	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -0,0 +1,102 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// Push uploads the working directory of the given environment to the task
+// storage in remote.
+func Push(ctx context.Context, remote string, environment common.Environment) error {
+	ctx, restore, err := transferOptions(ctx, environment.Transfer)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if environment.Transfer.Bundle {
+		return PushBundle(ctx, environment.Directory, remote, environment.ExcludeList)
+	}
+	return Transfer(ctx, environment.Directory, remote+"/data", environment.ExcludeList)
+}
+
+// Pull downloads the output directory of the given environment from the task
+// storage in remote, or the one of every machine for tasks with per-machine
+// outputs. Bundled outputs are unpacked to a temporary directory first.
+func Pull(ctx context.Context, remote string, environment common.Environment) error {
+	ctx, restore, err := transferOptions(ctx, environment.Transfer)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	if environment.Transfer.Bundle {
+		staging, err := os.MkdirTemp("", "tpi-bundle-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(staging)
+
+		if err := PullBundle(ctx, remote, staging); err != nil {
+			return err
+		}
+		remote = staging
+	}
+
+	exclude := LimitTransfer(environment.DirectoryOut, environment.ExcludeList)
+	if environment.PerMachineOutput {
+		return PullMachineOutputs(ctx, remote, environment.Directory, environment.OutputMerge, exclude)
+	}
+	return Transfer(ctx, remote+"/data", environment.Directory, exclude)
+}
+
+// ValidateTransfer checks the syntax of the bandwidth limit of the given
+// transfer options.
+func ValidateTransfer(options common.Transfer) error {
+	if options.Transfers < 0 || options.Checkers < 0 {
+		return fmt.Errorf("transfers and checkers can't be negative")
+	}
+	if options.BandwidthLimit == "" {
+		return nil
+	}
+	var limit fs.BwTimetable
+	if err := limit.Set(options.BandwidthLimit); err != nil {
+		return fmt.Errorf("invalid bandwidth limit %#v: %w", options.BandwidthLimit, err)
+	}
+	return nil
+}
+
+// transferOptions returns a context that applies the given options to rclone
+// operations, and a function that lifts the bandwidth limit, which rclone
+// shares among every operation.
+func transferOptions(ctx context.Context, options common.Transfer) (context.Context, func(), error) {
+	if err := ValidateTransfer(options); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, ci := fs.AddConfig(ctx)
+	if options.Transfers > 0 {
+		ci.Transfers = options.Transfers
+	}
+	if options.Checkers > 0 {
+		ci.Checkers = options.Checkers
+	}
+	if options.BandwidthLimit == "" {
+		return ctx, func() {}, nil
+	}
+
+	if err := ci.BwLimit.Set(options.BandwidthLimit); err != nil {
+		return nil, nil, err
+	}
+	accounting.TokenBucket.SetBwLimit(ci.BwLimit.LimitAt(time.Now()).Bandwidth)
+	return ctx, func() {
+		accounting.TokenBucket.SetBwLimit(fs.BwPair{})
+	}, nil
+}
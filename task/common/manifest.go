@@ -0,0 +1,202 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Version is the version of the tool creating tasks; it's set at build time.
+var Version = "0.0.0"
+
+// ManifestVersion is the version of the manifest format; readers should
+// reject manifests with a newer version.
+const ManifestVersion = 1
+
+// Manifest records how a task was launched. It's written to the task storage
+// at creation, so later commands can use it as defaults and experiments can be
+// reproduced.
+type Manifest struct {
+	Version    int       `json:"version"`
+	Identifier string    `json:"identifier"`
+	Created    time.Time `json:"created"`
+	Provider   Provider  `json:"provider"`
+	Region     Region    `json:"region"`
+	// Image and MachineType are the provider-specific identifiers resolved
+	// from the generic ones in Task.
+	Image       string `json:"image,omitempty"`
+	MachineType string `json:"machine_type,omitempty"`
+	ToolVersion string `json:"tool_version"`
+	// Tags holds the tags applied to the task resources.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Git describes the repository containing the working directory, if any.
+	Git *GitInfo `json:"git,omitempty"`
+	// Task holds the task specification, with secrets redacted.
+	Task Task `json:"task"`
+}
+
+// ParseManifest decodes a manifest, rejecting the ones with a newer version.
+func ParseManifest(contents []byte) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Version > ManifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// GitInfo describes the state of a git repository.
+type GitInfo struct {
+	Commit string `json:"commit"`
+	Branch string `json:"branch,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	// Dirty reports whether there were uncommitted changes.
+	Dirty bool `json:"dirty"`
+}
+
+// Redacted replaces the values of secrets in manifests.
+const Redacted = "[redacted]"
+
+// secretVariable matches the names of environment variables likely to hold secrets.
+var secretVariable = regexp.MustCompile(`(?i)(secret|token|password|passwd|credential|key|auth)`)
+
+// NewManifest returns the manifest of the given task, with secrets redacted
+// and the git information of its working directory.
+func NewManifest(identifier Identifier, cloud Cloud, task Task) Manifest {
+	// Relative directories would be resolved against the directory of
+	// whoever reads the manifest later.
+	if directory, err := filepath.Abs(task.Environment.Directory); err == nil && task.Environment.Directory != "" {
+		task.Environment.Directory = directory
+	}
+
+	return Manifest{
+		Version:     ManifestVersion,
+		Identifier:  identifier.Long(),
+		Created:     time.Now().UTC(),
+		Provider:    cloud.Provider,
+		Region:      cloud.Region,
+		ToolVersion: Version,
+		Tags:        cloud.Tags,
+		Git:         ReadGitInfo(task.Environment.Directory),
+		Task:        RedactTask(task),
+	}
+}
+
+// RedactTask returns a copy of the task specification without secrets or
+// runtime state: variables with secret-looking names, storage settings and
+// input sources are redacted, and the status is removed. The script is kept
+// as is, so tasks can be reproduced; secrets belong in variables instead.
+func RedactTask(task Task) Task {
+	variables := Variables{}
+	for name, value := range task.Environment.Variables {
+		if value != nil && secretVariable.MatchString(name) {
+			redacted := Redacted
+			value = &redacted
+		}
+		variables[name] = value
+	}
+	task.Environment.Variables = variables
+
+	if task.RemoteStorage != nil {
+		storage := *task.RemoteStorage
+		storage.Config = map[string]string{}
+		for key := range task.RemoteStorage.Config {
+			storage.Config[key] = Redacted
+		}
+		task.RemoteStorage = &storage
+	}
+
+	// Input sources embed the credentials of the storage they read from.
+	var inputs []Input
+	for _, input := range task.Environment.Inputs {
+		inputs = append(inputs, Input{Source: Redacted, Destination: input.Destination})
+	}
+	task.Environment.Inputs = inputs
+	if task.Environment.Queue.Prefix != "" {
+		task.Environment.Queue.Prefix = Redacted
+	}
+
+	task.Addresses = nil
+	task.Status = nil
+	task.Events = nil
+	return task
+}
+
+// ReadGitInfo returns the state of the git repository containing directory,
+// or nil if it isn't in a repository or git isn't available.
+func ReadGitInfo(directory string) *GitInfo {
+	if directory == "" {
+		return nil
+	}
+
+	git := func(arguments ...string) (string, error) {
+		output, err := exec.Command("git", append([]string{"-C", directory}, arguments...)...).Output()
+		return strings.TrimSpace(string(output)), err
+	}
+
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+
+	info := &GitInfo{Commit: commit}
+	if branch, err := git("rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		info.Branch = branch
+	}
+	if remote, err := git("config", "--get", "remote.origin.url"); err == nil {
+		// Remote addresses may embed access tokens.
+		if address, err := url.Parse(remote); err == nil && address.User != nil {
+			address.User = nil
+			remote = address.String()
+		}
+		info.Remote = remote
+	}
+	if status, err := git("status", "--porcelain"); err == nil {
+		info.Dirty = status != ""
+	}
+	return info
+}
+
+// ApplyDefaults fills the storage attributes, the maximum cost, the timeout
+// and the parallelism that weren't specified, like those of tasks rebuilt from
+// their identifier alone, with the recorded ones. Tasks rebuilt from their
+// identifier also get the recorded tags.
+func (m Manifest) ApplyDefaults(cloud *Cloud, task *Task) {
+	if cloud.Tags == nil && task.Partial() {
+		cloud.Tags = m.Tags
+	}
+	if task.Environment.Directory == "" {
+		task.Environment.Directory = m.Task.Environment.Directory
+	}
+	if task.Environment.DirectoryOut == "" {
+		task.Environment.DirectoryOut = m.Task.Environment.DirectoryOut
+	}
+	if task.Environment.ExcludeList == nil {
+		task.Environment.ExcludeList = m.Task.Environment.ExcludeList
+	}
+	if !task.Environment.PerMachineOutput {
+		task.Environment.PerMachineOutput = m.Task.Environment.PerMachineOutput
+	}
+	if task.Environment.OutputMerge == "" {
+		task.Environment.OutputMerge = m.Task.Environment.OutputMerge
+	}
+	if task.Environment.Transfer == (Transfer{}) {
+		task.Environment.Transfer = m.Task.Environment.Transfer
+	}
+	if task.MaxCost <= 0 {
+		task.MaxCost = m.Task.MaxCost
+	}
+	if task.Environment.Timeout == 0 {
+		task.Environment.Timeout = m.Task.Environment.Timeout
+	}
+	if task.Parallelism == 0 {
+		task.Parallelism = m.Task.Parallelism
+	}
+}
@@ -0,0 +1,22 @@
+package common
+
+import "fmt"
+
+// PlannedResource describes a resource that a task would create, as returned
+// by Task.Plan.
+type PlannedResource struct {
+	Type string
+	Name string
+	// Attributes holds the resolved settings of the resource, like machine
+	// types, image identifiers, disk sizes or firewall rules.
+	Attributes map[string]string
+}
+
+// DiskSize describes a storage size in gigabytes, where non-positive values
+// stand for the image default.
+func DiskSize(size int) string {
+	if size > 0 {
+		return fmt.Sprintf("%d GB", size)
+	}
+	return "image default"
+}
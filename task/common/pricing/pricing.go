@@ -0,0 +1,170 @@
+package pricing
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// catalogJSON holds approximate hourly list prices in USD for the machine
+// types that generic sizes resolve to, in each provider's reference region.
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+// ErrUnknownPrice is returned when the catalog has no price for a machine type.
+var ErrUnknownPrice = errors.New("unknown price")
+
+// Price holds the hourly price in USD of a single machine.
+type Price struct {
+	OnDemand float64 `json:"on_demand"`
+	Spot     float64 `json:"spot"`
+}
+
+// Catalog maps provider names and machine types to prices.
+type Catalog map[common.Provider]map[string]Price
+
+// Load returns the embedded catalog, updated with the prices in the file
+// pointed to by TPI_PRICING_CATALOG, if set; that file has the same format as
+// the embedded one and its prices take precedence.
+func Load() (Catalog, error) {
+	catalog := Catalog{}
+	if err := json.Unmarshal(catalogJSON, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse embedded pricing catalog: %w", err)
+	}
+
+	if path := os.Getenv("TPI_PRICING_CATALOG"); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		override := Catalog{}
+		if err := json.Unmarshal(contents, &override); err != nil {
+			return nil, fmt.Errorf("failed to parse pricing catalog %s: %w", path, err)
+		}
+		catalog.Merge(override)
+	}
+
+	return catalog, nil
+}
+
+// Merge adds the prices of other to the catalog, replacing existing ones.
+func (c Catalog) Merge(other Catalog) {
+	for provider, prices := range other {
+		if c[provider] == nil {
+			c[provider] = map[string]Price{}
+		}
+		for machineType, price := range prices {
+			c[provider][machineType] = price
+		}
+	}
+}
+
+// Lookup returns the price of the given machine type.
+func (c Catalog) Lookup(provider common.Provider, machineType string) (Price, error) {
+	if price, ok := c[provider][machineType]; ok {
+		return price, nil
+	}
+	return Price{}, fmt.Errorf("%w for %s machine type %s", ErrUnknownPrice, provider, machineType)
+}
+
+// Estimate holds the estimated cost in USD of a task.
+type Estimate struct {
+	// Hourly is the cost of running every machine of the task for an hour.
+	Hourly float64
+	// Maximum is the cost of running every machine until the task timeout.
+	Maximum float64
+}
+
+// NewEstimate returns the cost of running parallelism machines at the given
+// price until timeout. Spot tasks use the spot price or, if set, the maximum
+// bidding price; on-demand prices are used when there's no spot price.
+func NewEstimate(price Price, spot common.Spot, parallelism uint16, timeout time.Duration) Estimate {
+	hourly := price.OnDemand
+	switch {
+	case spot > 0:
+		hourly = float64(spot)
+	case spot == 0 && price.Spot > 0:
+		hourly = price.Spot
+	}
+
+	hourly *= float64(parallelism)
+	return Estimate{
+		Hourly:  hourly,
+		Maximum: hourly * timeout.Hours(),
+	}
+}
+
+// String describes the estimate in a human-readable way.
+func (e Estimate) String() string {
+	return fmt.Sprintf("$%.2f/h, up to $%.2f", e.Hourly, e.Maximum)
+}
+
+// Spend returns the cost of running the given machines until now at the given
+// hourly price per machine. Machines are charged from their start until they
+// finish; those that haven't started yet are free. The costs reported by
+// machines, keyed by identity, are used when they're higher, and account for
+// machines that aren't part of the status anymore.
+func Spend(hourly float64, status common.Status, reported map[string]float64, now time.Time) float64 {
+	spend := 0.0
+	seen := map[string]bool{}
+	for _, machine := range status {
+		seen[machine.Machine] = true
+		cost := 0.0
+		end := now
+		if !machine.Finished.IsZero() && machine.Finished.Before(now) {
+			end = machine.Finished
+		}
+		if !machine.Started.IsZero() && end.After(machine.Started) {
+			cost = hourly * end.Sub(machine.Started).Hours()
+		}
+		if reported[machine.Machine] > cost {
+			cost = reported[machine.Machine]
+		}
+		spend += cost
+	}
+	for identity, cost := range reported {
+		if !seen[identity] {
+			spend += cost
+		}
+	}
+	return spend
+}
+
+// BudgetExceeded returns the time when the spend of the given machines first
+// exceeded limit, or false if it doesn't exceed it by now. Reported costs
+// don't say when they were incurred, so a limit exceeded by them alone is
+// reported as exceeded now.
+func BudgetExceeded(hourly, limit float64, status common.Status, reported map[string]float64, now time.Time) (time.Time, bool) {
+	if Spend(hourly, status, reported, now) <= limit {
+		return time.Time{}, false
+	}
+
+	low := now
+	for _, machine := range status {
+		if !machine.Started.IsZero() && machine.Started.Before(low) {
+			low = machine.Started
+		}
+	}
+	if Spend(hourly, status, reported, low) > limit {
+		return now, true
+	}
+
+	// Spend only grows over time, so the moment it crossed the limit can be
+	// found with a binary search.
+	high := now
+	for high.Sub(low) > time.Second {
+		middle := low.Add(high.Sub(low) / 2)
+		if Spend(hourly, status, reported, middle) > limit {
+			high = middle
+		} else {
+			low = middle
+		}
+	}
+	return high, true
+}
@@ -0,0 +1,126 @@
+package pricing_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/pricing"
+)
+
+func TestLoad(t *testing.T) {
+	catalog, err := pricing.Load()
+	require.NoError(t, err)
+
+	price, err := catalog.Lookup(common.ProviderAWS, "t2.micro")
+	require.NoError(t, err)
+	require.Greater(t, price.OnDemand, price.Spot)
+
+	_, err = catalog.Lookup(common.ProviderAWS, "nonexistent")
+	require.ErrorIs(t, err, pricing.ErrUnknownPrice)
+}
+
+func TestLoadOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"aws": {"t2.micro": {"on_demand": 1, "spot": 0.5}},
+		"k8s": {"8-32000": {"on_demand": 0.25}}
+	}`), 0644))
+	t.Setenv("TPI_PRICING_CATALOG", path)
+
+	catalog, err := pricing.Load()
+	require.NoError(t, err)
+
+	price, err := catalog.Lookup(common.ProviderAWS, "t2.micro")
+	require.NoError(t, err)
+	require.Equal(t, pricing.Price{OnDemand: 1, Spot: 0.5}, price)
+
+	price, err = catalog.Lookup(common.ProviderK8S, "8-32000")
+	require.NoError(t, err)
+	require.Equal(t, pricing.Price{OnDemand: 0.25}, price)
+
+	// Prices missing from the override file are kept.
+	_, err = catalog.Lookup(common.ProviderAWS, "m5.2xlarge")
+	require.NoError(t, err)
+}
+
+func TestNewEstimate(t *testing.T) {
+	price := pricing.Price{OnDemand: 2, Spot: 0.5}
+
+	tests := []struct {
+		description string
+		price       pricing.Price
+		spot        common.Spot
+		expected    pricing.Estimate
+	}{{
+		description: "on-demand",
+		price:       price,
+		spot:        common.SpotDisabled,
+		expected:    pricing.Estimate{Hourly: 8, Maximum: 80},
+	}, {
+		description: "automatic spot price",
+		price:       price,
+		spot:        common.SpotEnabled,
+		expected:    pricing.Estimate{Hourly: 2, Maximum: 20},
+	}, {
+		description: "maximum bidding price",
+		price:       price,
+		spot:        common.Spot(1),
+		expected:    pricing.Estimate{Hourly: 4, Maximum: 40},
+	}, {
+		description: "spot without spot price",
+		price:       pricing.Price{OnDemand: 2},
+		spot:        common.SpotEnabled,
+		expected:    pricing.Estimate{Hourly: 8, Maximum: 80},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require.Equal(t, test.expected, pricing.NewEstimate(test.price, test.spot, 4, 10*time.Hour))
+		})
+	}
+}
+
+func TestSpend(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	status := common.Status{
+		{Machine: "running", Started: now.Add(-2 * time.Hour)},
+		{Machine: "finished", Started: now.Add(-3 * time.Hour), Finished: now.Add(-2 * time.Hour)},
+		{Machine: "queued"},
+	}
+
+	require.InDelta(t, 3.0, pricing.Spend(1, status, nil, now), 1e-9)
+	require.InDelta(t, 0.5, pricing.Spend(1, status, nil, now.Add(-2*time.Hour-30*time.Minute)), 1e-9)
+	require.Zero(t, pricing.Spend(1, status, nil, now.Add(-4*time.Hour)))
+
+	// Reported costs replace lower estimates and count machines that are gone.
+	reported := map[string]float64{"running": 5, "finished": 0.5, "gone": 2}
+	require.InDelta(t, 8.0, pricing.Spend(1, status, reported, now), 1e-9)
+}
+
+func TestBudgetExceeded(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	status := common.Status{
+		{Machine: "first", Started: now.Add(-4 * time.Hour)},
+		{Machine: "second", Started: now.Add(-4 * time.Hour)},
+	}
+
+	_, exceeded := pricing.BudgetExceeded(1, 10, status, nil, now)
+	require.False(t, exceeded)
+
+	when, exceeded := pricing.BudgetExceeded(1, 4, status, nil, now)
+	require.True(t, exceeded)
+	require.WithinDuration(t, now.Add(-2*time.Hour), when, time.Second)
+
+	when, exceeded = pricing.BudgetExceeded(1, 10, status, map[string]float64{"gone": 5}, now)
+	require.True(t, exceeded)
+	require.WithinDuration(t, now.Add(-90*time.Minute), when, time.Second)
+
+	when, exceeded = pricing.BudgetExceeded(1, 10, status, map[string]float64{"gone": 11}, now)
+	require.True(t, exceeded)
+	require.Equal(t, now, when)
+}
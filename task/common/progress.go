@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// Progress persists the names of the steps completed by RunStepsWithProgress,
+// so an interrupted run can be resumed later instead of starting over.
+type Progress struct {
+	Path string
+}
+
+// NewProgress returns the progress of the task with the given identifier,
+// stored in a local state file; TPI_PROGRESS_DIRECTORY overrides the default
+// location under the user cache directory, or the temporary directory for
+// users without one.
+func NewProgress(identifier Identifier) *Progress {
+	directory := os.Getenv("TPI_PROGRESS_DIRECTORY")
+	if directory == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			cache = os.TempDir()
+		}
+		directory = filepath.Join(cache, "tpi-progress")
+	}
+
+	return &Progress{Path: filepath.Join(directory, identifier.Long()+".json")}
+}
+
+type progressFile struct {
+	Completed []string `json:"completed"`
+}
+
+// Exists reports whether there is saved progress to resume from.
+func (p *Progress) Exists() bool {
+	_, err := os.Stat(p.Path)
+	return err == nil
+}
+
+// Load returns the names of the completed steps, or none if there is no saved
+// progress.
+func (p *Progress) Load() ([]string, error) {
+	contents, err := os.ReadFile(p.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var file progressFile
+	if err := json.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+	return file.Completed, nil
+}
+
+// Save replaces the saved progress with the given completed steps.
+func (p *Progress) Save(completed []string) error {
+	contents, err := json.Marshal(progressFile{Completed: completed})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.Path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so an interruption never leaves a
+	// truncated state file behind.
+	temporary := p.Path + ".tmp"
+	if err := os.WriteFile(temporary, contents, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temporary, p.Path)
+}
+
+// Clear removes the saved progress.
+func (p *Progress) Clear() error {
+	if err := os.Remove(p.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// DeleteProgress removes the saved progress of the task with the given
+// identifier, so deleted tasks don't leave stale state files behind.
+func DeleteProgress(identifier Identifier) error {
+	return NewProgress(identifier).Clear()
+}
@@ -0,0 +1,213 @@
+package sizes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// catalogJSON holds the generic machine sizes offered for every provider,
+// along with the machine type each of them resolves to.
+//
+//go:embed catalog.json
+var catalogJSON []byte
+
+var (
+	// ErrUnknownSize is returned for machine types that look like generic
+	// sizes but aren't in the catalog.
+	ErrUnknownSize = errors.New("unknown machine size")
+	// ErrUnavailableSize is returned for generic sizes without a machine type
+	// for the requested provider.
+	ErrUnavailableSize = errors.New("unavailable machine size")
+)
+
+// armTypes matches the provider-specific machine types with ARM processors:
+// AWS Graviton, Google Cloud Tau T2A and Axion, and Azure Ampere Altra.
+var armTypes = map[common.Provider]*regexp.Regexp{
+	common.ProviderAWS: regexp.MustCompile(`^(?:a1|[a-z]+\d+[a-z]*g[a-z]*)\.`),
+	common.ProviderGCP: regexp.MustCompile(`^(?:t2a|c4a)-`),
+	common.ProviderAZ:  regexp.MustCompile(`^Standard_[A-Z]+\d+[a-z]*p[a-z]*_v\d+$`),
+}
+
+// genericSize matches values that can only be generic sizes, like m or xl+v100;
+// provider-specific machine types always have dots, dashes or uppercase letters.
+var genericSize = regexp.MustCompile(`^[a-z]+(?:\+[a-z0-9]+)?$`)
+
+// Size describes a generic machine size: the minimum resources it offers and
+// the machine type it resolves to on every provider where it's available.
+type Size struct {
+	// CPU is the number of CPU cores.
+	CPU int `json:"cpu"`
+	// Memory is the amount of memory in gigabytes.
+	Memory int `json:"memory"`
+	// GPU is the GPU model, if any.
+	GPU      string `json:"gpu,omitempty"`
+	GPUCount int    `json:"gpu_count,omitempty"`
+	// Architecture is the processor architecture; when empty, it's inferred
+	// from the machine type of each provider.
+	Architecture common.Architecture `json:"architecture,omitempty"`
+	// Types maps provider names to machine types, in the format accepted by
+	// the machine attribute for each provider.
+	Types map[common.Provider]string `json:"types"`
+}
+
+// Catalog maps generic size names to their descriptions.
+type Catalog map[string]Size
+
+// Load returns the embedded catalog, updated with the sizes in the file
+// pointed to by TPI_MACHINE_CATALOG, if set; that file has the same format as
+// the embedded one and its sizes replace those with the same name.
+func Load() (Catalog, error) {
+	catalog := embedded()
+
+	if path := os.Getenv("TPI_MACHINE_CATALOG"); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		override := Catalog{}
+		if err := json.Unmarshal(contents, &override); err != nil {
+			return nil, fmt.Errorf("failed to parse machine catalog %s: %w", path, err)
+		}
+		for name, size := range override {
+			if name == "" || strings.ContainsAny(name, ", ") {
+				return nil, fmt.Errorf("invalid machine size name %#v in %s", name, path)
+			}
+			if len(size.Types) == 0 {
+				return nil, fmt.Errorf("machine size %s in %s doesn't have any machine types", name, path)
+			}
+			catalog[name] = size
+		}
+	}
+
+	return catalog, nil
+}
+
+// embedded returns the catalog embedded in the binary.
+func embedded() Catalog {
+	catalog := Catalog{}
+	if err := json.Unmarshal(catalogJSON, &catalog); err != nil {
+		panic(fmt.Sprintf("sizes: failed to parse embedded machine catalog: %v", err))
+	}
+	return catalog
+}
+
+// loaded caches the catalog used for lookups, along with the value of
+// TPI_MACHINE_CATALOG it was loaded from.
+var loaded struct {
+	sync.Mutex
+	path    string
+	catalog Catalog
+}
+
+// current returns the catalog used for lookups, loading it only once for
+// every value of TPI_MACHINE_CATALOG. Invalid catalog files are ignored here
+// and reported by Validate instead, so existing tasks can still be read and
+// deleted.
+func current() Catalog {
+	loaded.Lock()
+	defer loaded.Unlock()
+
+	path := os.Getenv("TPI_MACHINE_CATALOG")
+	if loaded.catalog != nil && loaded.path == path {
+		return loaded.catalog
+	}
+
+	catalog, err := Load()
+	if err != nil {
+		catalog = embedded()
+	}
+	loaded.path = path
+	loaded.catalog = catalog
+	return catalog
+}
+
+// Lookup returns the machine type of the given provider for a generic size,
+// and whether there is one.
+func Lookup(provider common.Provider, name string) (string, bool) {
+	return current().Lookup(provider, name)
+}
+
+// Architecture returns the processor architecture of the given generic size or
+// provider-specific machine type.
+func Architecture(provider common.Provider, machine string) common.Architecture {
+	return current().Architecture(provider, machine)
+}
+
+// Lookup returns the machine type of the given provider for a generic size,
+// and whether there is one.
+func (c Catalog) Lookup(provider common.Provider, name string) (string, bool) {
+	machineType, ok := c[name].Types[provider]
+	return machineType, ok
+}
+
+// Architecture returns the processor architecture of the given generic size or
+// provider-specific machine type.
+func (c Catalog) Architecture(provider common.Provider, machine string) common.Architecture {
+	if size, ok := c[machine]; ok && size.Architecture != "" {
+		return size.Architecture
+	}
+	if machineType, ok := c.Lookup(provider, machine); ok {
+		machine = machineType
+	}
+	if pattern, ok := armTypes[provider]; ok && pattern.MatchString(machine) {
+		return common.ArchitectureARM64
+	}
+	return common.ArchitectureAMD64
+}
+
+// Validate checks that every generic size in the given machine type list is
+// available on the provider and that all the machine types share the same
+// architecture; provider-specific machine types are accepted as they are, and
+// so is everything for providers without any generic sizes.
+func Validate(provider common.Provider, machine string) error {
+	catalog, err := Load()
+	if err != nil {
+		return err
+	}
+	machines := (common.Size{Machine: machine}).Machines()
+	for _, name := range machines {
+		if err := catalog.Validate(provider, name); err != nil {
+			return err
+		}
+		if catalog.Architecture(provider, name) != catalog.Architecture(provider, machines[0]) {
+			return fmt.Errorf("machine types %s and %s have different architectures", machines[0], name)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the given machine type is a generic size available on
+// the provider or a provider-specific machine type.
+func (c Catalog) Validate(provider common.Provider, name string) error {
+	if !c.supports(provider) {
+		return nil
+	}
+	if size, ok := c[name]; ok {
+		if _, ok := size.Types[provider]; !ok {
+			return fmt.Errorf("%w: %s isn't available on %s", ErrUnavailableSize, name, provider)
+		}
+		return nil
+	}
+	if genericSize.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrUnknownSize, name)
+	}
+	return nil
+}
+
+// supports reports whether any size has a machine type for the provider.
+func (c Catalog) supports(provider common.Provider) bool {
+	for _, size := range c {
+		if _, ok := size.Types[provider]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package sizes_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/pricing"
+	"terraform-provider-iterative/task/common/sizes"
+)
+
+func TestLoad(t *testing.T) {
+	catalog, err := sizes.Load()
+	require.NoError(t, err)
+
+	providers := []common.Provider{common.ProviderAWS, common.ProviderAZ, common.ProviderGCP, common.ProviderK8S}
+	for _, name := range []string{"s", "m", "l", "xl", "m+t4", "m+k80", "l+k80", "xl+k80", "m+v100", "l+v100", "xl+v100"} {
+		for _, provider := range providers {
+			_, ok := catalog.Lookup(provider, name)
+			require.True(t, ok, "%s on %s", name, provider)
+		}
+	}
+
+	machineType, ok := catalog.Lookup(common.ProviderGCP, "xl+a100")
+	require.True(t, ok)
+	require.Equal(t, "a2-highgpu-8g", machineType)
+	require.Equal(t, 8, catalog["xl+a100"].GPUCount)
+
+	_, ok = catalog.Lookup(common.ProviderGCP, "m+a10g")
+	require.False(t, ok)
+}
+
+func TestCatalogGPUCounts(t *testing.T) {
+	catalog, err := sizes.Load()
+	require.NoError(t, err)
+
+	// Machine types with explicit accelerators must request as many GPUs as
+	// their size offers.
+	accelerators := regexp.MustCompile(`\*(\d+)$`)
+	for name, size := range catalog {
+		for _, provider := range []common.Provider{common.ProviderGCP, common.ProviderK8S} {
+			match := accelerators.FindStringSubmatch(size.Types[provider])
+			if match == nil {
+				continue
+			}
+			require.Equal(t, strconv.Itoa(size.GPUCount), match[1], "%s on %s", name, provider)
+		}
+	}
+}
+
+func TestLoadOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"m": {"cpu": 4, "memory": 16, "types": {"aws": "m6i.xlarge"}},
+		"gpu": {"cpu": 8, "memory": 32, "gpu": "NVIDIA L4", "gpu_count": 1, "types": {"aws": "g6.2xlarge"}}
+	}`), 0644))
+	t.Setenv("TPI_MACHINE_CATALOG", path)
+
+	machineType, ok := sizes.Lookup(common.ProviderAWS, "m")
+	require.True(t, ok)
+	require.Equal(t, "m6i.xlarge", machineType)
+
+	machineType, ok = sizes.Lookup(common.ProviderAWS, "gpu")
+	require.True(t, ok)
+	require.Equal(t, "g6.2xlarge", machineType)
+
+	// Overridden sizes replace the embedded ones entirely.
+	_, ok = sizes.Lookup(common.ProviderGCP, "m")
+	require.False(t, ok)
+	require.ErrorIs(t, sizes.Validate(common.ProviderGCP, "m"), sizes.ErrUnavailableSize)
+
+	// Sizes missing from the override file are kept.
+	_, ok = sizes.Lookup(common.ProviderAWS, "xl")
+	require.True(t, ok)
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"a,b": {"types": {"aws": "t3.micro"}}}`), 0644))
+	t.Setenv("TPI_MACHINE_CATALOG", path)
+
+	_, err := sizes.Load()
+	require.Error(t, err)
+	require.Error(t, sizes.Validate(common.ProviderAWS, "m"))
+
+	// Lookups fall back to the embedded catalog.
+	machineType, ok := sizes.Lookup(common.ProviderAWS, "m")
+	require.True(t, ok)
+	require.Equal(t, "m5.2xlarge", machineType)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		provider common.Provider
+		machine  string
+		err      error
+	}{
+		{common.ProviderAWS, "m", nil},
+		{common.ProviderAWS, "m+t4,m+a10g", nil},
+		{common.ProviderAWS, "g5.xlarge", nil},
+		{common.ProviderAWS, "m+a100", sizes.ErrUnavailableSize},
+		{common.ProviderAWS, "m+t4,xxl", sizes.ErrUnknownSize},
+		{common.ProviderGCP, "custom-8-53248+nvidia-tesla-k80*1", nil},
+		{common.ProviderAZ, "Standard_NC6", nil},
+		{common.ProviderK8S, "8-32000+nvidia*1", nil},
+		{common.ProviderK8S, "m+h200", sizes.ErrUnknownSize},
+		{common.ProviderLocal, "m", nil},
+		{common.ProviderAWS, "m+arm,m6g.2xlarge", nil},
+	}
+
+	for _, test := range tests {
+		err := sizes.Validate(test.provider, test.machine)
+		if test.err == nil {
+			require.NoError(t, err, "%s on %s", test.machine, test.provider)
+		} else {
+			require.ErrorIs(t, err, test.err, "%s on %s", test.machine, test.provider)
+		}
+	}
+}
+
+func TestArchitecture(t *testing.T) {
+	tests := []struct {
+		provider     common.Provider
+		machine      string
+		architecture common.Architecture
+	}{
+		{common.ProviderAWS, "m", common.ArchitectureAMD64},
+		{common.ProviderAWS, "m+arm", common.ArchitectureARM64},
+		{common.ProviderAWS, "g4dn.xlarge", common.ArchitectureAMD64},
+		{common.ProviderAWS, "g5g.xlarge", common.ArchitectureARM64},
+		{common.ProviderAWS, "c7gn.large", common.ArchitectureARM64},
+		{common.ProviderAWS, "a1.large", common.ArchitectureARM64},
+		{common.ProviderGCP, "t2a-standard-4", common.ArchitectureARM64},
+		{common.ProviderGCP, "n2-standard-4", common.ArchitectureAMD64},
+		{common.ProviderAZ, "Standard_D4pds_v5", common.ArchitectureARM64},
+		{common.ProviderAZ, "Standard_D4ds_v5", common.ArchitectureAMD64},
+		{common.ProviderK8S, "m+arm", common.ArchitectureARM64},
+		{common.ProviderK8S, "8-32000", common.ArchitectureAMD64},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.architecture, sizes.Architecture(test.provider, test.machine), "%s on %s", test.machine, test.provider)
+	}
+
+	require.Error(t, sizes.Validate(common.ProviderAWS, "m,m+arm"))
+}
+
+func TestPrices(t *testing.T) {
+	catalog, err := sizes.Load()
+	require.NoError(t, err)
+	prices, err := pricing.Load()
+	require.NoError(t, err)
+
+	for name, size := range catalog {
+		for provider, machineType := range size.Types {
+			if provider == common.ProviderK8S {
+				continue
+			}
+			_, err := prices.Lookup(provider, machineType)
+			require.NoError(t, err, name)
+		}
+	}
+}
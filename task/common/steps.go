@@ -2,6 +2,10 @@ package common
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/0x2b3bfa0/logrusctx"
 )
@@ -10,17 +14,273 @@ import (
 type Step struct {
 	Action      func(ctx context.Context) error
 	Description string
+	// Name identifies the step, so other steps can depend on it.
+	Name string
+	// Dependencies lists the names of the steps that must complete before
+	// this one starts; steps without dependencies start immediately.
+	Dependencies []string
+	// Rollback undoes the effects of Action; it's called for every completed
+	// step, in reverse order of completion, when another step fails.
+	Rollback func(ctx context.Context) error
+	// Resume makes the step resumable: once completed, it's recorded in the
+	// progress passed to RunStepsWithProgress, and later runs call Resume
+	// instead of Action. Resumable steps aren't rolled back when there is a
+	// progress to keep them in. Steps without Resume always run their Action.
+	Resume func(ctx context.Context) error
 }
 
-// RunSteps executes the specified resource allocation steps.
+// RollbackError is returned by RunSteps when a step fails and the rollback
+// of some completed step fails too, leaving residual resources behind.
+type RollbackError struct {
+	// Err is the error returned by the failed step.
+	Err error
+	// Rollback contains the errors returned by the failed rollbacks.
+	Rollback []error
+}
+
+func (e *RollbackError) Error() string {
+	var messages []string
+	for _, err := range e.Rollback {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("%s; rollback failed: %s", e.Err, strings.Join(messages, "; "))
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// ProgressError is returned by RunStepsWithProgress when a step fails and the
+// completed resumable steps are kept in the progress instead of being rolled
+// back, so a later run can resume from them.
+type ProgressError struct {
+	// Err is the error returned by the failed step.
+	Err error
+	// Steps contains the names of the steps kept in the progress.
+	Steps []string
+}
+
+func (e *ProgressError) Error() string {
+	return fmt.Sprintf("%s; kept completed steps: %s", e.Err, strings.Join(e.Steps, ", "))
+}
+
+func (e *ProgressError) Unwrap() error {
+	return e.Err
+}
+
+// Sequence chains the given steps, so each one depends on the previous one and
+// they run in order, like in a script.
+func Sequence(steps []Step) []Step {
+	result := make([]Step, len(steps))
+	for i, step := range steps {
+		if step.Name == "" {
+			step.Name = "sequence-" + strconv.Itoa(i)
+		}
+		if i > 0 {
+			step.Dependencies = append(append([]string{}, step.Dependencies...), result[i-1].Name)
+		}
+		result[i] = step
+	}
+	return result
+}
+
+// RunSteps executes the specified resource allocation steps, running
+// concurrently those whose dependencies have completed. When a step fails, no
+// more steps are started and, once the running ones finish, the completed
+// steps are rolled back.
 func RunSteps(ctx context.Context, steps []Step) error {
-	total := len(steps)
+	return RunStepsWithProgress(ctx, steps, nil)
+}
+
+// RunStepsWithProgress works like RunSteps, but records the completed
+// resumable steps in progress as they finish and resumes the steps already
+// recorded there. Progress is cleared on success; on failure, resumable steps
+// aren't rolled back unless a step they depend on is, and progress keeps them
+// along with the steps that couldn't be rolled back, so a later run can pick
+// them up.
+func RunStepsWithProgress(ctx context.Context, steps []Step, progress *Progress) error {
+	indexes := make(map[string]int)
 	for i, step := range steps {
-		logrusctx.Infof(ctx, "[%d/%d] %s", i+1, total, step.Description)
-		if err := step.Action(ctx); err != nil {
-			logrusctx.Debug(ctx, "step: ", step.Description, " error: ", err)
-			return err
+		if step.Name == "" {
+			continue
+		}
+		if _, ok := indexes[step.Name]; ok {
+			return fmt.Errorf("duplicate step name %q", step.Name)
+		}
+		indexes[step.Name] = i
+	}
+	for _, step := range steps {
+		for _, dependency := range step.Dependencies {
+			if _, ok := indexes[dependency]; !ok {
+				return fmt.Errorf("step %q depends on unknown step %q", step.Description, dependency)
+			}
+		}
+	}
+
+	resumed := make([]bool, len(steps))
+	if progress != nil {
+		names, err := progress.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load progress: %w", err)
+		}
+		for _, name := range names {
+			if i, ok := indexes[name]; ok && steps[i].Resume != nil {
+				resumed[i] = true
+			}
+		}
+	}
+
+	type result struct {
+		index int
+		err   error
+	}
+
+	results := make(chan result)
+	started := make([]bool, len(steps))
+	done := make([]bool, len(steps))
+	ready := func(i int) bool {
+		for _, dependency := range steps[i].Dependencies {
+			if !done[indexes[dependency]] {
+				return false
+			}
+		}
+		return true
+	}
+
+	var completed []int
+	var failure error
+	running, count, total := 0, 0, len(steps)
+	for {
+		for i, step := range steps {
+			if failure != nil || started[i] || !ready(i) {
+				continue
+			}
+			started[i] = true
+			running++
+			count++
+			action := step.Action
+			if resumed[i] {
+				action = step.Resume
+				logrusctx.Infof(ctx, "[%d/%d] %s (resumed)", count, total, step.Description)
+			} else {
+				logrusctx.Infof(ctx, "[%d/%d] %s", count, total, step.Description)
+			}
+			go func(i int) {
+				results <- result{index: i, err: action(ctx)}
+			}(i)
 		}
+
+		if running == 0 {
+			break
+		}
+
+		r := <-results
+		running--
+		if r.err != nil {
+			logrusctx.Debug(ctx, "step: ", steps[r.index].Description, " error: ", r.err)
+			if failure == nil {
+				failure = r.err
+			}
+			continue
+		}
+		done[r.index] = true
+		completed = append(completed, r.index)
+		saveProgress(ctx, progress, steps, completed)
+	}
+
+	if failure == nil && len(completed) < total {
+		failure = errors.New("steps have circular dependencies")
+	}
+	if failure == nil {
+		clearProgress(ctx, progress)
+		return nil
+	}
+
+	// Resumable steps are kept for a later run, unless a step they depend on
+	// is undone; completion order guarantees dependencies are visited first.
+	undone := make([]bool, len(steps))
+	for _, i := range completed {
+		undone[i] = progress == nil || steps[i].Resume == nil
+		for _, dependency := range steps[i].Dependencies {
+			undone[i] = undone[i] || undone[indexes[dependency]] && steps[indexes[dependency]].Rollback != nil
+		}
+	}
+
+	var rollbackErrors []error
+	rolledBack := make([]bool, len(steps))
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := steps[completed[i]]
+		if step.Rollback == nil || !undone[completed[i]] {
+			continue
+		}
+		logrusctx.Infof(ctx, "Rolling back: %s", step.Description)
+		if err := step.Rollback(ctx); err != nil {
+			logrusctx.Debug(ctx, "rollback: ", step.Description, " error: ", err)
+			rollbackErrors = append(rollbackErrors, err)
+			continue
+		}
+		rolledBack[completed[i]] = true
+	}
+
+	// Keep the steps that weren't rolled back, as long as everything they
+	// depend on was kept too.
+	kept := make([]bool, len(steps))
+	var remaining []int
+	var names []string
+	for _, i := range completed {
+		if rolledBack[i] {
+			continue
+		}
+		kept[i] = true
+		for _, dependency := range steps[i].Dependencies {
+			kept[i] = kept[i] && kept[indexes[dependency]]
+		}
+		if kept[i] {
+			remaining = append(remaining, i)
+			if steps[i].Resume != nil && steps[i].Name != "" {
+				names = append(names, steps[i].Name)
+			}
+		}
+	}
+
+	if len(rollbackErrors) > 0 {
+		saveProgress(ctx, progress, steps, remaining)
+		return &RollbackError{Err: failure, Rollback: rollbackErrors}
+	}
+	if progress != nil && len(names) > 0 {
+		saveProgress(ctx, progress, steps, remaining)
+		return &ProgressError{Err: failure, Steps: names}
+	}
+	clearProgress(ctx, progress)
+	return failure
+}
+
+// saveProgress records the given completed steps, if they're resumable.
+// Progress is a best effort: failing to save it doesn't fail the steps.
+func saveProgress(ctx context.Context, progress *Progress, steps []Step, completed []int) {
+	if progress == nil {
+		return
+	}
+
+	names := []string{}
+	for _, i := range completed {
+		if steps[i].Resume != nil && steps[i].Name != "" {
+			names = append(names, steps[i].Name)
+		}
+	}
+
+	if err := progress.Save(names); err != nil {
+		logrusctx.Warn(ctx, "failed to save progress: ", err)
+	}
+}
+
+// clearProgress removes the saved progress, if any.
+func clearProgress(ctx context.Context, progress *Progress) {
+	if progress == nil {
+		return
+	}
+
+	if err := progress.Clear(); err != nil {
+		logrusctx.Warn(ctx, "failed to clear progress: ", err)
 	}
-	return nil
 }
@@ -3,7 +3,11 @@ package common_test
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"terraform-provider-iterative/task/common"
 
@@ -35,13 +39,221 @@ func TestSteps(t *testing.T) {
 	}}
 
 	// Run the only steps 1 and 3.
-	err := common.RunSteps(ctx, []common.Step{steps[0], steps[2]})
+	err := common.RunSteps(ctx, common.Sequence([]common.Step{steps[0], steps[2]}))
 	require.NoError(t, err)
 	require.Equal(t, stepsRun, []int{1, 3})
 
 	// Run the original test set. Since step 2 returns an error, step 3 won't be run.
 	stepsRun = []int{}
-	err = common.RunSteps(ctx, steps)
+	err = common.RunSteps(ctx, common.Sequence(steps))
 	require.EqualError(t, err, "some error")
 	require.Equal(t, stepsRun, []int{1, 2})
 }
+
+func TestStepsConcurrency(t *testing.T) {
+	ctx := context.Background()
+
+	// Steps a and b only complete when both are running at the same time.
+	var group sync.WaitGroup
+	group.Add(2)
+	concurrent := func(context.Context) error {
+		group.Done()
+		done := make(chan struct{})
+		go func() {
+			group.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("steps didn't run concurrently")
+		}
+	}
+
+	var mutex sync.Mutex
+	var order []string
+	record := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	err := common.RunSteps(ctx, []common.Step{{
+		Name:         "c",
+		Description:  "step c",
+		Action:       record("c"),
+		Dependencies: []string{"a", "b"},
+	}, {
+		Name:        "a",
+		Description: "step a",
+		Action:      concurrent,
+	}, {
+		Name:        "b",
+		Description: "step b",
+		Action:      concurrent,
+	}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, order)
+}
+
+func TestStepsRollback(t *testing.T) {
+	ctx := context.Background()
+
+	var mutex sync.Mutex
+	var events []string
+	record := func(event string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, event)
+			return err
+		}
+	}
+
+	steps := []common.Step{{
+		Name:        "a",
+		Description: "step a",
+		Action:      record("create a", nil),
+		Rollback:    record("delete a", nil),
+	}, {
+		Name:         "b",
+		Description:  "step b",
+		Action:       record("create b", nil),
+		Dependencies: []string{"a"},
+		Rollback:     record("delete b", nil),
+	}, {
+		Name:         "c",
+		Description:  "step c",
+		Action:       record("create c", errors.New("some error")),
+		Dependencies: []string{"b"},
+		Rollback:     record("delete c", nil),
+	}, {
+		Name:         "d",
+		Description:  "step d",
+		Action:       record("create d", nil),
+		Dependencies: []string{"c"},
+		Rollback:     record("delete d", nil),
+	}}
+
+	err := common.RunSteps(ctx, steps)
+	require.EqualError(t, err, "some error")
+	require.Equal(t, []string{"create a", "create b", "create c", "delete b", "delete a"}, events)
+
+	// A failed rollback is reported along with the original error.
+	events = nil
+	steps[0].Rollback = record("delete a", errors.New("rollback error"))
+	err = common.RunSteps(ctx, steps)
+	var rollbackErr *common.RollbackError
+	require.ErrorAs(t, err, &rollbackErr)
+	require.EqualError(t, rollbackErr.Err, "some error")
+	require.EqualError(t, err, "some error; rollback failed: rollback error")
+}
+
+func TestStepsInvalidDependencies(t *testing.T) {
+	ctx := context.Background()
+	action := func(context.Context) error { return nil }
+
+	err := common.RunSteps(ctx, []common.Step{{
+		Name:         "a",
+		Description:  "step a",
+		Action:       action,
+		Dependencies: []string{"z"},
+	}})
+	require.EqualError(t, err, `step "step a" depends on unknown step "z"`)
+
+	err = common.RunSteps(ctx, []common.Step{{
+		Name:         "a",
+		Description:  "step a",
+		Action:       action,
+		Dependencies: []string{"b"},
+	}, {
+		Name:         "b",
+		Description:  "step b",
+		Action:       action,
+		Dependencies: []string{"a"},
+	}})
+	require.EqualError(t, err, "steps have circular dependencies")
+}
+
+func TestStepsProgress(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_PROGRESS_DIRECTORY", t.TempDir())
+
+	progress := common.NewProgress(common.NewDeterministicIdentifier("progress"))
+
+	var events []string
+	record := func(event string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			events = append(events, event)
+			return err
+		}
+	}
+
+	steps := common.Sequence([]common.Step{{
+		Name:     "a",
+		Action:   record("create a", nil),
+		Rollback: record("delete a", nil),
+		Resume:   record("read a", nil),
+	}, {
+		Name:     "b",
+		Action:   record("create b", nil),
+		Rollback: record("delete b", nil),
+	}, {
+		Name:     "c",
+		Action:   record("create c", nil),
+		Rollback: record("delete c", nil),
+		Resume:   record("read c", nil),
+	}, {
+		Name:   "d",
+		Action: record("create d", errors.New("some error")),
+		Resume: record("read d", nil),
+	}})
+
+	// Step a is kept as progress instead of being rolled back, but step c
+	// depends on step b, which isn't resumable.
+	err := common.RunStepsWithProgress(ctx, steps, progress)
+	require.EqualError(t, err, "some error; kept completed steps: a")
+	var progressErr *common.ProgressError
+	require.ErrorAs(t, err, &progressErr)
+	require.Equal(t, []string{"create a", "create b", "create c", "create d", "delete c", "delete b"}, events)
+	completed, err := progress.Load()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, completed)
+
+	// Resuming reads step a instead of creating it; progress is cleared on success.
+	events = nil
+	steps[3].Action = record("create d", nil)
+	err = common.RunStepsWithProgress(ctx, steps, progress)
+	require.NoError(t, err)
+	require.Equal(t, []string{"read a", "create b", "create c", "create d"}, events)
+	require.False(t, progress.Exists())
+
+	// Steps that can't be rolled back are kept too.
+	events = nil
+	steps[1].Rollback = record("delete b", errors.New("rollback error"))
+	steps[3].Action = record("create d", errors.New("some error"))
+	err = common.RunStepsWithProgress(ctx, steps, progress)
+	require.EqualError(t, err, "some error; rollback failed: rollback error")
+	require.Equal(t, []string{"create a", "create b", "create c", "create d", "delete c", "delete b"}, events)
+	completed, err = progress.Load()
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, completed)
+}
+
+func TestProgressWithoutCacheDirectory(t *testing.T) {
+	t.Setenv("TPI_PROGRESS_DIRECTORY", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "")
+	if _, err := os.UserCacheDir(); err == nil {
+		t.Skip("cache directory available")
+	}
+
+	identifier := common.NewDeterministicIdentifier("progress")
+	progress := common.NewProgress(identifier)
+	require.Equal(t, filepath.Join(os.TempDir(), "tpi-progress", identifier.Long()+".json"), progress.Path)
+	require.NoError(t, common.DeleteProgress(identifier))
+}
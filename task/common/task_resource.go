@@ -0,0 +1,35 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// TaskResource describes an existing cloud resource named after a task
+// identifier, as found when listing the resources of a provider.
+type TaskResource struct {
+	Identifier Identifier
+	// Type is the kind of resource, with the same names used by PlannedResource.
+	Type string
+	Name string
+	// Created is the creation time of the resource, or zero if unknown.
+	Created time.Time
+	// Tags holds the tags or labels of the resource, or nil if unsupported.
+	Tags map[string]string
+	// Delete deletes the resource.
+	Delete func(ctx context.Context) error
+}
+
+// TaskIdentifiers returns the distinct task identifiers of the given
+// resources, in order of appearance.
+func TaskIdentifiers(resources []TaskResource) []Identifier {
+	seen := map[Identifier]bool{}
+	ids := []Identifier{}
+	for _, resource := range resources {
+		if !seen[resource.Identifier] {
+			seen[resource.Identifier] = true
+			ids = append(ids, resource.Identifier)
+		}
+	}
+	return ids
+}
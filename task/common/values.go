@@ -2,8 +2,10 @@ package common
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,19 +23,240 @@ const (
 	SpotEnabled  Spot = 0
 )
 
-type Status map[StatusCode]int
+// String describes the spot pricing policy in a human-readable way.
+func (s Spot) String() string {
+	switch {
+	case s < 0:
+		return "disabled"
+	case s == 0:
+		return "auto"
+	default:
+		return fmt.Sprintf("%g USD/h", float64(s))
+	}
+}
 
-type StatusCode string
+// Status holds the state of every machine of a task.
+type Status []MachineStatus
+
+// Phase describes the lifecycle stage of a task machine.
+type Phase string
 
 const (
-	StatusCodeActive    StatusCode = "running"
-	StatusCodeSucceeded StatusCode = "succeeded"
-	StatusCodeFailed    StatusCode = "failed"
+	PhaseQueued       Phase = "queued"
+	PhaseProvisioning Phase = "provisioning"
+	PhaseRunning      Phase = "running"
+	PhaseSucceeded    Phase = "succeeded"
+	PhaseFailed       Phase = "failed"
+	PhasePreempted    Phase = "preempted"
+	PhaseTimedOut     Phase = "timed-out"
 )
 
+// Finished reports whether the phase is final.
+func (p Phase) Finished() bool {
+	switch p {
+	case PhaseSucceeded, PhaseFailed, PhasePreempted, PhaseTimedOut:
+		return true
+	}
+	return false
+}
+
+// MachineStatus describes the state of a single task machine.
+type MachineStatus struct {
+	// Machine is the provider-specific machine identifier: instance id,
+	// virtual machine name, pod name, etc.
+	Machine  string
+	Phase    Phase
+	Started  time.Time
+	Finished time.Time
+	// ExitCode is the exit code of the task script, if it has exited.
+	// Scripts killed by a signal are reported as 128+signal, like shells do.
+	ExitCode *int
+	// Result is the systemd service result of the task script: success,
+	// exit-code, signal, core-dump, timeout, oom-kill, etc., or preempted for
+	// spot machines reclaimed by the cloud provider.
+	Result  string
+	Address net.IP
+	// Preemptions is the number of preemption notices the machine received;
+	// machines that keep their identity when recreated can receive several.
+	Preemptions int
+}
+
+// ExitStatus describes how the task script terminated on a given machine.
+type ExitStatus struct {
+	Machine string
+	Code    int
+	Result  string
+}
+
+// ResultPreempted is the result reported by machines whose task script was
+// interrupted because the cloud provider reclaimed the spot machine.
+const ResultPreempted = "preempted"
+
+// ExitStatuses returns the exit status of every machine whose script terminated;
+// preempted machines are left out, as their work continues on other machines.
+func (s Status) ExitStatuses() []ExitStatus {
+	var result []ExitStatus
+	for _, machine := range s {
+		if machine.ExitCode == nil && machine.Result == "" || machine.Result == ResultPreempted {
+			continue
+		}
+		status := ExitStatus{
+			Machine: machine.Machine,
+			Code:    -1,
+			Result:  machine.Result,
+		}
+		if machine.ExitCode != nil {
+			status.Code = *machine.ExitCode
+		}
+		result = append(result, status)
+	}
+	return result
+}
+
+// ExitCodeTimeout is the exit code used for timed out tasks, like timeout(1).
+const ExitCodeTimeout = 124
+
+// ExitCode summarizes a list of exit statuses as a single exit code: the first
+// non-zero script exit code, ExitCodeTimeout if any machine timed out, or 0.
+func ExitCode(statuses []ExitStatus) int {
+	for _, status := range statuses {
+		if status.Result == "timeout" {
+			return ExitCodeTimeout
+		}
+	}
+	for _, status := range statuses {
+		if status.Code != 0 {
+			if status.Code < 0 {
+				return 1
+			}
+			return status.Code
+		}
+	}
+	return 0
+}
+
+// ExitCode returns the exit code of a finished task: the one summarizing the
+// exit statuses of its machines, or 1 for tasks with failed or timed out
+// machines that didn't report any.
+func (s Status) ExitCode() int {
+	code := ExitCode(s.ExitStatuses())
+	if code == 0 && s.Count(PhaseFailed, PhaseTimedOut) > 0 {
+		code = 1
+	}
+	return code
+}
+
+// Count returns the number of machines in any of the given phases.
+func (s Status) Count(phases ...Phase) int {
+	count := 0
+	for _, machine := range s {
+		for _, phase := range phases {
+			if machine.Phase == phase {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// Summary returns the phase of a task expecting the given number of machines:
+// succeeded when enough of them succeeded, failed when any of them failed or
+// timed out, running when enough of them are running, and queued otherwise.
+func (s Status) Summary(parallelism int) Phase {
+	result := PhaseQueued
+
+	if s.Count(PhaseSucceeded) >= parallelism {
+		result = PhaseSucceeded
+	}
+	if s.Count(PhaseFailed, PhaseTimedOut) > 0 {
+		result = PhaseFailed
+	}
+	if s.Count(PhaseRunning) >= parallelism {
+		result = PhaseRunning
+	}
+
+	return result
+}
+
 type Size struct {
 	Storage int
+	// Machine holds a machine type or a comma-separated list of acceptable
+	// machine types, in order of preference.
+	Machine string
+}
+
+// Machines returns the acceptable machine types, in order of preference.
+func (s Size) Machines() []string {
+	var machines []string
+	for _, machine := range strings.Split(s.Machine, ",") {
+		if machine = strings.TrimSpace(machine); machine != "" {
+			machines = append(machines, machine)
+		}
+	}
+
+	if len(machines) == 0 {
+		return []string{s.Machine}
+	}
+	return machines
+}
+
+// Architecture is the processor architecture of a machine, named like the
+// GOARCH values of release binaries.
+type Architecture string
+
+const (
+	ArchitectureAMD64 Architecture = "amd64"
+	ArchitectureARM64 Architecture = "arm64"
+)
+
+// LogStreamCombined identifies log lines where the standard output and
+// standard error of the task script are interleaved.
+const LogStreamCombined = "combined"
+
+// LogLine is a single line of task script output.
+type LogLine struct {
 	Machine string
+	Time    time.Time
+	Stream  string
+	Text    string
+}
+
+// LogCursor records how far the logs of every machine have been read.
+type LogCursor map[string]LogPosition
+
+// LogPosition is the position of the last line read from the logs of a
+// machine: a byte offset for logs in storage, or the timestamp of the line
+// for logs that can only be resumed from a point in time.
+type LogPosition struct {
+	Offset int64
+	Time   time.Time
+}
+
+// Copy returns a copy of the cursor that can be modified independently.
+func (c LogCursor) Copy() LogCursor {
+	result := LogCursor{}
+	for machine, position := range c {
+		result[machine] = position
+	}
+	return result
+}
+
+// ParseLogLine parses a line with a leading RFC 3339 timestamp, as written to
+// task logs. Lines without a valid timestamp are returned verbatim.
+func ParseLogLine(machine, line string) LogLine {
+	result := LogLine{
+		Machine: machine,
+		Stream:  LogStreamCombined,
+		Text:    line,
+	}
+	if timestamp, text, ok := strings.Cut(line, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+			result.Time = t
+			result.Text = text
+		}
+	}
+	return result
 }
 
 type Event struct {
@@ -42,6 +265,23 @@ type Event struct {
 	Description []string
 }
 
+// EventBudgetExceeded is the code of the event recorded when the accumulated
+// spend of a task exceeds its maximum cost.
+const EventBudgetExceeded = "budget-exceeded"
+
+// EventRegionFallback is the code of the event recorded when a task is
+// recreated in the next region of its list because of a lack of capacity.
+const EventRegionFallback = "region-fallback"
+
+// EventMachineFallback is the code of the event recorded when a task is
+// recreated with the next machine type of its list because of a lack of
+// capacity.
+const EventMachineFallback = "machine-fallback"
+
+// EventPreempted is the code of the event recorded when a spot machine
+// receives a preemption notice from the cloud provider.
+const EventPreempted = "preempted"
+
 // RemoteStorage contains the configuration for the cloud storage container
 // used by the task.
 type RemoteStorage struct {
@@ -61,6 +301,9 @@ type Task struct {
 	PermissionSet string
 	Spot          Spot
 	Parallelism   uint16
+	// MaxCost is the maximum accumulated spend in USD; the task is stopped
+	// when it's exceeded. Zero means unlimited.
+	MaxCost float64
 
 	RemoteStorage *RemoteStorage
 
@@ -69,6 +312,13 @@ type Task struct {
 	Events    []Event
 }
 
+// Partial reports whether the task specification lacks a script, like the
+// ones rebuilt from the identifier of an existing task to read, stop or delete
+// it; their missing attributes come from the task manifest.
+func (t Task) Partial() bool {
+	return t.Environment.Script == ""
+}
+
 // Firewall
 type Firewall struct {
 	Ingress FirewallRule
@@ -83,6 +333,35 @@ type FirewallRule struct {
 	Ports *[]uint16
 }
 
+// String describes the firewall rule in a human-readable way.
+func (r FirewallRule) String() string {
+	ports := "all ports and protocols"
+	if r.Ports != nil {
+		if len(*r.Ports) == 0 {
+			return "none"
+		}
+		var numbers []string
+		for _, port := range *r.Ports {
+			numbers = append(numbers, strconv.Itoa(int(port)))
+		}
+		ports = "tcp/udp ports " + strings.Join(numbers, ",")
+	}
+
+	nets := "any address"
+	if r.Nets != nil {
+		if len(*r.Nets) == 0 {
+			return "none"
+		}
+		var cidrs []string
+		for _, n := range *r.Nets {
+			cidrs = append(cidrs, n.String())
+		}
+		nets = strings.Join(cidrs, ",")
+	}
+
+	return fmt.Sprintf("%s, %s", ports, nets)
+}
+
 type Environment struct {
 	Image        string
 	Script       string
@@ -91,6 +370,88 @@ type Environment struct {
 	Directory    string
 	DirectoryOut string
 	ExcludeList  []string
+	// Inputs lists directories from the storage of other tasks to copy into
+	// the working directory before the task starts.
+	Inputs []Input
+	// Queue holds the work items of tasks in queue mode.
+	Queue Queue
+	// PerMachineOutput makes every machine sync its working directory to
+	// data/machines/<index> in the task storage instead of data, so parallel
+	// machines don't overwrite each other's outputs.
+	PerMachineOutput bool
+	// OutputMerge is how the outputs of every machine are downloaded when
+	// PerMachineOutput is set.
+	OutputMerge MergePolicy
+	// Transfer tunes the transfers between the working directory and the
+	// task storage.
+	Transfer Transfer
+}
+
+// Transfer describes how files are transferred to and from the task storage.
+type Transfer struct {
+	// Bundle packs the working directory into compressed archives before
+	// uploading it, and the outputs before downloading them, which is much
+	// faster than transferring many small files one by one.
+	Bundle bool
+	// Transfers is the number of files transferred in parallel; 0 keeps the
+	// rclone default.
+	Transfers int
+	// Checkers is the number of files checked in parallel; 0 keeps the
+	// rclone default.
+	Checkers int
+	// BandwidthLimit limits the transfer bandwidth, with the syntax of the
+	// rclone --bwlimit flag, e.g. 10M; empty means unlimited.
+	BandwidthLimit string
+}
+
+// MergePolicy describes how the outputs of parallel machines are combined
+// when downloading them.
+type MergePolicy string
+
+const (
+	// MergeNone downloads the output of every machine to machines/<index> in
+	// the working directory.
+	MergeNone MergePolicy = ""
+	// MergeNewest merges the outputs into the working directory, keeping the
+	// most recently modified copy of files written by several machines.
+	MergeNewest MergePolicy = "newest"
+	// MergeStrict merges the outputs into the working directory, failing when
+	// several machines wrote different contents to the same file.
+	MergeStrict MergePolicy = "strict"
+)
+
+// Input describes a directory copied into the working directory of a task.
+type Input struct {
+	// Source is the rclone connection string of the directory to copy.
+	Source string
+	// Destination is the path of the copy, relative to the working directory.
+	Destination string
+}
+
+// Queue describes the work items of a task in queue mode, where machines run
+// the script once for every item they claim, with the item in TPI_WORK_ITEM,
+// until every item has been run.
+type Queue struct {
+	// File is a local file with a work item on every line.
+	File string
+	// Prefix is an rclone connection string; every object under it is a work
+	// item, named after its path relative to the prefix.
+	Prefix string
+	// Retries is the number of times items whose script fails go back to the
+	// queue before they're marked as failed.
+	Retries int
+}
+
+// Enabled reports whether the task runs in queue mode.
+func (q Queue) Enabled() bool {
+	return q.File != "" || q.Prefix != ""
+}
+
+// QueueStatus counts the work items of a task in queue mode by state.
+type QueueStatus struct {
+	Done    int
+	Failed  int
+	Pending int
 }
 
 type Variables map[string]*string
@@ -0,0 +1,165 @@
+package common_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+)
+
+func TestExitCode(t *testing.T) {
+	code := func(value int) *int { return &value }
+
+	tests := []struct {
+		description string
+		status      common.Status
+		expected    int
+	}{{
+		description: "no machines",
+		status:      common.Status{},
+		expected:    0,
+	}, {
+		description: "all machines succeeded",
+		status: common.Status{
+			{Machine: "a", ExitCode: code(0), Result: "success"},
+			{Machine: "b", Phase: common.PhaseRunning},
+		},
+		expected: 0,
+	}, {
+		description: "script failed",
+		status: common.Status{
+			{Machine: "a", ExitCode: code(0), Result: "success"},
+			{Machine: "b", ExitCode: code(1), Result: "exit-code"},
+		},
+		expected: 1,
+	}, {
+		description: "script killed",
+		status: common.Status{
+			{Machine: "a", ExitCode: code(137), Result: "oom-kill"},
+		},
+		expected: 137,
+	}, {
+		description: "script timed out",
+		status: common.Status{
+			{Machine: "a", ExitCode: code(1), Result: "exit-code"},
+			{Machine: "b", ExitCode: code(143), Result: "timeout"},
+		},
+		expected: common.ExitCodeTimeout,
+	}, {
+		description: "unknown exit code",
+		status: common.Status{
+			{Machine: "a", Result: "exit-code"},
+		},
+		expected: 1,
+	}, {
+		description: "machine preempted",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhasePreempted, Result: common.ResultPreempted},
+			{Machine: "b", ExitCode: code(0), Result: "success"},
+		},
+		expected: 0,
+	}, {
+		description: "machine failed without a status report",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhaseFailed},
+		},
+		expected: 1,
+	}}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require.Equal(t, test.expected, test.status.ExitCode())
+		})
+	}
+}
+
+func TestStatusSummary(t *testing.T) {
+	tests := []struct {
+		description string
+		status      common.Status
+		parallelism int
+		expected    common.Phase
+	}{{
+		description: "no machines",
+		status:      common.Status{},
+		parallelism: 1,
+		expected:    common.PhaseQueued,
+	}, {
+		description: "some machines running",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhaseRunning},
+			{Machine: "b", Phase: common.PhaseProvisioning},
+		},
+		parallelism: 2,
+		expected:    common.PhaseQueued,
+	}, {
+		description: "all machines running",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhaseRunning},
+			{Machine: "b", Phase: common.PhaseRunning},
+		},
+		parallelism: 2,
+		expected:    common.PhaseRunning,
+	}, {
+		description: "all machines succeeded",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhaseSucceeded},
+		},
+		parallelism: 1,
+		expected:    common.PhaseSucceeded,
+	}, {
+		description: "machine timed out",
+		status: common.Status{
+			{Machine: "a", Phase: common.PhaseSucceeded},
+			{Machine: "b", Phase: common.PhaseTimedOut},
+		},
+		parallelism: 2,
+		expected:    common.PhaseFailed,
+	}}
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require.Equal(t, test.expected, test.status.Summary(test.parallelism))
+		})
+	}
+}
+
+func TestFirewallRuleString(t *testing.T) {
+	_, network, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		description string
+		rule        common.FirewallRule
+		expected    string
+	}{{
+		description: "unspecified rule allows everything",
+		rule:        common.FirewallRule{},
+		expected:    "all ports and protocols, any address",
+	}, {
+		description: "specified ports and networks",
+		rule: common.FirewallRule{
+			Ports: &[]uint16{22, 80},
+			Nets:  &[]net.IPNet{*network},
+		},
+		expected: "tcp/udp ports 22,80, 10.0.0.0/8",
+	}, {
+		description: "empty ports allow nothing",
+		rule: common.FirewallRule{
+			Ports: &[]uint16{},
+		},
+		expected: "none",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			require.Equal(t, test.expected, test.rule.String())
+		})
+	}
+}
+
+func TestSpotString(t *testing.T) {
+	require.Equal(t, "disabled", common.SpotDisabled.String())
+	require.Equal(t, "auto", common.SpotEnabled.String())
+	require.Equal(t, "0.5 USD/h", common.Spot(0.5).String())
+}
@@ -0,0 +1,16 @@
+package task
+
+import "terraform-provider-iterative/task/common"
+
+// Unregister removes the provider registered with the given name and its
+// aliases, so tests can clean up after themselves.
+func Unregister(name common.Provider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	for key, provider := range providers {
+		if provider.Name == name {
+			delete(providers, key)
+		}
+	}
+}
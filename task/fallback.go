@@ -0,0 +1,355 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/0x2b3bfa0/logrusctx"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+// capacityError matches the errors reported by cloud providers when they lack
+// capacity for the requested machine type.
+var capacityError = regexp.MustCompile(`InsufficientInstanceCapacity|ZONE_RESOURCE_POOL_EXHAUSTED|SkuNotAvailable|AllocationFailed`)
+
+// constructor creates the task for the given cloud; it's called once per
+// placement the task is tried in.
+type constructor func(ctx context.Context, cloud common.Cloud, task common.Task) (Task, error)
+
+// placement is a combination of region and machine type to run a task on.
+type placement struct {
+	region  common.Region
+	machine string
+}
+
+// fallback wraps a task with an ordered list of placements: when the current
+// one lacks capacity and none of the machines started yet, the task is deleted
+// and recreated with the next one. Tasks are looked up in every region, so a
+// later process finds them wherever they were moved to, along with the events
+// of moving them, which are kept in the task storage.
+type fallback struct {
+	Task
+	cloud      common.Cloud
+	task       common.Task
+	construct  constructor
+	placements []placement
+	// index is the position of the current placement in placements.
+	index    int
+	resolved bool
+	events   []common.Event
+}
+
+// newFallback creates a task that tries the regions of cloud in order and,
+// unless the provider can use several machine types at once, every machine
+// type of task in each region.
+func newFallback(ctx context.Context, cloud common.Cloud, task common.Task, machineTypes bool, construct constructor) (Task, error) {
+	f := &fallback{
+		cloud:     cloud,
+		task:      task,
+		construct: construct,
+	}
+
+	machines := []string{task.Size.Machine}
+	if !machineTypes {
+		machines = task.Size.Machines()
+	}
+	for _, region := range append([]common.Region{cloud.Region}, cloud.FallbackRegions...) {
+		for _, machine := range machines {
+			f.placements = append(f.placements, placement{region: region, machine: machine})
+		}
+	}
+
+	t, err := f.newTask(ctx, 0, task)
+	if err != nil {
+		return nil, err
+	}
+	f.Task = t
+	return f, nil
+}
+
+// newTask creates the task for the placement with the given index.
+func (f *fallback) newTask(ctx context.Context, index int, task common.Task) (Task, error) {
+	placement := f.placements[index]
+
+	cloud := f.cloud
+	cloud.Region = placement.region
+	cloud.FallbackRegions = nil
+	task.Size.Machine = placement.machine
+
+	overrides := map[string]string{
+		"TPI_REGION":  string(placement.region),
+		"TPI_MACHINE": placement.machine,
+	}
+	variables := common.Variables{}
+	for name, value := range task.Environment.Variables {
+		if override, ok := overrides[name]; ok {
+			value = &override
+		}
+		variables[name] = value
+	}
+	task.Environment.Variables = variables
+
+	// Providers fill the storage settings with region-specific defaults.
+	if task.RemoteStorage != nil {
+		storage := *task.RemoteStorage
+		storage.Config = map[string]string{}
+		for key, value := range task.RemoteStorage.Config {
+			storage.Config[key] = value
+		}
+		task.RemoteStorage = &storage
+	}
+
+	return f.construct(ctx, cloud, task)
+}
+
+func (f *fallback) Create(ctx context.Context) error {
+	for {
+		err := f.Task.Create(ctx)
+		if err == nil || f.index == len(f.placements)-1 || !capacityError.MatchString(err.Error()) {
+			f.resolved = err == nil
+			if err == nil && len(f.events) > 0 {
+				f.recordEvents(ctx)
+			}
+			return err
+		}
+
+		// Failed creations are rolled back, unless the rollback itself failed;
+		// steps kept for resuming are deleted before moving on.
+		var rollbackError *common.RollbackError
+		if errors.As(err, &rollbackError) {
+			return err
+		}
+		var progressError *common.ProgressError
+		if errors.As(err, &progressError) {
+			if err := f.Task.Delete(ctx); err != nil {
+				return err
+			}
+		}
+
+		if err := f.move(ctx, err.Error()); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *fallback) Read(ctx context.Context) error {
+	if err := f.resolve(ctx); err != nil {
+		return err
+	}
+
+	// Partial specifications, like the ones of leo read, can't recreate the
+	// task; the manifest doesn't help either, as it has its secrets redacted.
+	if f.index == len(f.placements)-1 || f.task.Partial() {
+		return nil
+	}
+
+	var reason string
+	for _, event := range f.Task.Events(ctx) {
+		if text := event.Code + " " + strings.Join(event.Description, " "); capacityError.MatchString(text) {
+			reason = text
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+
+	status, err := f.Task.Status(ctx)
+	if err != nil {
+		return err
+	}
+	// Tasks with running machines stay where they are.
+	for _, machine := range status {
+		if !machine.Started.IsZero() {
+			return nil
+		}
+	}
+
+	current := f.placements[f.index]
+	logrusctx.Warnf(ctx, "Lack of capacity for %s in %s: %s", current.machine, current.region, reason)
+
+	// There are no outputs to download before any machine starts.
+	teardown := f.task
+	teardown.Environment.DirectoryOut = ""
+	t, err := f.newTask(ctx, f.index, teardown)
+	if err != nil {
+		return err
+	}
+	if err := t.Delete(ctx); err != nil {
+		return err
+	}
+
+	if err := f.move(ctx, reason); err != nil {
+		return err
+	}
+	return f.Create(ctx)
+}
+
+// move switches to the next placement and records an event for it.
+func (f *fallback) move(ctx context.Context, reason string) error {
+	t, err := f.newTask(ctx, f.index+1, f.task)
+	if err != nil {
+		return err
+	}
+
+	from, to := f.placements[f.index], f.placements[f.index+1]
+	event := common.Event{
+		Time:        time.Now().UTC(),
+		Code:        common.EventMachineFallback,
+		Description: []string{from.machine, to.machine, reason},
+	}
+	if from.region != to.region {
+		event.Code = common.EventRegionFallback
+		event.Description = []string{string(from.region), string(to.region), reason}
+	}
+	logrusctx.Infof(ctx, "Moving task to %s in %s", to.machine, to.region)
+
+	f.events = append(f.events, event)
+	f.Task = t
+	f.index++
+	return nil
+}
+
+// resolve reads the task, looking it up in the other regions when it doesn't
+// exist in the current one, and switches to the placement it was created with.
+func (f *fallback) resolve(ctx context.Context) error {
+	if f.resolved {
+		return f.Task.Read(ctx)
+	}
+
+	err := f.Task.Read(ctx)
+	if errors.Is(err, common.NotFoundError) {
+		err = f.search(ctx, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.resolved = true
+	if err := f.locate(ctx); err != nil {
+		return err
+	}
+	f.restoreEvents(ctx)
+	return nil
+}
+
+// search looks the task up in the regions other than the current one,
+// returning notFound if it doesn't exist in any of them.
+func (f *fallback) search(ctx context.Context, notFound error) error {
+	searched := map[common.Region]bool{f.placements[f.index].region: true}
+	for index, placement := range f.placements {
+		if searched[placement.region] {
+			continue
+		}
+		searched[placement.region] = true
+
+		t, err := f.newTask(ctx, index, f.task)
+		if err != nil {
+			return err
+		}
+		if err := t.Read(ctx); errors.Is(err, common.NotFoundError) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		logrusctx.Infof(ctx, "Found task in fallback region %s", placement.region)
+		f.Task = t
+		f.index = index
+		return nil
+	}
+
+	return notFound
+}
+
+// locate switches to the placement of the current region with the machine
+// type recorded in the task manifest, if it's a different one.
+func (f *fallback) locate(ctx context.Context) error {
+	manifest, err := f.Task.Manifest(ctx)
+	if errors.Is(err, common.NotFoundError) || errors.Is(err, common.NotImplementedError) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	current := f.placements[f.index]
+	for index, placement := range f.placements {
+		if index == f.index || placement.region != current.region || placement.machine != manifest.Task.Size.Machine {
+			continue
+		}
+
+		t, err := f.newTask(ctx, index, f.task)
+		if err != nil {
+			return err
+		}
+		if err := t.Read(ctx); err != nil {
+			return err
+		}
+
+		f.Task = t
+		f.index = index
+		break
+	}
+
+	return nil
+}
+
+// recordEvents writes the events of moving the task to its storage, so other
+// processes can report them.
+func (f *fallback) recordEvents(ctx context.Context) {
+	remote, err := f.Task.Storage(ctx)
+	if errors.Is(err, common.NotImplementedError) {
+		return
+	} else if err == nil {
+		err = machine.WriteEvents(ctx, remote, f.events)
+	}
+	if err != nil {
+		logrusctx.Warnf(ctx, "Failed to record fallback events: %v", err)
+	}
+}
+
+// restoreEvents reads the events of moving the task recorded by the process
+// that moved it.
+func (f *fallback) restoreEvents(ctx context.Context) {
+	if len(f.events) > 0 {
+		return
+	}
+	remote, err := f.Task.Storage(ctx)
+	if errors.Is(err, common.NotImplementedError) {
+		return
+	} else if err == nil {
+		f.events, err = machine.ReadEvents(ctx, remote)
+	}
+	if err != nil {
+		logrusctx.Warnf(ctx, "Failed to read fallback events: %v", err)
+	}
+}
+
+func (f *fallback) Update(ctx context.Context) error {
+	if err := f.resolve(ctx); err != nil {
+		return err
+	}
+	return f.Task.Update(ctx)
+}
+
+func (f *fallback) Stop(ctx context.Context) error {
+	if err := f.resolve(ctx); err != nil {
+		return err
+	}
+	return f.Task.Stop(ctx)
+}
+
+func (f *fallback) Delete(ctx context.Context) error {
+	// Tasks that can't be found anywhere are deleted from the current region,
+	// which cleans up the remains of failed creations.
+	_ = f.resolve(ctx)
+	return f.Task.Delete(ctx)
+}
+
+func (f *fallback) Events(ctx context.Context) []common.Event {
+	return append(append([]common.Event{}, f.Task.Events(ctx)...), f.events...)
+}
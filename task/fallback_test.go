@@ -0,0 +1,185 @@
+package task_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type fallbackTestTask struct {
+	task.Task
+	region  common.Region
+	machine string
+	regions map[common.Region]*fallbackTestRegion
+}
+
+// fallbackTestRegion holds the state of the task in a single region.
+type fallbackTestRegion struct {
+	exists   bool
+	deleted  bool
+	machine  string
+	events   []common.Event
+	variable string
+	storage  string
+}
+
+func (f *fallbackTestTask) state() *fallbackTestRegion {
+	if f.regions[f.region] == nil {
+		f.regions[f.region] = &fallbackTestRegion{}
+	}
+	return f.regions[f.region]
+}
+
+func (f *fallbackTestTask) Create(ctx context.Context) error {
+	f.state().exists = true
+	f.state().machine = f.machine
+	f.state().events = nil
+	return nil
+}
+func (f *fallbackTestTask) Read(ctx context.Context) error {
+	if !f.state().exists {
+		return common.NotFoundError
+	}
+	return nil
+}
+func (f *fallbackTestTask) Delete(ctx context.Context) error {
+	f.state().exists = false
+	f.state().deleted = true
+	return nil
+}
+func (f *fallbackTestTask) Events(ctx context.Context) []common.Event {
+	return f.state().events
+}
+func (f *fallbackTestTask) Status(ctx context.Context) (common.Status, error) {
+	return common.Status{}, nil
+}
+func (f *fallbackTestTask) Storage(ctx context.Context) (string, error) {
+	return f.state().storage, nil
+}
+func (f *fallbackTestTask) Manifest(ctx context.Context) (*common.Manifest, error) {
+	return &common.Manifest{Task: common.Task{Size: common.Size{Machine: f.state().machine}}}, nil
+}
+
+// registerFallbackTest registers a fake provider keeping the state of the task
+// in every region in regions, for the duration of the test.
+func registerFallbackTest(test *testing.T, name common.Provider, regions map[common.Region]*fallbackTestRegion) {
+	test.Cleanup(func() { task.Unregister(name) })
+	task.Register(task.Provider{
+		Name: name,
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, t common.Task) (task.Task, error) {
+			fake := &fallbackTestTask{region: cloud.Region, machine: t.Size.Machine, regions: regions}
+			if fake.state().storage == "" {
+				fake.state().storage = test.TempDir()
+			}
+			if variable := t.Environment.Variables["TPI_REGION"]; variable != nil {
+				fake.state().variable = *variable
+			}
+			return fake, nil
+		},
+		List: func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+			return nil, nil
+		},
+	})
+}
+
+func TestRegionFallback(t *testing.T) {
+	ctx := context.Background()
+
+	regions := map[common.Region]*fallbackTestRegion{}
+	registerFallbackTest(t, "fallback-test", regions)
+
+	region, fallbackRegions := common.ParseRegions("fallback-test", "first, second,third")
+	require.Equal(t, common.Region("first"), region)
+	require.Equal(t, []common.Region{"second", "third"}, fallbackRegions)
+
+	selector, fallbackSelectors := common.ParseRegions(common.ProviderK8S, "foo=bar,goo=baz")
+	require.Equal(t, common.Region("foo=bar,goo=baz"), selector)
+	require.Empty(t, fallbackSelectors)
+
+	cloud := common.Cloud{Provider: "fallback-test", Region: region, FallbackRegions: fallbackRegions}
+	cfg := common.Task{Environment: common.Environment{
+		Script:    "#!/bin/sh",
+		Variables: common.Variables{"TPI_REGION": nil},
+	}}
+	identifier := common.NewRandomIdentifier("")
+
+	tsk, err := task.New(ctx, cloud, identifier, cfg)
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+	require.True(t, regions["first"].exists)
+	require.Equal(t, "first", regions["first"].variable)
+
+	// Capacity failures move the task to the next region.
+	regions["first"].events = []common.Event{{Code: "Failed", Description: []string{"InsufficientInstanceCapacity: no capacity"}}}
+	require.NoError(t, tsk.Read(ctx))
+	require.True(t, regions["first"].deleted)
+	require.True(t, regions["second"].exists)
+	require.Equal(t, "second", regions["second"].variable)
+
+	events := tsk.Events(ctx)
+	require.Len(t, events, 1)
+	require.Equal(t, common.EventRegionFallback, events[0].Code)
+	require.Equal(t, []string{"first", "second"}, events[0].Description[:2])
+
+	// Other processes find the task in the region it was moved to, along
+	// with the events of moving it.
+	tsk, err = task.New(ctx, cloud, identifier, cfg)
+	require.NoError(t, err)
+	require.NoError(t, tsk.Read(ctx))
+	require.Equal(t, events, tsk.Events(ctx))
+	require.NoError(t, tsk.Delete(ctx))
+	require.False(t, regions["second"].exists)
+	require.Nil(t, regions["third"])
+}
+
+func TestMachineFallback(t *testing.T) {
+	ctx := context.Background()
+
+	regions := map[common.Region]*fallbackTestRegion{}
+	registerFallbackTest(t, "machine-fallback-test", regions)
+
+	cloud := common.Cloud{Provider: "machine-fallback-test", Region: "region"}
+	cfg := common.Task{
+		Size:        common.Size{Machine: "m+t4, m+a10g"},
+		Environment: common.Environment{Script: "#!/bin/sh"},
+	}
+	identifier := common.NewRandomIdentifier("")
+
+	tsk, err := task.New(ctx, cloud, identifier, cfg)
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+	require.Equal(t, "m+t4", regions["region"].machine)
+
+	regions["region"].events = []common.Event{{Code: "ZONE_RESOURCE_POOL_EXHAUSTED"}}
+	require.NoError(t, tsk.Read(ctx))
+	require.True(t, regions["region"].exists)
+	require.Equal(t, "m+a10g", regions["region"].machine)
+
+	events := tsk.Events(ctx)
+	require.Len(t, events, 1)
+	require.Equal(t, common.EventMachineFallback, events[0].Code)
+	require.Equal(t, []string{"m+t4", "m+a10g"}, events[0].Description[:2])
+
+	// Other processes pick the machine type recorded in the manifest, so
+	// they don't move the task again on past capacity errors.
+	regions["region"].events = []common.Event{{Code: "ZONE_RESOURCE_POOL_EXHAUSTED"}}
+	tsk, err = task.New(ctx, cloud, identifier, cfg)
+	require.NoError(t, err)
+	require.NoError(t, tsk.Read(ctx))
+	require.Equal(t, "m+a10g", regions["region"].machine)
+	require.Equal(t, events, tsk.Events(ctx)[1:])
+
+	// Partial specifications, like the ones of leo read, never recreate the
+	// task.
+	regions["region"].machine = "m+t4"
+	regions["region"].deleted = false
+	tsk, err = task.New(ctx, cloud, identifier, common.Task{Size: cfg.Size})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Read(ctx))
+	require.Equal(t, "m+t4", regions["region"].machine)
+	require.False(t, regions["region"].deleted)
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// Orphan groups the resources of an incomplete task, like those left behind
+// by a failed deletion.
+type Orphan struct {
+	Identifier common.Identifier
+	// Resources lists the existing resources of the task, in creation order.
+	Resources []common.TaskResource
+	// Missing lists the required resource types that don't exist.
+	Missing []string
+}
+
+// FindOrphans returns the tasks that lack any of the resources the provider
+// creates for every task.
+func FindOrphans(ctx context.Context, cloud common.Cloud) ([]Orphan, error) {
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if provider.ListResources == nil {
+		return nil, fmt.Errorf("provider %#v doesn't support garbage collection", provider.Name)
+	}
+
+	cloud.Provider = provider.Name
+
+	resources, err := provider.ListResources(ctx, cloud)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []Orphan
+	for _, identifier := range common.TaskIdentifiers(resources) {
+		orphan := Orphan{Identifier: identifier}
+		types := map[string]bool{}
+		for _, resource := range resources {
+			if resource.Identifier == identifier {
+				orphan.Resources = append(orphan.Resources, resource)
+				types[resource.Type] = true
+			}
+		}
+		for _, required := range provider.RequiredResources {
+			if !types[required] {
+				orphan.Missing = append(orphan.Missing, required)
+			}
+		}
+		if len(orphan.Missing) > 0 {
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	return orphans, nil
+}
+
+// Created returns the creation time of the newest resource of the orphan, or
+// zero if none of them reports it.
+func (o Orphan) Created() time.Time {
+	var created time.Time
+	for _, resource := range o.Resources {
+		if resource.Created.After(created) {
+			created = resource.Created
+		}
+	}
+	return created
+}
+
+// HasTags reports whether any resource of the orphan has all the given tags;
+// resources of the same task share their tags, but not every resource type
+// supports them.
+func (o Orphan) HasTags(tags map[string]string) bool {
+	for _, resource := range o.Resources {
+		matches := true
+		for key, value := range tags {
+			if resource.Tags[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches && resource.Tags != nil {
+			return true
+		}
+	}
+	return len(tags) == 0
+}
+
+// Delete deletes the resources of the orphan in reverse creation order.
+func (o Orphan) Delete(ctx context.Context) error {
+	for index := len(o.Resources) - 1; index >= 0; index-- {
+		resource := o.Resources[index]
+		if err := resource.Delete(ctx); err != nil {
+			return fmt.Errorf("failed to delete %s %s: %w", resource.Type, resource.Name, err)
+		}
+	}
+	return common.DeleteProgress(o.Identifier)
+}
@@ -0,0 +1,74 @@
+package task_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+func TestFindOrphans(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_PROGRESS_DIRECTORY", t.TempDir())
+
+	var deleted []string
+	resource := func(identifier common.Identifier, resourceType string, created time.Time, tags map[string]string) common.TaskResource {
+		return common.TaskResource{
+			Identifier: identifier,
+			Type:       resourceType,
+			Name:       identifier.Long(),
+			Created:    created,
+			Tags:       tags,
+			Delete: func(ctx context.Context) error {
+				deleted = append(deleted, resourceType)
+				return nil
+			},
+		}
+	}
+
+	now := time.Now()
+	complete := common.NewDeterministicIdentifier("complete")
+	orphaned := common.NewDeterministicIdentifier("orphaned")
+	t.Cleanup(func() { task.Unregister("gc-test") })
+	task.Register(task.Provider{
+		Name: "gc-test",
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, t common.Task) (task.Task, error) {
+			return nil, common.NotImplementedError
+		},
+		List: func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+			return nil, nil
+		},
+		ListResources: func(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error) {
+			return []common.TaskResource{
+				resource(complete, "Bucket", now, nil),
+				resource(orphaned, "Bucket", now.Add(-2*time.Hour), nil),
+				resource(complete, "Group", now, nil),
+				resource(orphaned, "Template", now.Add(-time.Hour), map[string]string{"team": "ml"}),
+				resource(complete, "Template", now, nil),
+			}, nil
+		},
+		RequiredResources: []string{"Group", "Template"},
+	})
+
+	orphans, err := task.FindOrphans(ctx, common.Cloud{Provider: "gc-test"})
+	require.NoError(t, err)
+	require.Len(t, orphans, 1)
+
+	orphan := orphans[0]
+	require.Equal(t, orphaned, orphan.Identifier)
+	require.Equal(t, []string{"Group"}, orphan.Missing)
+	require.Equal(t, now.Add(-time.Hour), orphan.Created())
+	require.True(t, orphan.HasTags(nil))
+	require.True(t, orphan.HasTags(map[string]string{"team": "ml"}))
+	require.False(t, orphan.HasTags(map[string]string{"team": "web"}))
+
+	require.NoError(t, orphan.Delete(ctx))
+	require.Equal(t, []string{"Template", "Bucket"}, deleted)
+
+	_, err = task.FindOrphans(ctx, common.Cloud{Provider: "local"})
+	require.Error(t, err)
+}
@@ -31,3 +31,13 @@ func waitForOperation(ctx context.Context, timeout time.Duration, minimum time.D
 
 	return nil, errors.New("timed out waiting for operation")
 }
+
+// parseTimestamp parses the RFC 3339 timestamps returned by Google Cloud APIs,
+// returning the zero time for invalid ones.
+func parseTimestamp(timestamp string) time.Time {
+	result, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return result
+}
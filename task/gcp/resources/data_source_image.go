@@ -3,6 +3,7 @@ package resources
 import (
 	"context"
 	"errors"
+	"fmt"
 	"regexp"
 
 	"google.golang.org/api/compute/v1"
@@ -12,17 +13,20 @@ import (
 	"terraform-provider-iterative/task/gcp/client"
 )
 
-func NewImage(client *client.Client, identifier string) *Image {
+func NewImage(client *client.Client, identifier string, architecture common.Architecture) *Image {
 	return &Image{
-		client:     client,
-		Identifier: identifier,
+		client:       client,
+		Identifier:   identifier,
+		Architecture: architecture,
 	}
 }
 
 type Image struct {
 	client     *client.Client
 	Identifier string
-	Attributes struct {
+	// Architecture selects the variant of the image aliases.
+	Architecture common.Architecture
+	Attributes   struct {
 		SSHUser string
 	}
 	Resource *compute.Image
@@ -34,12 +38,23 @@ func (i *Image) Read(ctx context.Context) error {
 		i.Identifier = "ubuntu"
 	}
 	image := i.Identifier
-	images := map[string]string{
-		"ubuntu": "ubuntu@ubuntu-os-cloud/ubuntu-2004-lts",
-		"nvidia": "ubuntu@deeplearning-platform-release/common-cu113-ubuntu-2004",
+	images := map[common.Architecture]map[string]string{
+		common.ArchitectureAMD64: {
+			"ubuntu": "ubuntu@ubuntu-os-cloud/ubuntu-2004-lts",
+			"nvidia": "ubuntu@deeplearning-platform-release/common-cu113-ubuntu-2004",
+		},
+		common.ArchitectureARM64: {
+			"ubuntu": "ubuntu@ubuntu-os-cloud/ubuntu-2004-lts-arm64",
+		},
 	}
-	if val, ok := images[image]; ok {
+	architecture := i.Architecture
+	if architecture == "" {
+		architecture = common.ArchitectureAMD64
+	}
+	if val, ok := images[architecture][image]; ok {
 		image = val
+	} else if _, ok := images[common.ArchitectureAMD64][image]; ok {
+		return fmt.Errorf("image %s isn't available for %s machines", image, architecture)
 	}
 
 	match := regexp.MustCompile(`^([^@]+)@([^/]+)/([^/]+)$`).FindStringSubmatch(image)
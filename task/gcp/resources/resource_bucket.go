@@ -12,13 +12,20 @@ import (
 	"terraform-provider-iterative/task/gcp/client"
 )
 
-func ListBuckets(ctx context.Context, client *client.Client) ([]common.Identifier, error) {
-	ids := []common.Identifier{}
+func ListBuckets(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
 
 	page := func(buckets *storage.Buckets) error {
 		for _, bucket := range buckets.Items {
 			if id, err := common.ParseIdentifier(bucket.Name); err == nil {
-				ids = append(ids, id)
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "Bucket",
+					Name:       bucket.Name,
+					Created:    parseTimestamp(bucket.TimeCreated),
+					Tags:       bucket.Labels,
+					Delete:     NewBucket(client, id).Delete,
+				})
 			}
 		}
 		return nil
@@ -28,7 +35,7 @@ func ListBuckets(ctx context.Context, client *client.Client) ([]common.Identifie
 		return nil, err
 	}
 
-	return ids, nil
+	return result, nil
 }
 
 func NewBucket(client *client.Client, identifier common.Identifier) *Bucket {
@@ -65,6 +72,17 @@ func (b *Bucket) Create(ctx context.Context) error {
 }
 
 // Read verifies an existing gcp storage bucket.
+// Plan describes the bucket that Create would make.
+func (b *Bucket) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "Bucket",
+		Name: b.Identifier,
+		Attributes: map[string]string{
+			"location": b.client.Region[:len(b.client.Region)-2],
+		},
+	}
+}
+
 func (b *Bucket) Read(ctx context.Context) error {
 	bucket, err := b.client.Services.Storage.Buckets.Get(b.Identifier).Do()
 	if err != nil {
@@ -79,10 +97,20 @@ func (b *Bucket) Read(ctx context.Context) error {
 	return nil
 }
 
-// Update implements resource.Update.
-// The operation is not implemented for storage buckets.
+// Update replaces the labels of the storage bucket with the client tags.
 func (b *Bucket) Update(ctx context.Context) error {
-	return common.NotImplementedError
+	if err := b.Read(ctx); err != nil {
+		return err
+	}
+
+	b.Resource.Labels = b.client.Tags
+	bucket, err := b.client.Services.Storage.Buckets.Update(b.Identifier, b.Resource).Do()
+	if err != nil {
+		return err
+	}
+
+	b.Resource = bucket
+	return nil
 }
 
 // Delete deletes all objects stored in the bucket and destroys
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +30,50 @@ const (
 	FirewallRuleActionAllow FirewallRuleAction = "ALLOW"
 )
 
+// firewallRuleName matches the names of firewall rules, made of the task
+// identifier, the first letter of the direction and the priority.
+var firewallRuleName = regexp.MustCompile(`^(.+)-([ie])(\d+)$`)
+
+// ListFirewallRules returns the firewall rules named after a task identifier.
+func ListFirewallRules(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+
+	page := func(firewalls *compute.FirewallList) error {
+		for _, firewall := range firewalls.Items {
+			match := firewallRuleName.FindStringSubmatch(firewall.Name)
+			if match == nil {
+				continue
+			}
+			id, err := common.ParseIdentifier(match[1])
+			if err != nil {
+				continue
+			}
+			direction := FirewallRuleDirectionIngress
+			if match[2] == "e" {
+				direction = FirewallRuleDirectionEgress
+			}
+			priority, err := strconv.ParseUint(match[3], 10, 16)
+			if err != nil {
+				continue
+			}
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "FirewallRule",
+				Name:       firewall.Name,
+				Created:    parseTimestamp(firewall.CreationTimestamp),
+				Delete:     NewFirewallRule(client, id, nil, common.FirewallRule{}, direction, FirewallRuleActionAllow, uint16(priority)).Delete,
+			})
+		}
+		return nil
+	}
+
+	if err := client.Services.Compute.Firewalls.List(client.Credentials.ProjectID).Pages(ctx, page); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func NewFirewallRule(client *client.Client, identifier common.Identifier, defaultNetwork *DefaultNetwork, rule common.FirewallRule, direction FirewallRuleDirection, action FirewallRuleAction, priority uint16) *FirewallRule {
 	f := &FirewallRule{
 		client:     client,
@@ -130,6 +175,21 @@ func (f *FirewallRule) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan describes the firewall rule that Create would make.
+func (f *FirewallRule) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "FirewallRule",
+		Name: f.Identifier,
+		Attributes: map[string]string{
+			"network":   f.Dependencies.DefaultNetwork.Resource.Name,
+			"direction": string(f.Attributes.Direction),
+			"action":    string(f.Attributes.Action),
+			"priority":  strconv.Itoa(int(f.Attributes.Priority)),
+			"rule":      f.Attributes.Rule.String(),
+		},
+	}
+}
+
 func (f *FirewallRule) Read(ctx context.Context) error {
 	firewall, err := f.client.Services.Compute.Firewalls.Get(f.client.Credentials.ProjectID, f.Identifier).Do()
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +18,33 @@ import (
 	"terraform-provider-iterative/task/gcp/client"
 )
 
+// ListInstanceGroupManagers returns the instance group managers named after a
+// task identifier in the client zone.
+func ListInstanceGroupManagers(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+
+	page := func(managers *compute.InstanceGroupManagerList) error {
+		for _, manager := range managers.Items {
+			if id, err := common.ParseIdentifier(manager.Name); err == nil {
+				result = append(result, common.TaskResource{
+					Identifier: id,
+					Type:       "InstanceGroupManager",
+					Name:       manager.Name,
+					Created:    parseTimestamp(manager.CreationTimestamp),
+					Delete:     NewInstanceGroupManager(client, id, nil, nil).Delete,
+				})
+			}
+		}
+		return nil
+	}
+
+	if err := client.Services.Compute.InstanceGroupManagers.List(client.Credentials.ProjectID, client.Region).Pages(ctx, page); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func NewInstanceGroupManager(client *client.Client, identifier common.Identifier, instanceTemplate *InstanceTemplate, parallelism *uint16) *InstanceGroupManager {
 	i := &InstanceGroupManager{
 		client:     client,
@@ -42,6 +70,19 @@ type InstanceGroupManager struct {
 	Resource *compute.InstanceGroupManager
 }
 
+// Plan describes the instance group manager that Create would make.
+func (i *InstanceGroupManager) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "InstanceGroupManager",
+		Name: i.Identifier,
+		Attributes: map[string]string{
+			"zone":        i.client.Region,
+			"template":    i.Dependencies.InstanceTemplate.Identifier,
+			"parallelism": strconv.Itoa(int(*i.Attributes.Parallelism)),
+		},
+	}
+}
+
 func (i *InstanceGroupManager) Read(ctx context.Context) error {
 	manager, err := i.client.Services.Compute.InstanceGroupManagers.Get(i.client.Credentials.ProjectID, i.client.Region, i.Identifier).Do()
 	if err != nil {
@@ -78,9 +119,13 @@ func (i *InstanceGroupManager) Read(ctx context.Context) error {
 	}
 
 	i.Attributes.Addresses = []net.IP{}
-	i.Attributes.Status = common.Status{common.StatusCodeActive: 0}
+	i.Attributes.Status = common.Status{}
 	for _, groupInstance := range groupInstances.Items {
 		logrusctx.Debug(ctx, "Instance Group Manager Status:", groupInstance.Status)
+		machine := common.MachineStatus{
+			Machine: filepath.Base(groupInstance.Instance),
+			Phase:   instancePhase(groupInstance.Status),
+		}
 		if groupInstance.Status == "RUNNING" {
 			instance, err := i.client.Services.Compute.Instances.Get(i.client.Credentials.ProjectID, i.client.Region, filepath.Base(groupInstance.Instance)).Do()
 			if err != nil {
@@ -88,9 +133,13 @@ func (i *InstanceGroupManager) Read(ctx context.Context) error {
 			}
 			if address := net.ParseIP(instance.NetworkInterfaces[0].AccessConfigs[0].NatIP); address != nil {
 				i.Attributes.Addresses = append(i.Attributes.Addresses, address)
+				machine.Address = address
+			}
+			if started, err := time.Parse(time.RFC3339, instance.LastStartTimestamp); err == nil {
+				machine.Started = started
 			}
-			i.Attributes.Status[common.StatusCodeActive]++
 		}
+		i.Attributes.Status = append(i.Attributes.Status, machine)
 	}
 
 	i.Resource = manager
@@ -131,6 +180,7 @@ func (i *InstanceGroupManager) Create(ctx context.Context) error {
 	return nil
 }
 
+// Update resizes the group to Parallelism instances.
 func (i *InstanceGroupManager) Update(ctx context.Context) error {
 	insertOperation, err := i.client.Services.Compute.InstanceGroupManagers.Resize(i.client.Credentials.ProjectID, i.client.Region, i.Identifier, int64(*i.Attributes.Parallelism)).Do()
 	if err != nil {
@@ -139,10 +189,54 @@ func (i *InstanceGroupManager) Update(ctx context.Context) error {
 
 	getOperationCall := i.client.Services.Compute.ZoneOperations.Get(i.client.Credentials.ProjectID, i.client.Region, insertOperation.Name)
 	_, err = waitForOperation(ctx, i.client.Cloud.Timeouts.Create, 2*time.Second, 32*time.Second, getOperationCall.Do)
+	return err
+}
+
+// SetInstanceTemplate makes the group use the given template for new instances;
+// existing instances are left untouched.
+func (i *InstanceGroupManager) SetInstanceTemplate(ctx context.Context, template *InstanceTemplate) error {
+	request := &compute.InstanceGroupManagersSetInstanceTemplateRequest{
+		InstanceTemplate: template.Resource.SelfLink,
+	}
+
+	setOperation, err := i.client.Services.Compute.InstanceGroupManagers.SetInstanceTemplate(i.client.Credentials.ProjectID, i.client.Region, i.Identifier, request).Do()
+	if err != nil {
+		return err
+	}
+
+	getOperationCall := i.client.Services.Compute.ZoneOperations.Get(i.client.Credentials.ProjectID, i.client.Region, setOperation.Name)
+	_, err = waitForOperation(ctx, i.client.Cloud.Timeouts.Update, 2*time.Second, 32*time.Second, getOperationCall.Do)
+	return err
+}
+
+// UpdateLabels replaces the labels of the existing instances with the client
+// tags; new instances get them from the instance template.
+func (i *InstanceGroupManager) UpdateLabels(ctx context.Context) error {
+	if i.Resource == nil {
+		return nil
+	}
+
+	groupInstances, err := i.client.Services.Compute.InstanceGroups.ListInstances(i.client.Credentials.ProjectID, i.client.Region, i.Identifier, &compute.InstanceGroupsListInstancesRequest{}).Do()
 	if err != nil {
 		return err
 	}
 
+	for _, groupInstance := range groupInstances.Items {
+		instance, err := i.client.Services.Compute.Instances.Get(i.client.Credentials.ProjectID, i.client.Region, filepath.Base(groupInstance.Instance)).Do()
+		if err != nil {
+			return err
+		}
+
+		request := &compute.InstancesSetLabelsRequest{
+			Labels:           i.client.Tags,
+			LabelFingerprint: instance.LabelFingerprint,
+		}
+
+		if _, err := i.client.Services.Compute.Instances.SetLabels(i.client.Credentials.ProjectID, i.client.Region, instance.Name, request).Do(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -159,3 +253,15 @@ func (i *InstanceGroupManager) Delete(ctx context.Context) error {
 	i.Resource = nil
 	return nil
 }
+
+// instancePhase maps Compute Engine instance statuses to machine phases;
+// instances going away without a status report are being recreated by the
+// group manager, so they're considered provisioning rather than failed.
+func instancePhase(status string) common.Phase {
+	switch status {
+	case "RUNNING":
+		return common.PhaseRunning
+	default:
+		return common.PhaseProvisioning
+	}
+}
@@ -14,9 +14,43 @@ import (
 
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/gcp/client"
 )
 
+// ListInstanceTemplates returns the instance templates named after a task
+// identifier, including the staging templates left behind by failed updates.
+func ListInstanceTemplates(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	result := []common.TaskResource{}
+
+	page := func(templates *compute.InstanceTemplateList) error {
+		for _, template := range templates.Items {
+			if id, err := common.ParseIdentifier(strings.TrimSuffix(template.Name, "-staging")); err == nil {
+				instanceTemplate := NewInstanceTemplate(client, id, nil, nil, nil, nil, nil, common.Task{})
+				instanceTemplate.Identifier = template.Name
+				resource := common.TaskResource{
+					Identifier: id,
+					Type:       "InstanceTemplate",
+					Name:       template.Name,
+					Created:    parseTimestamp(template.CreationTimestamp),
+					Delete:     instanceTemplate.Delete,
+				}
+				if template.Properties != nil {
+					resource.Tags = template.Properties.Labels
+				}
+				result = append(result, resource)
+			}
+		}
+		return nil
+	}
+
+	if err := client.Services.Compute.InstanceTemplates.List(client.Credentials.ProjectID).Pages(ctx, page); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func NewInstanceTemplate(client *client.Client, identifier common.Identifier, defaultNetwork *DefaultNetwork, firewallRules []*FirewallRule, permissionSet *PermissionSet, image *Image, credentials *Credentials, task common.Task) *InstanceTemplate {
 	i := &InstanceTemplate{
 		client:     client,
@@ -32,8 +66,11 @@ func NewInstanceTemplate(client *client.Client, identifier common.Identifier, de
 }
 
 type InstanceTemplate struct {
-	client       *client.Client
-	Identifier   string
+	client     *client.Client
+	Identifier string
+	// Created is the creation time of the task, which the machine deadline
+	// counts from; it's zero for tasks being created.
+	Created      time.Time
 	Attributes   common.Task
 	Dependencies struct {
 		DefaultNetwork *DefaultNetwork
@@ -62,49 +99,15 @@ func (i *InstanceTemplate) Create(ctx context.Context) error {
 		i.Attributes.Environment.Variables = make(map[string]*string)
 	}
 
-	timeout := time.Now().Add(i.Attributes.Environment.Timeout)
-	script, err := machine.Script(i.Attributes.Environment.Script, i.Dependencies.Credentials.Resource, i.Attributes.Environment.Variables, &timeout)
+	timeout := machine.Deadline(i.Created, i.Attributes.Environment.Timeout)
+	script, err := machine.Script(i.Attributes.Environment.Script, i.Dependencies.Credentials.Resource, i.Attributes.Environment.Variables, i.Attributes.Environment.Inputs, &timeout)
 	if err != nil {
 		return fmt.Errorf("failed to render machine script: %w", err)
 	}
 
-	size := i.Attributes.Size.Machine
-	sizes := map[string]string{
-		"s":       "g1-small",
-		"m":       "e2-custom-8-32768",
-		"l":       "e2-custom-32-131072",
-		"xl":      "n2-custom-64-262144",
-		"m+t4":    "n1-standard-4+nvidia-tesla-t4*1",
-		"m+k80":   "custom-8-53248+nvidia-tesla-k80*1",
-		"l+k80":   "custom-32-131072+nvidia-tesla-k80*4",
-		"xl+k80":  "custom-64-212992-ext+nvidia-tesla-k80*8",
-		"m+v100":  "custom-8-65536-ext+nvidia-tesla-v100*1",
-		"l+v100":  "custom-32-262144-ext+nvidia-tesla-v100*4",
-		"xl+v100": "custom-64-524288-ext+nvidia-tesla-v100*8",
-	}
-
-	if val, ok := sizes[size]; ok {
-		size = val
-	}
-
-	accelerators := []*compute.AcceleratorConfig{}
-
-	match := regexp.MustCompile(`^([^+]+)(?:\+([^*]+)\*([1-9]\d*))?$`).FindStringSubmatch(size)
-	if match == nil {
-		return errors.New("invalid machine type")
-	}
-
-	machineType := match[1]
-	if match[2] != "" {
-		acceleratorType := match[2]
-		acceleratorCount, err := strconv.Atoi(match[3])
-		if err != nil {
-			return err
-		}
-		accelerators = append(accelerators, &compute.AcceleratorConfig{
-			AcceleratorCount: int64(acceleratorCount),
-			AcceleratorType:  acceleratorType,
-		})
+	machineType, accelerators, err := parseMachineType(i.Attributes.Size.Machine)
+	if err != nil {
+		return err
 	}
 
 	if i.Attributes.Spot > 0 {
@@ -178,6 +181,20 @@ func (i *InstanceTemplate) Create(ctx context.Context) error {
 		definition.Properties.Disks[0].InitializeParams.DiskSizeGb = int64(size)
 	}
 
+	return i.insert(ctx, definition)
+}
+
+// Restore recreates the template from a definition read before deleting it,
+// like a previous value of Resource, so its replacement can be rolled back.
+func (i *InstanceTemplate) Restore(ctx context.Context, template *compute.InstanceTemplate) error {
+	return i.insert(ctx, &compute.InstanceTemplate{
+		Name:        i.Identifier,
+		Description: template.Description,
+		Properties:  template.Properties,
+	})
+}
+
+func (i *InstanceTemplate) insert(ctx context.Context, definition *compute.InstanceTemplate) error {
 	insertOperation, err := i.client.Services.Compute.InstanceTemplates.Insert(i.client.Credentials.ProjectID, definition).Do()
 	if err != nil {
 		if strings.HasSuffix(err.Error(), "alreadyExists") {
@@ -195,6 +212,79 @@ func (i *InstanceTemplate) Create(ctx context.Context) error {
 	return i.Read(ctx)
 }
 
+// MachineType translates generic machine sizes into Compute Engine machine
+// types, using the machine+accelerator*count syntax; other values are passed
+// through verbatim.
+func MachineType(size string) string {
+	if val, ok := sizes.Lookup(common.ProviderGCP, size); ok {
+		return val
+	}
+	return size
+}
+
+// parseMachineType splits the machine type for the given size into a Compute
+// Engine machine type and its accelerators.
+func parseMachineType(size string) (string, []*compute.AcceleratorConfig, error) {
+	accelerators := []*compute.AcceleratorConfig{}
+
+	match := regexp.MustCompile(`^([^+]+)(?:\+([^*]+)\*([1-9]\d*))?$`).FindStringSubmatch(MachineType(size))
+	if match == nil {
+		return "", nil, errors.New("invalid machine type")
+	}
+
+	if match[2] != "" {
+		acceleratorCount, err := strconv.Atoi(match[3])
+		if err != nil {
+			return "", nil, err
+		}
+		accelerators = append(accelerators, &compute.AcceleratorConfig{
+			AcceleratorCount: int64(acceleratorCount),
+			AcceleratorType:  match[2],
+		})
+	}
+
+	return match[1], accelerators, nil
+}
+
+// Plan describes the instance template that Create would make.
+func (i *InstanceTemplate) Plan() (common.PlannedResource, error) {
+	machineType, accelerators, err := parseMachineType(i.Attributes.Size.Machine)
+	if err != nil {
+		return common.PlannedResource{}, err
+	}
+
+	if i.Attributes.Spot > 0 {
+		return common.PlannedResource{}, errors.New("preemptible instances don't have bidding price")
+	}
+
+	accelerator := "none"
+	for _, a := range accelerators {
+		accelerator = fmt.Sprintf("%s*%d", a.AcceleratorType, a.AcceleratorCount)
+	}
+
+	var serviceAccounts []string
+	for _, account := range i.Dependencies.PermissionSet.Resource {
+		serviceAccounts = append(serviceAccounts, account.Email)
+	}
+	permissionSet := "none"
+	if len(serviceAccounts) > 0 {
+		permissionSet = strings.Join(serviceAccounts, ",")
+	}
+
+	return common.PlannedResource{
+		Type: "InstanceTemplate",
+		Name: i.Identifier,
+		Attributes: map[string]string{
+			"machine_type":   machineType,
+			"accelerator":    accelerator,
+			"image":          i.Dependencies.Image.Resource.SelfLink,
+			"disk_size":      common.DiskSize(i.Attributes.Size.Storage),
+			"preemptible":    strconv.FormatBool(i.Attributes.Spot == 0),
+			"permission_set": permissionSet,
+		},
+	}, nil
+}
+
 func (i *InstanceTemplate) Read(ctx context.Context) error {
 	template, err := i.client.Services.Compute.InstanceTemplates.Get(i.client.Credentials.ProjectID, i.Identifier).Do()
 	if err != nil {
@@ -209,6 +299,8 @@ func (i *InstanceTemplate) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update is not implemented because instance templates are immutable; tasks
+// replace them instead, see InstanceGroupManager.SetInstanceTemplate.
 func (i *InstanceTemplate) Update(ctx context.Context) error {
 	return common.NotImplementedError
 }
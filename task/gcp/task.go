@@ -9,6 +9,7 @@ import (
 
 	"terraform-provider-iterative/task/common"
 	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/common/ssh"
 	"terraform-provider-iterative/task/gcp/client"
 	"terraform-provider-iterative/task/gcp/resources"
@@ -20,7 +21,44 @@ func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error)
 		return nil, err
 	}
 
-	return resources.ListBuckets(ctx, client)
+	buckets, err := resources.ListBuckets(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.TaskIdentifiers(buckets), nil
+}
+
+// ListResources returns every resource named after a task identifier, in
+// creation order, including those left behind by failed deletions.
+func ListResources(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error) {
+	lists := []func(context.Context, *client.Client) ([]common.TaskResource, error){
+		resources.ListBuckets,
+		resources.ListFirewallRules,
+		resources.ListInstanceTemplates,
+		resources.ListInstanceGroupManagers,
+	}
+
+	client, err := client.New(ctx, cloud, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []common.TaskResource
+	for _, list := range lists {
+		found, err := list(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+
+	return result, nil
+}
+
+// MachineType translates generic machine sizes into Compute Engine machine types.
+func MachineType(machine string) string {
+	return resources.MachineType(machine)
 }
 
 func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (*Task, error) {
@@ -33,6 +71,9 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 	t.Client = client
 	t.Identifier = identifier
 	t.Attributes = task
+	t.RemoteStorage = machine.NewRemoteStorage(func() map[string]string {
+		return t.DataSources.Credentials.Resource
+	}, &t.Attributes.Environment)
 	t.DataSources.PermissionSet = resources.NewPermissionSet(
 		t.Client,
 		t.Attributes.PermissionSet,
@@ -127,6 +168,7 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 	t.DataSources.Image = resources.NewImage(
 		t.Client,
 		t.Attributes.Environment.Image,
+		sizes.Architecture(common.ProviderGCP, t.Attributes.Size.Machines()[0]),
 	)
 	t.Resources.InstanceTemplate = resources.NewInstanceTemplate(
 		t.Client,
@@ -155,6 +197,8 @@ func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier,
 }
 
 type Task struct {
+	machine.RemoteStorage
+
 	Client      *client.Client
 	Identifier  common.Identifier
 	Attributes  common.Task
@@ -181,66 +225,110 @@ type Task struct {
 func (t *Task) Create(ctx context.Context) error {
 	logrusctx.Info(ctx, "Creating resources...")
 	steps := []common.Step{{
+		Name:        "permission-set",
 		Description: "Parsing PermissionSet...",
 		Action:      t.DataSources.PermissionSet.Read,
 	}, {
+		Name:        "default-network",
 		Description: "Creating DefaultNetwork...",
 		Action:      t.DataSources.DefaultNetwork.Read,
 	}, {
+		Name:        "image",
 		Description: "Reading Image...",
 		Action:      t.DataSources.Image.Read,
 	}}
 	if t.Resources.Bucket != nil {
 		steps = append(steps, common.Step{
+			Name:        "bucket",
 			Description: "Creating Bucket...",
 			Action:      t.Resources.Bucket.Create,
+			Rollback:    t.Resources.Bucket.Delete,
+			Resume:      t.Resources.Bucket.Read,
 		})
 	} else if t.DataSources.Bucket != nil {
 		steps = append(steps, common.Step{
+			Name:        "bucket",
 			Description: "Verifying bucket...",
 			Action:      t.DataSources.Bucket.Read,
 		})
 	}
+	steps = append(steps, common.Step{
+		Name:         "credentials",
+		Description:  "Reading Credentials...",
+		Action:       t.DataSources.Credentials.Read,
+		Dependencies: []string{"bucket"},
+	})
+
+	firewallRules := []struct {
+		name string
+		rule *resources.FirewallRule
+	}{
+		{"FirewallInternalEgress", t.Resources.FirewallInternalEgress},
+		{"FirewallInternalIngress", t.Resources.FirewallInternalIngress},
+		{"FirewallExternalEgress", t.Resources.FirewallExternalEgress},
+		{"FirewallExternalIngress", t.Resources.FirewallExternalIngress},
+		{"FirewallDenyEgress", t.Resources.FirewallDenyEgress},
+		{"FirewallDenyIngress", t.Resources.FirewallDenyIngress},
+	}
+	templateDependencies := []string{"permission-set", "image", "credentials"}
+	for _, firewallRule := range firewallRules {
+		steps = append(steps, common.Step{
+			Name:         firewallRule.name,
+			Description:  "Creating " + firewallRule.name + "...",
+			Action:       firewallRule.rule.Create,
+			Dependencies: []string{"default-network"},
+			Rollback:     firewallRule.rule.Delete,
+			Resume:       firewallRule.rule.Read,
+		})
+		templateDependencies = append(templateDependencies, firewallRule.name)
+	}
+
 	steps = append(steps, []common.Step{{
-		Description: "Reading Credentials...",
-		Action:      t.DataSources.Credentials.Read,
-	}, {
-		Description: "Creating FirewallInternalEgress...",
-		Action:      t.Resources.FirewallInternalEgress.Create,
-	}, {
-		Description: "Creating FirewallInternalIngress...",
-		Action:      t.Resources.FirewallInternalIngress.Create,
-	}, {
-		Description: "Creating FirewallExternalEgress...",
-		Action:      t.Resources.FirewallExternalEgress.Create,
+		Name:         "instance-template",
+		Description:  "Creating InstanceTemplate...",
+		Action:       t.Resources.InstanceTemplate.Create,
+		Dependencies: templateDependencies,
+		Rollback:     t.Resources.InstanceTemplate.Delete,
+		Resume:       t.Resources.InstanceTemplate.Read,
 	}, {
-		Description: "Creating FirewallExternalIngress...",
-		Action:      t.Resources.FirewallExternalIngress.Create,
+		Name:         "instance-group-manager",
+		Description:  "Creating InstanceGroupManager...",
+		Action:       t.Resources.InstanceGroupManager.Create,
+		Dependencies: []string{"instance-template"},
+		Rollback:     t.Resources.InstanceGroupManager.Delete,
+		Resume:       t.Resources.InstanceGroupManager.Read,
 	}, {
-		Description: "Creating FirewallDenyEgress...",
-		Action:      t.Resources.FirewallDenyEgress.Create,
-	}, {
-		Description: "Creating FirewallDenyIngress...",
-		Action:      t.Resources.FirewallDenyIngress.Create,
-	}, {
-		Description: "Creating InstanceTemplate...",
-		Action:      t.Resources.InstanceTemplate.Create,
-	}, {
-		Description: "Creating InstanceGroupManager...",
-		Action:      t.Resources.InstanceGroupManager.Create,
+		Name:         "manifest",
+		Description:  "Writing Manifest...",
+		Action:       t.writeManifest,
+		Dependencies: []string{"image", "credentials"},
 	}}...)
 
+	start := []string{"instance-group-manager", "manifest"}
 	if t.Attributes.Environment.Directory != "" {
 		steps = append(steps, common.Step{
-			Description: "Uploading Directory...",
-			Action:      t.Push,
+			Name:         "push",
+			Description:  "Uploading Directory...",
+			Action:       t.Push,
+			Dependencies: []string{"credentials"},
+		})
+		start = append(start, "push")
+	}
+	if t.Attributes.Environment.Queue.Enabled() {
+		steps = append(steps, common.Step{
+			Name:         "queue",
+			Description:  "Uploading Work Items...",
+			Action:       t.UploadQueue,
+			Dependencies: []string{"credentials"},
 		})
+		start = append(start, "queue")
 	}
 	steps = append(steps, common.Step{
-		Description: "Starting task...",
-		Action:      t.Start,
+		Description:  "Starting task...",
+		Action:       t.Start,
+		Dependencies: start,
 	})
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunStepsWithProgress(ctx, steps, common.NewProgress(t.Identifier)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Creation completed")
@@ -250,6 +338,51 @@ func (t *Task) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan resolves the data sources and describes the resources that Create
+// would make, without creating anything.
+func (t *Task) Plan(ctx context.Context) ([]common.PlannedResource, error) {
+	logrusctx.Info(ctx, "Planning resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}, {
+		Description: "Reading DefaultNetwork...",
+		Action:      t.DataSources.DefaultNetwork.Read,
+	}, {
+		Description: "Reading Image...",
+		Action:      t.DataSources.Image.Read,
+	}}
+	if t.DataSources.Bucket != nil {
+		steps = append(steps, common.Step{
+			Description: "Verifying bucket...",
+			Action:      t.DataSources.Bucket.Read,
+		})
+	}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return nil, err
+	}
+
+	plan := []common.PlannedResource{}
+	if t.Resources.Bucket != nil {
+		plan = append(plan, t.Resources.Bucket.Plan())
+	}
+	for _, rule := range []*resources.FirewallRule{
+		t.Resources.FirewallInternalEgress,
+		t.Resources.FirewallInternalIngress,
+		t.Resources.FirewallExternalEgress,
+		t.Resources.FirewallExternalIngress,
+		t.Resources.FirewallDenyEgress,
+		t.Resources.FirewallDenyIngress,
+	} {
+		plan = append(plan, rule.Plan())
+	}
+	template, err := t.Resources.InstanceTemplate.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return append(plan, template, t.Resources.InstanceGroupManager.Plan()), nil
+}
+
 func (t *Task) Read(ctx context.Context) error {
 	logrusctx.Info(ctx, "Reading resources... (this may happen several times)")
 	steps := []common.Step{{
@@ -271,6 +404,11 @@ func (t *Task) Read(ctx context.Context) error {
 	}, {
 		Description: "Reading Credentials...",
 		Action:      t.DataSources.Credentials.Read,
+	}, {
+		Description: "Reading Manifest...",
+		Action: func(ctx context.Context) error {
+			return machine.ApplyManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], &t.Client.Cloud, &t.Attributes)
+		},
 	}, {
 		Description: "Reading FirewallInternalEgress...",
 		Action:      t.Resources.FirewallInternalEgress.Read,
@@ -296,13 +434,115 @@ func (t *Task) Read(ctx context.Context) error {
 		Description: "Reading InstanceGroupManager...",
 		Action:      t.Resources.InstanceGroupManager.Read,
 	}}
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Read completed")
 	t.Attributes.Addresses = t.Resources.InstanceGroupManager.Attributes.Addresses
 	t.Attributes.Status = t.Resources.InstanceGroupManager.Attributes.Status
 	t.Attributes.Events = t.Resources.InstanceGroupManager.Attributes.Events
+	preemptions, err := machine.Preemptions(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		logrusctx.Warnf(ctx, "Failed to read preemption reports: %v", err)
+	}
+	t.Attributes.Events = append(t.Attributes.Events, preemptions...)
+	return nil
+}
+
+// Update applies the current attributes to an existing task: it relabels the
+// resources, replaces the instance template so new instances pick up changes to
+// the environment and timeout, and resizes the instance group.
+func (t *Task) Update(ctx context.Context) error {
+	if err := t.Read(ctx); err != nil {
+		return err
+	}
+
+	// Machine deadlines count from the creation of the task, not from updates.
+	created, err := machine.CreationTime(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		return err
+	}
+	t.Resources.InstanceTemplate.Created = created
+
+	// Instance templates are immutable and can't be deleted while in use, so
+	// the group is temporarily switched to a staging template while the
+	// original one is recreated.
+	staging := resources.NewInstanceTemplate(
+		t.Client,
+		t.Identifier,
+		t.DataSources.DefaultNetwork,
+		t.Resources.InstanceTemplate.Dependencies.FirewallRules,
+		t.DataSources.PermissionSet,
+		t.DataSources.Image,
+		t.DataSources.Credentials,
+		t.Attributes,
+	)
+	staging.Identifier += "-staging"
+	staging.Created = created
+	// The original template is recreated as read if the update fails after
+	// deleting it, since the attributes have already changed.
+	original := t.Resources.InstanceTemplate.Resource
+
+	logrusctx.Info(ctx, "Updating resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}}
+	if t.Resources.Bucket != nil {
+		steps = append(steps, common.Step{
+			Description: "Updating Bucket...",
+			Action:      t.Resources.Bucket.Update,
+		})
+	}
+	// Every step tolerates the leftovers of an interrupted update and, if a
+	// later one fails, the group is switched back to the original template.
+	steps = append(steps, []common.Step{{
+		Description: "Creating staging InstanceTemplate...",
+		Action:      staging.Create,
+		Rollback:    staging.Delete,
+	}, {
+		Description: "Switching InstanceGroupManager to staging InstanceTemplate...",
+		Action: func(ctx context.Context) error {
+			return t.Resources.InstanceGroupManager.SetInstanceTemplate(ctx, staging)
+		},
+		Rollback: func(ctx context.Context) error {
+			if t.Resources.InstanceTemplate.Resource == nil {
+				return errors.New("can't switch back to a missing InstanceTemplate")
+			}
+			return t.Resources.InstanceGroupManager.SetInstanceTemplate(ctx, t.Resources.InstanceTemplate)
+		},
+	}, {
+		Description: "Deleting InstanceTemplate...",
+		Action:      t.Resources.InstanceTemplate.Delete,
+		Rollback: func(ctx context.Context) error {
+			if original == nil {
+				return errors.New("can't recreate a missing InstanceTemplate")
+			}
+			return t.Resources.InstanceTemplate.Restore(ctx, original)
+		},
+	}, {
+		Description: "Creating InstanceTemplate...",
+		Action:      t.Resources.InstanceTemplate.Create,
+		Rollback:    t.Resources.InstanceTemplate.Delete,
+	}, {
+		Description: "Switching InstanceGroupManager to InstanceTemplate...",
+		Action: func(ctx context.Context) error {
+			return t.Resources.InstanceGroupManager.SetInstanceTemplate(ctx, t.Resources.InstanceTemplate)
+		},
+	}, {
+		Description: "Deleting staging InstanceTemplate...",
+		Action:      staging.Delete,
+	}, {
+		Description: "Updating InstanceGroupManager...",
+		Action:      t.Resources.InstanceGroupManager.Update,
+	}, {
+		Description: "Updating Instance labels...",
+		Action:      t.Resources.InstanceGroupManager.UpdateLabels,
+	}}...)
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Update completed")
 	return nil
 }
 
@@ -363,7 +603,10 @@ func (t *Task) Delete(ctx context.Context) error {
 			Action:      t.Resources.Bucket.Delete,
 		})
 	}
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	if err := common.DeleteProgress(t.Identifier); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Deletion completed")
@@ -374,23 +617,8 @@ func (t *Task) Logs(ctx context.Context) ([]string, error) {
 	return machine.Logs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
 }
 
-// Pull downloads the output directory from remote storage.
-func (t *Task) Pull(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.Directory,
-		machine.LimitTransfer(
-			t.Attributes.Environment.DirectoryOut,
-			t.Attributes.Environment.ExcludeList))
-}
-
-// Push uploads the work directory to remote storage.
-func (t *Task) Push(ctx context.Context) error {
-	return machine.Transfer(ctx,
-		t.Attributes.Environment.Directory,
-		t.DataSources.Credentials.Resource["RCLONE_REMOTE"]+"/data",
-		t.Attributes.Environment.ExcludeList,
-	)
+func (t *Task) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	return machine.StreamLogs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], cursor)
 }
 
 func (t *Task) Start(ctx context.Context) error {
@@ -413,6 +641,16 @@ func (t *Task) Events(ctx context.Context) []common.Event {
 	return t.Attributes.Events
 }
 
+// writeManifest records the task specification along with the resolved image
+// and machine type in the remote storage.
+func (t *Task) writeManifest(ctx context.Context) error {
+	manifest := common.NewManifest(t.Identifier, t.Client.Cloud, t.Attributes)
+	manifest.Region = common.Region(t.Client.Region)
+	manifest.Image = t.DataSources.Image.Resource.SelfLink
+	manifest.MachineType = MachineType(t.Attributes.Size.Machine)
+	return machine.WriteManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], manifest)
+}
+
 func (t *Task) Status(ctx context.Context) (common.Status, error) {
 	return machine.Status(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], t.Attributes.Status)
 }
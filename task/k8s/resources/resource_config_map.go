@@ -2,6 +2,8 @@ package resources
 
 import (
 	"context"
+	"sort"
+	"strings"
 
 	kubernetes_core "k8s.io/api/core/v1"
 	kubernetes_errors "k8s.io/apimachinery/pkg/api/errors"
@@ -12,22 +14,33 @@ import (
 	"terraform-provider-iterative/task/k8s/client"
 )
 
-func ListConfigMaps(ctx context.Context, client *client.Client) ([]common.Identifier, error) {
+func ListConfigMaps(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
 	cmaps, err := client.Services.Core.ConfigMaps(client.Namespace).List(ctx, kubernetes_meta.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	ids := []common.Identifier{}
+	result := []common.TaskResource{}
 	for _, cmap := range cmaps.Items {
 		if id, err := common.ParseIdentifier(cmap.ObjectMeta.Name); err == nil {
-			ids = append(ids, id)
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "ConfigMap",
+				Name:       cmap.ObjectMeta.Name,
+				Created:    cmap.ObjectMeta.CreationTimestamp.Time,
+				Tags:       cmap.ObjectMeta.Labels,
+				Delete:     NewConfigMap(client, id, nil).Delete,
+			})
 		}
 	}
 
-	return ids, nil
+	return result, nil
 }
 
+// ManifestKey is the config map key holding the task manifest, as Kubernetes
+// tasks don't have a remote storage to write it to.
+const ManifestKey = "manifest.json"
+
 func NewConfigMap(client *client.Client, identifier common.Identifier, data map[string]string) *ConfigMap {
 	return &ConfigMap{
 		client:     client,
@@ -65,6 +78,24 @@ func (c *ConfigMap) Create(ctx context.Context) error {
 	return c.Read(ctx)
 }
 
+// Plan describes the config map that Create would make.
+func (c *ConfigMap) Plan() common.PlannedResource {
+	keys := []string{}
+	for key := range c.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return common.PlannedResource{
+		Type: "ConfigMap",
+		Name: c.Identifier,
+		Attributes: map[string]string{
+			"namespace": c.client.Namespace,
+			"keys":      strings.Join(keys, ","),
+		},
+	}
+}
+
 func (c *ConfigMap) Read(ctx context.Context) error {
 	configMap, err := c.client.Services.Core.ConfigMaps(c.client.Namespace).Get(ctx, c.Identifier, kubernetes_meta.GetOptions{})
 	if err != nil {
@@ -78,6 +109,35 @@ func (c *ConfigMap) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update replaces the data and labels of the config map, so new pods pick up
+// changes to the task script, keeping the manifest.
+func (c *ConfigMap) Update(ctx context.Context) error {
+	if err := c.Read(ctx); err != nil {
+		return err
+	}
+
+	// The manifest records the creation of the task, so updates keep it.
+	data := map[string]string{}
+	for key, value := range c.Attributes {
+		data[key] = value
+	}
+	if manifest, ok := c.Resource.Data[ManifestKey]; ok {
+		data[ManifestKey] = manifest
+	}
+
+	c.Resource.Labels = c.client.Tags
+	c.Resource.Annotations = c.client.Tags
+	c.Resource.Data = data
+
+	configMap, err := c.client.Services.Core.ConfigMaps(c.client.Namespace).Update(ctx, c.Resource, kubernetes_meta.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	c.Resource = configMap
+	return nil
+}
+
 func (c *ConfigMap) Delete(ctx context.Context) error {
 	err := c.client.Services.Core.ConfigMaps(c.client.Namespace).Delete(ctx, c.Identifier, kubernetes_meta.DeleteOptions{})
 	if err != nil {
@@ -1,6 +1,7 @@
 package resources
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,9 +26,34 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/k8s/client"
 )
 
+// ListJobs returns the jobs named after a task identifier.
+func ListJobs(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	jobs, err := client.Services.Batch.Jobs(client.Namespace).List(ctx, kubernetes_meta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []common.TaskResource{}
+	for _, job := range jobs.Items {
+		if id, err := common.ParseIdentifier(job.ObjectMeta.Name); err == nil {
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "Job",
+				Name:       job.ObjectMeta.Name,
+				Created:    job.ObjectMeta.CreationTimestamp.Time,
+				Tags:       job.ObjectMeta.Labels,
+				Delete:     NewJob(client, id, nil, nil, nil, common.Task{}).Delete,
+			})
+		}
+	}
+
+	return result, nil
+}
+
 func NewJob(client *client.Client, identifier common.Identifier, persistentVolumeClaim VolumeInfoProvider, configMap *ConfigMap, permissionSet *PermissionSet, task common.Task) *Job {
 	j := &Job{
 		client:     client,
@@ -67,42 +94,14 @@ type Job struct {
 }
 
 func (j *Job) Create(ctx context.Context) error {
-	size := j.Attributes.Task.Size.Machine
-	sizes := map[string]string{
-		"s":       "1-1000",
-		"m":       "8-32000",
-		"l":       "32-128000",
-		"xl":      "64-256000",
-		"m+t4":    "4-16000+nvidia*1",
-		"m+k80":   "4-64000+nvidia*1",
-		"l+k80":   "32-512000+nvidia*8",
-		"xl+k80":  "64-768000+nvidia*16",
-		"m+v100":  "8-64000+nvidia*1",
-		"l+v100":  "32-256000+nvidia*4",
-		"xl+v100": "64-512000+nvidia*8",
-	}
-	if val, ok := sizes[size]; ok {
-		size = val
-	}
-
-	image := j.Attributes.Task.Environment.Image
-	images := map[string]string{
-		"ubuntu": "ubuntu",
-		"nvidia": "nvidia/cuda:11.3.1-cudnn8-runtime-ubuntu20.04",
-	}
-	if val, ok := images[image]; ok {
-		image = val
-	}
+	image := containerImage(j.Attributes.Task.Environment.Image)
 
-	match := regexp.MustCompile(`^(\d+)-(\d+)(?:\+([^*]+)\*([1-9]\d*))?$`).FindStringSubmatch(size)
+	match := parseSize(j.Attributes.Task.Size.Machine)
 	if match == nil {
 		return common.NotFoundError
 	}
 
-	jobNodeSelector := map[string]string{}
-	for selector, value := range j.Attributes.NodeSelector {
-		jobNodeSelector[selector] = value
-	}
+	jobNodeSelector := j.nodeSelector()
 
 	// Define the accelerator settings (i.e. GPU type, model, ...)
 	jobAccelerator := match[3]
@@ -148,6 +147,23 @@ func (j *Job) Create(ctx context.Context) error {
 			Value: value,
 		})
 	}
+	// Pods of indexed jobs use their completion index, which is also exposed
+	// as JOB_COMPLETION_INDEX, as task index.
+	jobTaskIndex := kubernetes_core.EnvVar{
+		Name:  "TPI_TASK_INDEX",
+		Value: "0",
+	}
+	if jobCompletionMode == kubernetes_batch.IndexedCompletion {
+		jobTaskIndex = kubernetes_core.EnvVar{
+			Name: "TPI_TASK_INDEX",
+			ValueFrom: &kubernetes_core.EnvVarSource{
+				FieldRef: &kubernetes_core.ObjectFieldSelector{
+					FieldPath: "metadata.annotations['batch.kubernetes.io/job-completion-index']",
+				},
+			},
+		}
+	}
+	jobEnvironment = append(jobEnvironment, jobTaskIndex)
 	jobEnvironment = append(jobEnvironment, kubernetes_core.EnvVar{
 		Name:  "TPI_TRANSFER_MODE",
 		Value: os.Getenv("TPI_TRANSFER_MODE"),
@@ -167,6 +183,11 @@ func (j *Job) Create(ctx context.Context) error {
 					LocalObjectReference: kubernetes_core.LocalObjectReference{
 						Name: j.Dependencies.ConfigMap.Identifier,
 					},
+					// Only the script is mounted; the config map also holds the manifest.
+					Items: []kubernetes_core.KeyToPath{{
+						Key:  "script",
+						Path: "script",
+					}},
 					DefaultMode: &readExecuteUserGroupOthers,
 				},
 			},
@@ -276,6 +297,85 @@ func (j *Job) Create(ctx context.Context) error {
 	return nil
 }
 
+// parseSize translates generic machine sizes into pod resources and splits
+// them into the cpu-memory[+accelerator*count] parts; it returns nil for
+// invalid sizes.
+func parseSize(size string) []string {
+	if val, ok := sizes.Lookup(common.ProviderK8S, size); ok {
+		size = val
+	}
+
+	return regexp.MustCompile(`^(\d+)-(\d+)(?:\+([^*]+)\*([1-9]\d*))?$`).FindStringSubmatch(size)
+}
+
+// containerImage translates image aliases into container images; other values
+// are passed through verbatim.
+func containerImage(image string) string {
+	images := map[string]string{
+		"ubuntu": "ubuntu",
+		"nvidia": "nvidia/cuda:11.3.1-cudnn8-runtime-ubuntu20.04",
+	}
+	if val, ok := images[image]; ok {
+		return val
+	}
+	return image
+}
+
+// nodeSelector returns the node selector for the job pods, which requests nodes
+// with the architecture of the machine size unless the user selects otherwise.
+func (j *Job) nodeSelector() map[string]string {
+	selector := map[string]string{}
+	if sizes.Architecture(common.ProviderK8S, j.Attributes.Task.Size.Machine) == common.ArchitectureARM64 {
+		selector["kubernetes.io/arch"] = string(common.ArchitectureARM64)
+	}
+	for key, value := range j.Attributes.NodeSelector {
+		selector[key] = value
+	}
+	return selector
+}
+
+// Plan describes the job that Create would make.
+func (j *Job) Plan() (common.PlannedResource, error) {
+	match := parseSize(j.Attributes.Task.Size.Machine)
+	if match == nil {
+		return common.PlannedResource{}, fmt.Errorf("invalid machine size: %s", j.Attributes.Task.Size.Machine)
+	}
+
+	gpu := "none"
+	if match[4] != "" {
+		gpu = match[4]
+		if match[3] != "" {
+			gpu += " (" + match[3] + ")"
+		}
+	}
+
+	var selectors []string
+	for key, value := range j.nodeSelector() {
+		selectors = append(selectors, key+"="+value)
+	}
+	sort.Strings(selectors)
+
+	serviceAccount := j.Dependencies.PermissionSet.Resource.ServiceAccountName
+	if serviceAccount == "" {
+		serviceAccount = "default"
+	}
+
+	return common.PlannedResource{
+		Type: "Job",
+		Name: j.Identifier,
+		Attributes: map[string]string{
+			"cpu":             match[1],
+			"memory":          match[2] + "M",
+			"gpu":             gpu,
+			"image":           containerImage(j.Attributes.Task.Environment.Image),
+			"disk_size":       common.DiskSize(j.Attributes.Task.Size.Storage),
+			"node_selector":   strings.Join(selectors, ","),
+			"parallelism":     strconv.Itoa(int(j.Attributes.Parallelism)),
+			"service_account": serviceAccount,
+		},
+	}, nil
+}
+
 func (j *Job) Read(ctx context.Context) error {
 	job, err := j.client.Services.Batch.Jobs(j.client.Namespace).Get(ctx, j.Identifier, kubernetes_meta.GetOptions{})
 	if err != nil {
@@ -299,15 +399,49 @@ func (j *Job) Read(ctx context.Context) error {
 			},
 		})
 	}
-	j.Attributes.Status = common.Status{
-		common.StatusCodeActive:    int(job.Status.Active),
-		common.StatusCodeSucceeded: int(job.Status.Succeeded),
-		common.StatusCodeFailed:    int(job.Status.Failed),
+	pods, err := j.client.Services.Core.Pods(j.client.Namespace).List(ctx, kubernetes_meta.ListOptions{
+		LabelSelector: fmt.Sprintf("controller-uid=%s", job.Spec.Selector.MatchLabels["controller-uid"]),
+	})
+	if err != nil {
+		return err
+	}
+	j.Attributes.Status = common.Status{}
+	for _, pod := range pods.Items {
+		j.Attributes.Status = append(j.Attributes.Status, podStatus(pod))
 	}
 	j.Resource = job
 	return nil
 }
 
+// Update rescales the job to Parallelism pods and applies the current timeout
+// and labels. Pod templates are immutable, so environment variables only apply
+// to jobs created afterwards.
+func (j *Job) Update(ctx context.Context) error {
+	if err := j.Read(ctx); err != nil {
+		return err
+	}
+
+	jobParallelism := int32(j.Attributes.Parallelism)
+	jobActiveDeadlineSeconds := int64(j.Attributes.Task.Environment.Timeout / time.Second)
+
+	j.Resource.Labels = j.client.Tags
+	j.Resource.Annotations = j.client.Tags
+	j.Resource.Spec.Parallelism = &jobParallelism
+	j.Resource.Spec.ActiveDeadlineSeconds = &jobActiveDeadlineSeconds
+	// Completions can only change along with parallelism for indexed jobs.
+	if mode := j.Resource.Spec.CompletionMode; mode != nil && *mode == kubernetes_batch.IndexedCompletion {
+		j.Resource.Spec.Completions = &jobParallelism
+	}
+
+	job, err := j.client.Services.Batch.Jobs(j.client.Namespace).Update(ctx, j.Resource, kubernetes_meta.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+
+	j.Resource = job
+	return nil
+}
+
 func (j *Job) Delete(ctx context.Context) error {
 	_, err := j.client.Services.Batch.Jobs(j.client.Namespace).Get(ctx, j.Identifier, kubernetes_meta.GetOptions{})
 	if err != nil {
@@ -382,6 +516,114 @@ func (j *Job) Logs(ctx context.Context) ([]string, error) {
 	return result, nil
 }
 
+// StreamLogs returns the log lines written by every pod after the given cursor,
+// asking the API server only for the lines newer than the last one read.
+func (j *Job) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	pods, err := j.client.Services.Core.Pods(j.client.Namespace).List(ctx, kubernetes_meta.ListOptions{
+		LabelSelector: fmt.Sprintf("controller-uid=%s", j.Resource.Spec.Selector.MatchLabels["controller-uid"]),
+	})
+	if err != nil {
+		return nil, cursor, err
+	}
+
+	result := cursor.Copy()
+	var lines []common.LogLine
+	for _, pod := range pods.Items {
+		position := cursor[pod.Name]
+		options := &kubernetes_core.PodLogOptions{
+			Timestamps: true,
+		}
+		if !position.Time.IsZero() {
+			// SinceTime has a resolution of seconds, so lines are filtered again below.
+			options.SinceTime = &kubernetes_meta.Time{Time: position.Time}
+		}
+
+		logs, err := j.client.Services.Core.Pods(j.client.Namespace).GetLogs(pod.Name, options).Stream(ctx)
+		if err != nil {
+			if statusErr, ok := err.(*kubernetes_errors.StatusError); ok && strings.HasSuffix(statusErr.ErrStatus.Message, "ContainerCreating") {
+				continue
+			}
+			return nil, cursor, err
+		}
+
+		scanner := bufio.NewScanner(logs)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			line := common.ParseLogLine(pod.Name, scanner.Text())
+			if !position.Time.IsZero() && !line.Time.After(position.Time) {
+				continue
+			}
+			lines = append(lines, line)
+			result[pod.Name] = common.LogPosition{Time: line.Time}
+		}
+		logs.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, cursor, err
+		}
+	}
+
+	return lines, result, nil
+}
+
+// podStatus describes the state of a job pod as a task machine.
+func podStatus(pod kubernetes_core.Pod) common.MachineStatus {
+	machine := common.MachineStatus{
+		Machine: pod.Name,
+		Address: net.ParseIP(pod.Status.PodIP),
+	}
+	if pod.Status.StartTime != nil {
+		machine.Started = pod.Status.StartTime.Time
+	}
+	for _, container := range pod.Status.ContainerStatuses {
+		if terminated := container.State.Terminated; terminated != nil {
+			code := int(terminated.ExitCode)
+			machine.ExitCode = &code
+			machine.Finished = terminated.FinishedAt.Time
+			machine.Result = terminationResult(terminated)
+		}
+	}
+
+	switch pod.Status.Phase {
+	case kubernetes_core.PodPending:
+		machine.Phase = common.PhaseQueued
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == kubernetes_core.PodScheduled && condition.Status == kubernetes_core.ConditionTrue {
+				machine.Phase = common.PhaseProvisioning
+			}
+		}
+	case kubernetes_core.PodRunning:
+		machine.Phase = common.PhaseRunning
+	case kubernetes_core.PodSucceeded:
+		machine.Phase = common.PhaseSucceeded
+	case kubernetes_core.PodFailed:
+		machine.Phase = common.PhaseFailed
+		if pod.Status.Reason == "DeadlineExceeded" {
+			machine.Phase = common.PhaseTimedOut
+			machine.Result = "timeout"
+		}
+	default:
+		machine.Phase = common.PhaseQueued
+	}
+
+	return machine
+}
+
+// terminationResult maps container termination reasons to systemd service results.
+func terminationResult(terminated *kubernetes_core.ContainerStateTerminated) string {
+	switch terminated.Reason {
+	case "Completed":
+		return "success"
+	case "OOMKilled":
+		return "oom-kill"
+	case "DeadlineExceeded":
+		return "timeout"
+	}
+	if terminated.Signal != 0 {
+		return "signal"
+	}
+	return "exit-code"
+}
+
 // VolumeInfoProvider is implemented by persistent volume claims.
 type VolumeInfoProvider interface {
 	VolumeInfo(context.Context) (string /*subpath*/, *kubernetes_core.PersistentVolumeClaimVolumeSource)
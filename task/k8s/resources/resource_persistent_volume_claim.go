@@ -14,6 +14,31 @@ import (
 	"terraform-provider-iterative/task/k8s/client"
 )
 
+// ListPersistentVolumeClaims returns the persistent volume claims named after
+// a task identifier.
+func ListPersistentVolumeClaims(ctx context.Context, client *client.Client) ([]common.TaskResource, error) {
+	claims, err := client.Services.Core.PersistentVolumeClaims(client.Namespace).List(ctx, kubernetes_meta.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []common.TaskResource{}
+	for _, claim := range claims.Items {
+		if id, err := common.ParseIdentifier(claim.ObjectMeta.Name); err == nil {
+			result = append(result, common.TaskResource{
+				Identifier: id,
+				Type:       "PersistentVolumeClaim",
+				Name:       claim.ObjectMeta.Name,
+				Created:    claim.ObjectMeta.CreationTimestamp.Time,
+				Tags:       claim.ObjectMeta.Labels,
+				Delete:     NewPersistentVolumeClaim(client, id, "", 0, false).Delete,
+			})
+		}
+	}
+
+	return result, nil
+}
+
 func NewPersistentVolumeClaim(client *client.Client, identifier common.Identifier, storageClass string, size int, many bool) *PersistentVolumeClaim {
 	p := &PersistentVolumeClaim{
 		client:     client,
@@ -80,6 +105,34 @@ func (p *PersistentVolumeClaim) Create(ctx context.Context) error {
 	return p.Read(ctx)
 }
 
+// Plan describes the persistent volume claim that Create would make.
+func (p *PersistentVolumeClaim) Plan() common.PlannedResource {
+	accessMode := kubernetes_core.ReadWriteOnce
+	if p.Attributes.Many {
+		accessMode = kubernetes_core.ReadWriteMany
+	}
+
+	size := p.Attributes.Size
+	if size <= 0 {
+		size = 1
+	}
+
+	storageClass := p.Attributes.StorageClass
+	if storageClass == "" {
+		storageClass = "default"
+	}
+
+	return common.PlannedResource{
+		Type: "PersistentVolumeClaim",
+		Name: p.Identifier,
+		Attributes: map[string]string{
+			"storage_class": storageClass,
+			"size":          common.DiskSize(size),
+			"access_mode":   string(accessMode),
+		},
+	}
+}
+
 func (p *PersistentVolumeClaim) Read(ctx context.Context) error {
 	persistentVolumeClaim, err := p.client.Services.Core.PersistentVolumeClaims(p.client.Namespace).Get(ctx, p.Identifier, kubernetes_meta.GetOptions{})
 	if err != nil {
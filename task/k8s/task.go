@@ -2,6 +2,7 @@ package k8s
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -30,7 +31,38 @@ func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error)
 		return nil, err
 	}
 
-	return resources.ListConfigMaps(ctx, client)
+	configMaps, err := resources.ListConfigMaps(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.TaskIdentifiers(configMaps), nil
+}
+
+// ListResources returns every resource named after a task identifier, in
+// creation order, including those left behind by failed deletions.
+func ListResources(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error) {
+	lists := []func(context.Context, *client.Client) ([]common.TaskResource, error){
+		resources.ListConfigMaps,
+		resources.ListPersistentVolumeClaims,
+		resources.ListJobs,
+	}
+
+	client, err := client.New(ctx, cloud, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []common.TaskResource
+	for _, list := range lists {
+		found, err := list(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+
+	return result, nil
 }
 
 func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (*Task, error) {
@@ -127,45 +159,73 @@ type Task struct {
 }
 
 func (t *Task) Create(ctx context.Context) error {
+	manifest := common.NewManifest(t.Identifier, t.Client.Cloud, t.Attributes.Task)
+	// Directories may name a storage class and size instead of a path.
+	manifest.Task.Environment.Directory = t.Attributes.Task.Environment.Directory
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	t.Resources.ConfigMap.Attributes[resources.ManifestKey] = string(contents)
+
 	logrusctx.Info(ctx, "Creating resources...")
 	steps := []common.Step{{
+		Name:        "permission-set",
 		Description: "Parsing PermissionSet...",
 		Action:      t.DataSources.PermissionSet.Read,
 	}, {
+		Name:        "config-map",
 		Description: "Creating ConfigMap...",
 		Action:      t.Resources.ConfigMap.Create,
+		Rollback:    t.Resources.ConfigMap.Delete,
+		Resume:      t.Resources.ConfigMap.Read,
 	}}
+	jobDependencies := []string{"permission-set", "config-map"}
 	if t.Resources.PersistentVolumeClaim != nil {
 		steps = append(steps, common.Step{
+			Name:        "persistent-volume-claim",
 			Description: "Creating PersistentVolumeClaim...",
 			Action:      t.Resources.PersistentVolumeClaim.Create,
+			Rollback:    t.Resources.PersistentVolumeClaim.Delete,
+			Resume:      t.Resources.PersistentVolumeClaim.Read,
 		})
+		jobDependencies = append(jobDependencies, "persistent-volume-claim")
 	}
 
 	if t.Attributes.Directory != "" {
 		env := map[string]string{
 			"TPI_TRANSFER_MODE": "true",
 		}
-		steps = append(steps, []common.Step{{
-			Description: "Deleting Job...",
-			Action:      withEnv(env, t.Resources.Job.Delete),
+		upload := common.Sequence([]common.Step{{
+			Name:         "upload-delete-job",
+			Description:  "Deleting Job...",
+			Action:       withEnv(env, t.Resources.Job.Delete),
+			Dependencies: jobDependencies,
 		}, {
+			Name:        "upload-create-job",
 			Description: "Creating ephemeral Job to upload directory...",
 			Action:      withEnv(env, t.Resources.Job.Create),
+			Rollback:    t.Resources.Job.Delete,
 		}, {
+			Name:        "upload-push",
 			Description: "Uploading Directory...",
 			Action:      withEnv(env, t.Push),
 		}, {
+			Name:        "upload-delete-ephemeral-job",
 			Description: "Deleting ephemeral Job to upload directory...",
 			Action:      withEnv(env, t.Resources.Job.Delete),
-		}}...)
+		}})
+		steps = append(steps, upload...)
+		jobDependencies = []string{"upload-delete-ephemeral-job"}
 	}
 
 	steps = append(steps, common.Step{
-		Description: "Creating Job...",
-		Action:      t.Resources.Job.Create,
+		Description:  "Creating Job...",
+		Action:       t.Resources.Job.Create,
+		Dependencies: jobDependencies,
+		Rollback:     t.Resources.Job.Delete,
 	})
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunStepsWithProgress(ctx, steps, common.NewProgress(t.Identifier)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Creation completed")
@@ -175,6 +235,35 @@ func (t *Task) Create(ctx context.Context) error {
 	return nil
 }
 
+// Plan resolves the data sources and describes the resources that Create
+// would make, without creating anything.
+func (t *Task) Plan(ctx context.Context) ([]common.PlannedResource, error) {
+	logrusctx.Info(ctx, "Planning resources...")
+	steps := []common.Step{{
+		Description: "Parsing PermissionSet...",
+		Action:      t.DataSources.PermissionSet.Read,
+	}}
+	if t.DataSources.ExistingPersistentVolumeClaim != nil {
+		steps = append(steps, common.Step{
+			Description: "Reading PersistentVolumeClaim...",
+			Action:      t.DataSources.ExistingPersistentVolumeClaim.Read,
+		})
+	}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return nil, err
+	}
+
+	plan := []common.PlannedResource{t.Resources.ConfigMap.Plan()}
+	if t.Resources.PersistentVolumeClaim != nil {
+		plan = append(plan, t.Resources.PersistentVolumeClaim.Plan())
+	}
+	job, err := t.Resources.Job.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return append(plan, job), nil
+}
+
 func (t *Task) Read(ctx context.Context) error {
 	logrusctx.Info(ctx, "Reading resources... (this may happen several times)")
 	steps := []common.Step{{
@@ -194,7 +283,7 @@ func (t *Task) Read(ctx context.Context) error {
 		Description: "Reading Job...",
 		Action:      t.Resources.Job.Read,
 	}}
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Read completed")
@@ -204,6 +293,28 @@ func (t *Task) Read(ctx context.Context) error {
 	return nil
 }
 
+// Update applies the current attributes to an existing task: it relabels the
+// resources, refreshes the task script and rescales the job.
+func (t *Task) Update(ctx context.Context) error {
+	if err := t.Read(ctx); err != nil {
+		return err
+	}
+
+	logrusctx.Info(ctx, "Updating resources...")
+	steps := []common.Step{{
+		Description: "Updating ConfigMap...",
+		Action:      t.Resources.ConfigMap.Update,
+	}, {
+		Description: "Updating Job...",
+		Action:      t.Resources.Job.Update,
+	}}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Update completed")
+	return nil
+}
+
 func (t *Task) Delete(ctx context.Context) error {
 	logrusctx.Info(ctx, "Deleting resources...")
 	steps := []common.Step{}
@@ -243,7 +354,10 @@ func (t *Task) Delete(ctx context.Context) error {
 		})
 	}
 
-	if err := common.RunSteps(ctx, steps); err != nil {
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	if err := common.DeleteProgress(t.Identifier); err != nil {
 		return err
 	}
 	logrusctx.Info(ctx, "Deletion completed")
@@ -299,6 +413,29 @@ func (t *Task) Pull(ctx context.Context) error {
 			t.Attributes.Environment.ExcludeList))
 }
 
+// Manifest returns the manifest kept in the config map, as Kubernetes tasks
+// don't have a remote storage.
+func (t *Task) Manifest(ctx context.Context) (*common.Manifest, error) {
+	if err := t.Resources.ConfigMap.Read(ctx); err != nil {
+		return nil, err
+	}
+	contents, ok := t.Resources.ConfigMap.Resource.Data[resources.ManifestKey]
+	if !ok {
+		return nil, common.NotFoundError
+	}
+	return common.ParseManifest([]byte(contents))
+}
+
+// Storage isn't implemented, as tasks keep their data in a persistent volume
+// claim instead of object storage.
+func (t *Task) Storage(ctx context.Context) (string, error) {
+	return "", common.NotImplementedError
+}
+
+func (t *Task) Queue(ctx context.Context) (common.QueueStatus, error) {
+	return common.QueueStatus{}, common.NotImplementedError
+}
+
 func (t *Task) Status(ctx context.Context) (common.Status, error) {
 	return t.Attributes.Status, nil
 }
@@ -311,6 +448,10 @@ func (t *Task) Logs(ctx context.Context) ([]string, error) {
 	return t.Resources.Job.Logs(ctx)
 }
 
+func (t *Task) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	return t.Resources.Job.StreamLogs(ctx, cursor)
+}
+
 func (t *Task) Start(ctx context.Context) error {
 	// FIXME: try experimental https://kubernetes.io/docs/concepts/workloads/controllers/job/#suspending-a-job
 	return common.NotImplementedError
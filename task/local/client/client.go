@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"terraform-provider-iterative/task/common"
+)
+
+func New(ctx context.Context, cloud common.Cloud, tags map[string]string) (*Client, error) {
+	// TPI_LOCAL_DIRECTORY plays the role of the cloud account: every task
+	// gets its own subdirectory, named after the task identifier.
+	directory := os.Getenv("TPI_LOCAL_DIRECTORY")
+	if directory == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		directory = filepath.Join(cache, "tpi")
+	}
+
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Cloud:     cloud,
+		Region:    string(cloud.Region),
+		Tags:      tags,
+		Directory: directory,
+	}
+	return c, nil
+}
+
+type Client struct {
+	Cloud     common.Cloud
+	Region    string
+	Tags      map[string]string
+	Directory string
+}
@@ -0,0 +1,42 @@
+package resources
+
+import (
+	"context"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/local/client"
+)
+
+func NewCredentials(client *client.Client, identifier common.Identifier, storage common.StorageCredentials) *Credentials {
+	c := &Credentials{
+		client:     client,
+		Identifier: identifier.Long(),
+	}
+	c.Dependencies.Storage = storage
+	return c
+}
+
+type Credentials struct {
+	client       *client.Client
+	Identifier   string
+	Dependencies struct {
+		Storage common.StorageCredentials
+	}
+	Resource map[string]string
+}
+
+func (c *Credentials) Read(ctx context.Context) error {
+	connectionString, err := c.Dependencies.Storage.ConnectionString(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.Resource = map[string]string{
+		"RCLONE_REMOTE":           connectionString,
+		"TPI_TASK_CLOUD_PROVIDER": string(c.client.Cloud.Provider),
+		"TPI_TASK_CLOUD_REGION":   c.client.Region,
+		"TPI_TASK_IDENTIFIER":     c.Identifier,
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+)
+
+// NewExistingDirectory creates a new data source referring to a pre-allocated local directory.
+func NewExistingDirectory(storageParams common.RemoteStorage) *ExistingDirectory {
+	return &ExistingDirectory{
+		params: storageParams,
+	}
+}
+
+// ExistingDirectory identifies a pre-allocated storage directory.
+type ExistingDirectory struct {
+	params common.RemoteStorage
+}
+
+// Read verifies the specified storage directory is accessible.
+func (d *ExistingDirectory) Read(ctx context.Context) error {
+	connection := d.connection()
+	err := machine.CheckStorage(ctx, connection)
+	if err != nil {
+		return fmt.Errorf("failed to verify storage: %w", err)
+	}
+	return nil
+}
+
+func (d *ExistingDirectory) connection() machine.RcloneConnection {
+	return machine.RcloneConnection{
+		Backend:   machine.RcloneBackendLocal,
+		Container: d.params.Container,
+		Path:      d.params.Path,
+	}
+}
+
+// ConnectionString implements common.StorageCredentials.
+// The method returns the rclone connection string for the specific directory.
+func (d *ExistingDirectory) ConnectionString(ctx context.Context) (string, error) {
+	return d.connection().String(), nil
+}
+
+// StoragePath implements Storage.
+func (d *ExistingDirectory) StoragePath() string {
+	return filepath.Join(d.params.Container, d.params.Path)
+}
+
+var _ Storage = (*ExistingDirectory)(nil)
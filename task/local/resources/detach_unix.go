@@ -0,0 +1,14 @@
+//go:build !windows
+
+package resources
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the command in a session of its own, so it doesn't receive
+// the signals sent to the terminal of the current process.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
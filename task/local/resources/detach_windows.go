@@ -0,0 +1,14 @@
+//go:build windows
+
+package resources
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts the command in a process group of its own, so it doesn't
+// receive the console signals sent to the current process.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
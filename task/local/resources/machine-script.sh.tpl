@@ -0,0 +1,224 @@
+#!/bin/bash
+# Every process running this script plays the role of a task machine: it
+# copies the task data from the storage directory, runs the task script and
+# writes its logs and status report to the storage directory.
+TPI_MACHINE_IDENTITY="$1"
+TPI_STORAGE_DIRECTORY={{.Storage}}
+TPI_MACHINES_DIRECTORY={{.Machines}}
+TPI_MACHINE_DIRECTORY="$TPI_MACHINES_DIRECTORY/$TPI_MACHINE_IDENTITY"
+TPI_DATA_DIRECTORY="$TPI_MACHINE_DIRECTORY/directory"
+TPI_CHECKPOINT_DIRECTORY="$TPI_MACHINE_DIRECTORY/checkpoint"
+TPI_TASK_SCRIPT={{.TaskScript}}
+
+base64 --decode << END > "$TPI_MACHINE_DIRECTORY/credentials"
+{{.Credentials}}
+END
+source "$TPI_MACHINE_DIRECTORY/credentials"
+
+base64 --decode << END > "$TPI_MACHINE_DIRECTORY/variables"
+{{.Environment}}
+END
+source "$TPI_MACHINE_DIRECTORY/variables"
+
+mkdir -p "$TPI_DATA_DIRECTORY" "$TPI_CHECKPOINT_DIRECTORY" "$TPI_STORAGE_DIRECTORY/data" "$TPI_STORAGE_DIRECTORY/reports"
+cp -R "$TPI_STORAGE_DIRECTORY/data/." "$TPI_DATA_DIRECTORY"
+# Processes with an output directory of their own don't copy the ones of other processes.
+test -n "$TPI_PER_MACHINE_OUTPUT" && rm -rf "$TPI_DATA_DIRECTORY/machines"
+
+# Pipeline stages copy the outputs of the stages they need from their storage,
+# after the working directory, so they take precedence; without rclone, only
+# local storage directories can be copied.
+tpi_input() {
+  mkdir -p "$TPI_DATA_DIRECTORY/$2"
+  if command -v rclone > /dev/null; then
+    RCLONE_CONFIG= rclone copy "$1" "$TPI_DATA_DIRECTORY/$2" && return
+  else
+    cp -R "${1#:local:}/." "$TPI_DATA_DIRECTORY/$2" && return
+  fi
+  TPI_INPUTS_FAILED="$2"
+}
+base64 --decode << END > "$TPI_MACHINE_DIRECTORY/inputs"
+{{.Inputs}}
+END
+source "$TPI_MACHINE_DIRECTORY/inputs"
+
+# The storage directory lock makes leasing task indexes and work items atomic.
+tpi_lock() {
+  until mkdir "$TPI_STORAGE_DIRECTORY/lease.lock" 2> /dev/null; do sleep 0.1; done
+}
+tpi_unlock() {
+  rmdir "$TPI_STORAGE_DIRECTORY/lease.lock"
+}
+
+# Every process leases the lowest index below TPI_TASK_COUNT that isn't held by
+# another process, even a finished one, until its machine directory is removed.
+export TPI_TASK_COUNT="${TPI_TASK_COUNT:-1}"
+tpi_task_index_held() {
+  for lease in "$TPI_STORAGE_DIRECTORY"/reports/index-*; do
+    test -f "$lease" || continue
+    read -r index holder < "$lease"
+    test "$index" = "$1" && test "$holder" != "$TPI_MACHINE_IDENTITY" || continue
+    test -d "$TPI_MACHINES_DIRECTORY/$holder" && return 0
+  done
+  return 1
+}
+tpi_lock
+TPI_TASK_INDEX=0
+while (( TPI_TASK_INDEX < TPI_TASK_COUNT - 1 )) && tpi_task_index_held "$TPI_TASK_INDEX"; do
+  TPI_TASK_INDEX=$((TPI_TASK_INDEX + 1))
+done
+echo "$TPI_TASK_INDEX $TPI_MACHINE_IDENTITY" > "$TPI_STORAGE_DIRECTORY/reports/index-$TPI_MACHINE_IDENTITY"
+tpi_unlock
+export TPI_TASK_INDEX
+
+# Processes that find a checkpoint left by the previous holder of their task
+# index resume from it; every resume is recorded under the task index.
+TPI_CHECKPOINT_TARGET="$TPI_STORAGE_DIRECTORY/checkpoint/$TPI_TASK_INDEX"
+export TPI_CHECKPOINT_DIR="$TPI_CHECKPOINT_DIRECTORY" TPI_RESUMED=false TPI_RESUME_COUNT=0
+if test -n "$(find "$TPI_CHECKPOINT_TARGET" -type f 2> /dev/null | head -1)"; then
+  cp -R "$TPI_CHECKPOINT_TARGET/." "$TPI_CHECKPOINT_DIRECTORY"
+  date -u +%Y-%m-%dT%H:%M:%SZ >> "$TPI_STORAGE_DIRECTORY/reports/resumed-$TPI_TASK_INDEX"
+  TPI_RESUMED=true
+  TPI_RESUME_COUNT="$(grep -c . "$TPI_STORAGE_DIRECTORY/reports/resumed-$TPI_TASK_INDEX")"
+fi
+
+# Checkpoints are only ever added or replaced in the storage directory.
+tpi_checkpoint() {
+  mkdir -p "$TPI_CHECKPOINT_TARGET"
+  cp -R "$TPI_CHECKPOINT_DIRECTORY/." "$TPI_CHECKPOINT_TARGET"
+}
+
+# Processes with an output directory of their own sync to it, after picking up
+# the outputs of the process they replace.
+TPI_DATA_TARGET="$TPI_STORAGE_DIRECTORY/data"
+if test -n "$TPI_PER_MACHINE_OUTPUT"; then
+  TPI_DATA_TARGET="$TPI_STORAGE_DIRECTORY/data/machines/$TPI_TASK_INDEX"
+  test -d "$TPI_DATA_TARGET" && cp -R "$TPI_DATA_TARGET/." "$TPI_DATA_DIRECTORY"
+fi
+
+# In queue mode, the task script runs once for every work item claimed from the
+# queue, until every item is done or failed. Items leased by processes that are
+# gone go back to the queue, and so do items whose script fails, recorded
+# through retried-<item>-<attempt> reports, until they run out of retries.
+tpi_queue_leased() {
+  for lease in "$TPI_STORAGE_DIRECTORY"/reports/lease-*; do
+    test -f "$lease" || continue
+    read -r item holder < "$lease"
+    test "$holder" != "$TPI_MACHINE_IDENTITY" && test -d "$TPI_MACHINES_DIRECTORY/$holder" || continue
+    if test -f "$TPI_MACHINES_DIRECTORY/$holder/pid" && ! kill -0 "$(cat "$TPI_MACHINES_DIRECTORY/$holder/pid")" 2> /dev/null; then
+      continue
+    fi
+    echo "$item"
+  done
+}
+
+tpi_queue_next() {
+  { ls "$TPI_STORAGE_DIRECTORY/reports" | sed -n -e 's/^done-//p' -e 's/^failed-//p'; tpi_queue_leased; } |
+    awk -v size="$1" -v offset="$((TPI_TASK_INDEX * $1 / TPI_TASK_COUNT))" \
+      '{taken[$1]} END {for (step = 0; step < size; step++) {item = (offset + step) % size + 1; if (!(item in taken)) {print item; exit}}}'
+}
+
+tpi_task() {
+  if test -n "$TPI_INPUTS_FAILED"; then
+    echo "Failed to copy input $TPI_INPUTS_FAILED"
+    return 1
+  fi
+  test -z "$TPI_WORK_QUEUE" && exec "$TPI_TASK_SCRIPT"
+
+  trap 'kill -TERM "$TPI_WORK_ITEM_PID" 2> /dev/null; exit 143' TERM
+  local size item code report retries failures=0
+  size=$(($(wc -l < "$TPI_STORAGE_DIRECTORY/queue/items")))
+  while true; do
+    tpi_lock
+    item="$(tpi_queue_next "$size")"
+    test -n "$item" && echo "$item $TPI_MACHINE_IDENTITY" > "$TPI_STORAGE_DIRECTORY/reports/lease-$TPI_MACHINE_IDENTITY"
+    tpi_unlock
+    if test -z "$item"; then
+      test -z "$(tpi_queue_leased)" && break
+      sleep 1
+      continue
+    fi
+
+    export TPI_WORK_ITEM="$(sed -n "${item}p" "$TPI_STORAGE_DIRECTORY/queue/items")"
+    echo "Running work item $item of $size: $TPI_WORK_ITEM"
+    "$TPI_TASK_SCRIPT" &
+    TPI_WORK_ITEM_PID=$!
+    wait "$TPI_WORK_ITEM_PID"
+    code=$?
+
+    report="done-$item"
+    if test "$code" != 0; then
+      retries=$(ls "$TPI_STORAGE_DIRECTORY/reports" | grep -c "^retried-$item-")
+      if (( retries < ${TPI_QUEUE_RETRIES:-0} )); then
+        report="retried-$item-$((retries + 1))"
+      else
+        report="failed-$item"
+        failures=$((failures + 1))
+      fi
+    fi
+    echo "$TPI_MACHINE_IDENTITY $code" > "$TPI_STORAGE_DIRECTORY/reports/$report"
+    rm -f "$TPI_STORAGE_DIRECTORY/reports/lease-$TPI_MACHINE_IDENTITY"
+  done
+  test "$failures" = 0
+}
+
+tpi_log() {
+  while IFS= read -r line; do
+    printf '%s %s\n' "$(date -u +%Y-%m-%dT%H:%M:%SZ)" "$line"
+  done >> "$TPI_STORAGE_DIRECTORY/reports/task-$TPI_MACHINE_IDENTITY"
+}
+
+# rclone replaces every file atomically; without it, the data directory is
+# copied aside and swapped in under the storage directory lock, so processes
+# finishing at the same time don't interleave their copies.
+tpi_sync() {
+  mkdir -p "$TPI_DATA_TARGET"
+  if command -v rclone > /dev/null; then
+    RCLONE_CONFIG= rclone sync "$TPI_DATA_DIRECTORY" "$TPI_DATA_TARGET"
+    return
+  fi
+  rm -rf "$TPI_STORAGE_DIRECTORY/data.$TPI_MACHINE_IDENTITY"
+  cp -R "$TPI_DATA_DIRECTORY" "$TPI_STORAGE_DIRECTORY/data.$TPI_MACHINE_IDENTITY"
+  tpi_lock
+  rm -rf "$TPI_DATA_TARGET"
+  mv "$TPI_STORAGE_DIRECTORY/data.$TPI_MACHINE_IDENTITY" "$TPI_DATA_TARGET"
+  tpi_unlock
+}
+
+trap '' HUP
+trap 'TPI_STOPPED=true; kill -TERM "$TPI_TASK_PID" 2> /dev/null' TERM INT
+
+TPI_REMAINING_RUN_TIME=$(({{.Timeout}}-$(date +%s)))
+if (( TPI_REMAINING_RUN_TIME < 1 )); then
+  touch "$TPI_MACHINE_DIRECTORY/timeout"
+else
+  cd "$TPI_DATA_DIRECTORY"
+  tpi_task > >(tpi_log) 2>&1 &
+  TPI_TASK_PID=$!
+
+  (sleep "$TPI_REMAINING_RUN_TIME" && touch "$TPI_MACHINE_DIRECTORY/timeout" && kill -TERM "$TPI_TASK_PID") > /dev/null 2>&1 &
+  TPI_TIMER_PID=$!
+
+  while sleep "${TPI_CHECKPOINT_INTERVAL:-60}"; do tpi_checkpoint; done &
+  TPI_CHECKPOINT_PID=$!
+
+  wait "$TPI_TASK_PID"
+  TPI_EXIT_CODE=$?
+  # wait returns early when a trap fires; keep waiting until the script exits.
+  while kill -0 "$TPI_TASK_PID" 2> /dev/null; do
+    wait "$TPI_TASK_PID"
+    TPI_EXIT_CODE=$?
+  done
+  kill "$TPI_TIMER_PID" "$TPI_CHECKPOINT_PID" 2> /dev/null
+fi
+
+tpi_checkpoint
+tpi_sync
+
+if test -f "$TPI_MACHINE_DIRECTORY/timeout"; then
+  echo '{"result": "timeout", "code": "", "status": ""}' > "$TPI_STORAGE_DIRECTORY/reports/status-$TPI_MACHINE_IDENTITY"
+elif test -z "$TPI_STOPPED"; then
+  TPI_RESULT=success
+  test "$TPI_EXIT_CODE" != 0 && TPI_RESULT=exit-code
+  echo "{\"result\": \"$TPI_RESULT\", \"code\": \"$TPI_EXIT_CODE\", \"status\": \"exited\"}" > "$TPI_STORAGE_DIRECTORY/reports/status-$TPI_MACHINE_IDENTITY"
+fi
@@ -0,0 +1,121 @@
+package resources
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/local/client"
+)
+
+func ListDirectories(ctx context.Context, client *client.Client) ([]common.Identifier, error) {
+	entries, err := os.ReadDir(client.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []common.Identifier{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if id, err := common.ParseIdentifier(entry.Name()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func NewDirectory(client *client.Client, identifier common.Identifier) *Directory {
+	d := &Directory{
+		client:     client,
+		Identifier: identifier.Long(),
+	}
+	d.Attributes.Path = filepath.Join(client.Directory, d.Identifier)
+	return d
+}
+
+// Directory is the local counterpart of cloud buckets and resource groups:
+// it holds the task storage and the state of its processes.
+type Directory struct {
+	client     *client.Client
+	Identifier string
+	Attributes struct {
+		Path string
+	}
+	Resource os.FileInfo
+}
+
+func (d *Directory) Create(ctx context.Context) error {
+	if err := os.MkdirAll(d.Attributes.Path, 0755); err != nil {
+		return err
+	}
+
+	return d.Read(ctx)
+}
+
+// Plan describes the directory that Create would make.
+func (d *Directory) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "Directory",
+		Name: d.Identifier,
+		Attributes: map[string]string{
+			"path": d.Attributes.Path,
+		},
+	}
+}
+
+func (d *Directory) Read(ctx context.Context) error {
+	info, err := os.Stat(d.Attributes.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.NotFoundError
+		}
+		return err
+	}
+
+	d.Resource = info
+	return nil
+}
+
+func (d *Directory) Update(ctx context.Context) error {
+	return common.NotImplementedError
+}
+
+func (d *Directory) Delete(ctx context.Context) error {
+	if err := os.RemoveAll(d.Attributes.Path); err != nil {
+		return err
+	}
+
+	d.Resource = nil
+	return nil
+}
+
+// ConnectionString implements common.StorageCredentials.
+// The method returns the rclone connection string for the directory.
+func (d *Directory) ConnectionString(ctx context.Context) (string, error) {
+	connection := machine.RcloneConnection{
+		Backend:   machine.RcloneBackendLocal,
+		Container: d.Attributes.Path,
+	}
+	return connection.String(), nil
+}
+
+// StoragePath implements Storage.
+func (d *Directory) StoragePath() string {
+	return d.Attributes.Path
+}
+
+// Storage is implemented by resources and data sources that provide a local
+// directory to be used as task storage.
+type Storage interface {
+	common.StorageCredentials
+	// StoragePath returns the absolute path of the storage directory.
+	StoragePath() string
+}
+
+// build-time check to ensure Directory implements Storage.
+var _ Storage = (*Directory)(nil)
@@ -0,0 +1,363 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/0x2b3bfa0/logrusctx"
+	"github.com/alessio/shellescape"
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/process"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/local/client"
+)
+
+//go:embed machine-script.sh.tpl
+var machineScript string
+
+var machineScriptTemplate = template.Must(template.New("machine-script").Parse(machineScript))
+
+func NewProcessGroup(client *client.Client, identifier common.Identifier, directory *Directory, storage Storage, credentials *Credentials, task *common.Task) *ProcessGroup {
+	p := &ProcessGroup{
+		client:     client,
+		Identifier: identifier.Long(),
+	}
+	p.Attributes.Environment = task.Environment
+	p.Attributes.Parallelism = &task.Parallelism
+	p.Dependencies.Directory = directory
+	p.Dependencies.Storage = storage
+	p.Dependencies.Credentials = credentials
+	return p
+}
+
+// ProcessGroup is the local counterpart of cloud scaling groups: it keeps
+// up to Parallelism processes running the task script.
+type ProcessGroup struct {
+	client     *client.Client
+	Identifier string
+	// Created is the creation time of the task, which the process deadline
+	// counts from; it's zero for tasks being created.
+	Created    time.Time
+	Attributes struct {
+		Environment common.Environment
+		Parallelism *uint16
+		Addresses   []net.IP
+		Status      common.Status
+		Events      []common.Event
+	}
+	Dependencies struct {
+		Directory   *Directory
+		Storage     Storage
+		Credentials *Credentials
+	}
+	Resource []Process
+}
+
+// Process describes a single process of the group.
+type Process struct {
+	Identity string
+	PID      int
+	Active   bool
+	Started  time.Time
+}
+
+func (p *ProcessGroup) Create(ctx context.Context) error {
+	if _, err := os.Stat(p.scriptPath()); err == nil {
+		return p.Read(ctx)
+	}
+
+	for _, directory := range []string{
+		p.machinesPath(),
+		filepath.Join(p.Dependencies.Storage.StoragePath(), "data"),
+		filepath.Join(p.Dependencies.Storage.StoragePath(), "reports"),
+	} {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			return err
+		}
+	}
+
+	if err := p.writeScripts(); err != nil {
+		return err
+	}
+
+	return p.Read(ctx)
+}
+
+// UpdateScript renders the machine script again with the current environment
+// and timeout, so processes launched afterwards pick up the changes.
+func (p *ProcessGroup) UpdateScript(ctx context.Context) error {
+	if err := p.Read(ctx); err != nil {
+		return err
+	}
+
+	return p.writeScripts()
+}
+
+// writeScripts writes the task script and the machine script that runs it.
+func (p *ProcessGroup) writeScripts() error {
+	if err := os.WriteFile(p.taskScriptPath(), []byte(p.Attributes.Environment.Script), 0755); err != nil {
+		return err
+	}
+
+	timeout := machine.Deadline(p.Created, p.Attributes.Environment.Timeout)
+	script, err := p.script(&timeout)
+	if err != nil {
+		return fmt.Errorf("failed to render machine script: %w", err)
+	}
+
+	return os.WriteFile(p.scriptPath(), []byte(script), 0755)
+}
+
+// Plan describes the process group that Create would make.
+func (p *ProcessGroup) Plan() common.PlannedResource {
+	return common.PlannedResource{
+		Type: "ProcessGroup",
+		Name: p.Identifier,
+		Attributes: map[string]string{
+			"storage":     p.Dependencies.Storage.StoragePath(),
+			"parallelism": strconv.Itoa(int(*p.Attributes.Parallelism)),
+		},
+	}
+}
+
+func (p *ProcessGroup) Read(ctx context.Context) error {
+	entries, err := os.ReadDir(p.machinesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.NotFoundError
+		}
+		return err
+	}
+
+	p.Resource = []Process{}
+	p.Attributes.Addresses = []net.IP{}
+	p.Attributes.Status = common.Status{}
+	p.Attributes.Events = []common.Event{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		pidFile := filepath.Join(p.machinesPath(), entry.Name(), "pid")
+		info, err := os.Stat(pidFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		contents, err := os.ReadFile(pidFile)
+		if err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+		if err != nil {
+			return err
+		}
+
+		active, err := process.PidExists(int32(pid))
+		if err != nil {
+			return err
+		}
+		logrusctx.Debug(ctx, "Process Group State:", entry.Name(), pid, active)
+
+		p.Resource = append(p.Resource, Process{
+			Identity: entry.Name(),
+			PID:      pid,
+			Active:   active,
+			Started:  info.ModTime(),
+		})
+		p.Attributes.Events = append(p.Attributes.Events, common.Event{
+			Time:        info.ModTime(),
+			Code:        "Started",
+			Description: []string{fmt.Sprintf("process %d started for machine %s", pid, entry.Name())},
+		})
+
+		// Processes that exited without a status report are considered failed.
+		machine := common.MachineStatus{
+			Machine: entry.Name(),
+			Phase:   common.PhaseFailed,
+			Started: info.ModTime(),
+		}
+		if active {
+			machine.Phase = common.PhaseRunning
+			machine.Address = net.IPv4(127, 0, 0, 1)
+			p.Attributes.Addresses = append(p.Attributes.Addresses, machine.Address)
+		}
+		p.Attributes.Status = append(p.Attributes.Status, machine)
+	}
+
+	sort.Slice(p.Attributes.Events, func(a, b int) bool {
+		return p.Attributes.Events[a].Time.Before(p.Attributes.Events[b].Time)
+	})
+
+	return nil
+}
+
+// Update launches or terminates processes until the group size matches Parallelism.
+func (p *ProcessGroup) Update(ctx context.Context) error {
+	if err := p.Read(ctx); err != nil {
+		return err
+	}
+
+	if *p.Attributes.Parallelism == 0 {
+		return p.terminate(ctx)
+	}
+
+	for count := len(p.Resource); count < int(*p.Attributes.Parallelism); count++ {
+		if err := p.launch(ctx); err != nil {
+			return err
+		}
+	}
+
+	return p.Read(ctx)
+}
+
+func (p *ProcessGroup) Delete(ctx context.Context) error {
+	if err := p.Read(ctx); err != nil {
+		if errors.Is(err, common.NotFoundError) {
+			p.Resource = nil
+			return nil
+		}
+		return err
+	}
+
+	if err := p.terminate(ctx); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(p.machinesPath()); err != nil {
+		return err
+	}
+
+	p.Resource = nil
+	return nil
+}
+
+// launch starts a new detached process running the machine script.
+func (p *ProcessGroup) launch(ctx context.Context) error {
+	identity := uuid.NewString()
+	directory := filepath.Join(p.machinesPath(), identity)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	output, err := os.Create(filepath.Join(directory, "output"))
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	// Processes must outlive the current one, so they can't be bound to ctx.
+	cmd := exec.Command("bash", p.scriptPath(), identity)
+	cmd.Dir = directory
+	cmd.Stdout = output
+	cmd.Stderr = output
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+
+	return os.WriteFile(filepath.Join(directory, "pid"), []byte(strconv.Itoa(cmd.Process.Pid)), 0644)
+}
+
+// terminate stops every active process and waits for them to exit.
+func (p *ProcessGroup) terminate(ctx context.Context) error {
+	for _, machine := range p.Resource {
+		if !machine.Active {
+			continue
+		}
+		proc, err := process.NewProcessWithContext(ctx, int32(machine.PID))
+		if err != nil {
+			continue
+		}
+		if err := proc.TerminateWithContext(ctx); err != nil {
+			return err
+		}
+	}
+
+	for deadline := time.Now().Add(p.client.Cloud.Timeouts.Delete); ; time.Sleep(time.Second) {
+		if err := p.Read(ctx); err != nil {
+			return err
+		}
+		if p.Attributes.Status.Count(common.PhaseRunning) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for processes to exit")
+		}
+	}
+
+	for _, machine := range p.Resource {
+		if err := os.RemoveAll(filepath.Join(p.machinesPath(), machine.Identity)); err != nil {
+			return err
+		}
+	}
+
+	return p.Read(ctx)
+}
+
+// script renders the machine script, reusing the environment handling of machine.Script.
+func (p *ProcessGroup) script(timeout *time.Time) (string, error) {
+	environment := ""
+	for name, value := range p.Attributes.Environment.Variables.Enrich() {
+		environment += "export " + shellescape.Quote(name+"="+value) + "\n"
+	}
+
+	credentials := ""
+	for name, value := range p.Dependencies.Credentials.Resource {
+		credentials += "export " + shellescape.Quote(name+"="+value) + "\n"
+	}
+
+	var output bytes.Buffer
+	err := machineScriptTemplate.Execute(&output, struct {
+		Storage     string
+		Machines    string
+		TaskScript  string
+		Environment string
+		Credentials string
+		Inputs      string
+		Timeout     string
+	}{
+		Storage:     shellescape.Quote(p.Dependencies.Storage.StoragePath()),
+		Machines:    shellescape.Quote(p.machinesPath()),
+		TaskScript:  shellescape.Quote(p.taskScriptPath()),
+		Environment: base64.StdEncoding.EncodeToString([]byte(environment)),
+		Credentials: base64.StdEncoding.EncodeToString([]byte(credentials)),
+		Inputs:      base64.StdEncoding.EncodeToString([]byte(machine.Inputs(p.Attributes.Environment.Inputs))),
+		Timeout:     fmt.Sprintf("%d", timeout.Unix()),
+	})
+	if err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+func (p *ProcessGroup) machinesPath() string {
+	return filepath.Join(p.Dependencies.Directory.Attributes.Path, "machines")
+}
+
+func (p *ProcessGroup) scriptPath() string {
+	return filepath.Join(p.machinesPath(), "machine-script.sh")
+}
+
+func (p *ProcessGroup) taskScriptPath() string {
+	return filepath.Join(p.machinesPath(), "task")
+}
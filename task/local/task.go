@@ -0,0 +1,325 @@
+package local
+
+import (
+	"context"
+	"net"
+
+	"github.com/0x2b3bfa0/logrusctx"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/ssh"
+	"terraform-provider-iterative/task/local/client"
+	"terraform-provider-iterative/task/local/resources"
+)
+
+func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+	client, err := client.New(ctx, cloud, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resources.ListDirectories(ctx, client)
+}
+
+func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (*Task, error) {
+	client, err := client.New(ctx, cloud, cloud.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(Task)
+	t.Client = client
+	t.Identifier = identifier
+	t.Attributes = task
+	t.RemoteStorage = machine.NewRemoteStorage(func() map[string]string {
+		return t.DataSources.Credentials.Resource
+	}, &t.Attributes.Environment)
+	t.Resources.Directory = resources.NewDirectory(
+		t.Client,
+		t.Identifier,
+	)
+	var storage resources.Storage
+	if task.RemoteStorage != nil {
+		// If a subdirectory was not specified, the task id will
+		// be used.
+		if task.RemoteStorage.Path == "" {
+			task.RemoteStorage.Path = t.Identifier.Short()
+		}
+		directory := resources.NewExistingDirectory(*task.RemoteStorage)
+		t.DataSources.Directory = directory
+		storage = directory
+	} else {
+		storage = t.Resources.Directory
+	}
+	t.DataSources.Credentials = resources.NewCredentials(
+		t.Client,
+		t.Identifier,
+		storage,
+	)
+	t.Resources.ProcessGroup = resources.NewProcessGroup(
+		t.Client,
+		t.Identifier,
+		t.Resources.Directory,
+		storage,
+		t.DataSources.Credentials,
+		&t.Attributes,
+	)
+	return t, nil
+}
+
+// Task represents a task running as local processes with all its dependent resources.
+type Task struct {
+	machine.RemoteStorage
+
+	Client      *client.Client
+	Identifier  common.Identifier
+	Attributes  common.Task
+	DataSources struct {
+		Credentials *resources.Credentials
+		Directory   *resources.ExistingDirectory
+	}
+	Resources struct {
+		Directory    *resources.Directory
+		ProcessGroup *resources.ProcessGroup
+	}
+}
+
+func (t *Task) Create(ctx context.Context) error {
+	logrusctx.Info(ctx, "Creating resources...")
+	steps := []common.Step{{
+		Name:        "directory",
+		Description: "Creating Directory...",
+		Action:      t.Resources.Directory.Create,
+		Rollback:    t.Resources.Directory.Delete,
+		Resume:      t.Resources.Directory.Read,
+	}}
+	credentialsDependencies := []string{"directory"}
+	if t.DataSources.Directory != nil {
+		steps = append(steps, common.Step{
+			Name:        "storage-directory",
+			Description: "Verifying storage directory...",
+			Action:      t.DataSources.Directory.Read,
+		})
+		credentialsDependencies = append(credentialsDependencies, "storage-directory")
+	}
+	steps = append(steps, []common.Step{{
+		Name:         "credentials",
+		Description:  "Reading Credentials...",
+		Action:       t.DataSources.Credentials.Read,
+		Dependencies: credentialsDependencies,
+	}, {
+		Name:         "process-group",
+		Description:  "Creating ProcessGroup...",
+		Action:       t.Resources.ProcessGroup.Create,
+		Dependencies: []string{"credentials"},
+		Rollback:     t.Resources.ProcessGroup.Delete,
+		Resume:       t.Resources.ProcessGroup.Read,
+	}, {
+		Name:         "manifest",
+		Description:  "Writing Manifest...",
+		Action:       t.writeManifest,
+		Dependencies: []string{"credentials"},
+	}}...)
+
+	start := []string{"process-group", "manifest"}
+	if t.Attributes.Environment.Directory != "" {
+		steps = append(steps, common.Step{
+			Name:         "push",
+			Description:  "Uploading Directory...",
+			Action:       t.Push,
+			Dependencies: []string{"credentials"},
+		})
+		start = append(start, "push")
+	}
+	if t.Attributes.Environment.Queue.Enabled() {
+		steps = append(steps, common.Step{
+			Name:         "queue",
+			Description:  "Uploading Work Items...",
+			Action:       t.UploadQueue,
+			Dependencies: []string{"credentials"},
+		})
+		start = append(start, "queue")
+	}
+	steps = append(steps, common.Step{
+		Description:  "Starting task...",
+		Action:       t.Start,
+		Dependencies: start,
+	})
+	if err := common.RunStepsWithProgress(ctx, steps, common.NewProgress(t.Identifier)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Creation completed")
+	t.Attributes.Addresses = t.Resources.ProcessGroup.Attributes.Addresses
+	t.Attributes.Status = t.Resources.ProcessGroup.Attributes.Status
+	t.Attributes.Events = t.Resources.ProcessGroup.Attributes.Events
+	return nil
+}
+
+// Plan resolves the data sources and describes the resources that Create
+// would make, without creating anything.
+func (t *Task) Plan(ctx context.Context) ([]common.PlannedResource, error) {
+	logrusctx.Info(ctx, "Planning resources...")
+	if t.DataSources.Directory != nil {
+		steps := []common.Step{{
+			Description: "Verifying storage directory...",
+			Action:      t.DataSources.Directory.Read,
+		}}
+		if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+			return nil, err
+		}
+	}
+
+	return []common.PlannedResource{
+		t.Resources.Directory.Plan(),
+		t.Resources.ProcessGroup.Plan(),
+	}, nil
+}
+
+func (t *Task) Read(ctx context.Context) error {
+	logrusctx.Info(ctx, "Reading resources... (this may happen several times)")
+	steps := []common.Step{{
+		Description: "Reading Directory...",
+		Action:      t.Resources.Directory.Read,
+	}, {
+		Description: "Reading storage directory...",
+		Action: func(ctx context.Context) error {
+			if t.DataSources.Directory != nil {
+				return t.DataSources.Directory.Read(ctx)
+			}
+			return nil
+		},
+	}, {
+		Description: "Reading Credentials...",
+		Action:      t.DataSources.Credentials.Read,
+	}, {
+		Description: "Reading Manifest...",
+		Action: func(ctx context.Context) error {
+			if err := machine.ApplyManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], &t.Client.Cloud, &t.Attributes); err != nil {
+				return err
+			}
+			t.Client.Tags = t.Client.Cloud.Tags
+			return nil
+		},
+	}, {
+		Description: "Reading ProcessGroup...",
+		Action:      t.Resources.ProcessGroup.Read,
+	}}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Read completed")
+	t.Attributes.Addresses = t.Resources.ProcessGroup.Attributes.Addresses
+	t.Attributes.Status = t.Resources.ProcessGroup.Attributes.Status
+	t.Attributes.Events = t.Resources.ProcessGroup.Attributes.Events
+	return nil
+}
+
+// Update applies the current attributes to an existing task: it refreshes the
+// machine script so new processes pick up changes to the environment and
+// timeout, and rescales the process group.
+func (t *Task) Update(ctx context.Context) error {
+	if err := t.Read(ctx); err != nil {
+		return err
+	}
+
+	// Machine deadlines count from the creation of the task, not from updates.
+	created, err := machine.CreationTime(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+	if err != nil {
+		return err
+	}
+	t.Resources.ProcessGroup.Created = created
+
+	logrusctx.Info(ctx, "Updating resources...")
+	steps := []common.Step{{
+		Description: "Updating ProcessGroup script...",
+		Action:      t.Resources.ProcessGroup.UpdateScript,
+	}, {
+		Description: "Updating ProcessGroup...",
+		Action:      t.Resources.ProcessGroup.Update,
+	}}
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Update completed")
+	return nil
+}
+
+func (t *Task) Delete(ctx context.Context) error {
+	logrusctx.Info(ctx, "Deleting resources...")
+	steps := []common.Step{}
+	if t.Read(ctx) == nil {
+		if t.Attributes.Environment.DirectoryOut != "" {
+			steps = []common.Step{{
+				Description: "Downloading Directory...",
+				Action: func(ctx context.Context) error {
+					err := t.Pull(ctx)
+					if err != nil && err != common.NotFoundError {
+						return err
+					}
+					return nil
+				}}}
+		}
+	}
+	steps = append(steps, []common.Step{{
+		Description: "Deleting ProcessGroup...",
+		Action:      t.Resources.ProcessGroup.Delete,
+	}, {
+		Description: "Deleting Directory...",
+		Action:      t.Resources.Directory.Delete,
+	}}...)
+	if err := common.RunSteps(ctx, common.Sequence(steps)); err != nil {
+		return err
+	}
+	if err := common.DeleteProgress(t.Identifier); err != nil {
+		return err
+	}
+	logrusctx.Info(ctx, "Deletion completed")
+	return nil
+}
+
+func (t *Task) Logs(ctx context.Context) ([]string, error) {
+	return machine.Logs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"])
+}
+
+func (t *Task) StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error) {
+	return machine.StreamLogs(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], cursor)
+}
+
+func (t *Task) Start(ctx context.Context) error {
+	return t.Resources.ProcessGroup.Update(ctx)
+}
+
+func (t *Task) Stop(ctx context.Context) error {
+	original := t.Attributes.Parallelism
+	defer func() { t.Attributes.Parallelism = original }()
+
+	t.Attributes.Parallelism = 0
+	return t.Resources.ProcessGroup.Update(ctx)
+}
+
+func (t *Task) GetAddresses(ctx context.Context) []net.IP {
+	return t.Attributes.Addresses
+}
+
+func (t *Task) Events(ctx context.Context) []common.Event {
+	return t.Attributes.Events
+}
+
+// writeManifest records the task specification in the remote storage.
+func (t *Task) writeManifest(ctx context.Context) error {
+	manifest := common.NewManifest(t.Identifier, t.Client.Cloud, t.Attributes)
+	return machine.WriteManifest(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], manifest)
+}
+
+func (t *Task) Status(ctx context.Context) (common.Status, error) {
+	return machine.Status(ctx, t.DataSources.Credentials.Resource["RCLONE_REMOTE"], t.Attributes.Status)
+}
+
+func (t *Task) GetKeyPair(ctx context.Context) (*ssh.DeterministicSSHKeyPair, error) {
+	return nil, common.NotImplementedError
+}
+
+func (t *Task) GetIdentifier(ctx context.Context) common.Identifier {
+	return t.Identifier
+}
@@ -0,0 +1,264 @@
+package local_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/local"
+)
+
+func TestTask(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	workdir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(workdir, "input"), []byte("data"), 0644))
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	identifier := common.NewRandomIdentifier("test")
+	task, err := local.New(ctx, cloud, identifier, common.Task{
+		Environment: common.Environment{
+			Script:       "#!/bin/sh\necho \"$GREETING\"\ncat input > output/result",
+			Variables:    common.Variables{"GREETING": strPtr("hello"), "API_TOKEN": strPtr("secret")},
+			Timeout:      time.Minute,
+			Directory:    workdir,
+			DirectoryOut: "output",
+		},
+		Parallelism: 1,
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(workdir, "output"), 0755))
+	require.NoError(t, task.Create(ctx))
+	defer task.Delete(ctx)
+
+	identifiers, err := local.List(ctx, cloud)
+	require.NoError(t, err)
+	require.Contains(t, identifiers, identifier)
+
+	var status common.Status
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		require.NoError(t, task.Read(ctx))
+		status, err = task.Status(ctx)
+		require.NoError(t, err)
+		if status.Count(common.PhaseSucceeded) > 0 {
+			break
+		}
+	}
+	require.Len(t, status, 1)
+	require.Equal(t, common.PhaseSucceeded, status[0].Phase)
+	require.Equal(t, 0, *status[0].ExitCode)
+	require.False(t, status[0].Started.IsZero())
+	require.False(t, status[0].Finished.IsZero())
+
+	require.Equal(t, []common.ExitStatus{{Machine: status[0].Machine, Code: 0, Result: "success"}}, status.ExitStatuses())
+
+	logs, err := task.Logs(ctx)
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.True(t, strings.HasSuffix(strings.TrimSpace(logs[0]), "hello"))
+
+	manifest, err := task.Manifest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, common.ManifestVersion, manifest.Version)
+	require.Equal(t, identifier.Long(), manifest.Identifier)
+	require.Equal(t, workdir, manifest.Task.Environment.Directory)
+	require.Equal(t, "hello", *manifest.Task.Environment.Variables["GREETING"])
+	require.Equal(t, common.Redacted, *manifest.Task.Environment.Variables["API_TOKEN"])
+
+	// Tasks rebuilt from their identifier pull the outputs recorded in the manifest.
+	task, err = local.New(ctx, cloud, identifier, common.Task{})
+	require.NoError(t, err)
+	require.NoError(t, task.Delete(ctx))
+	result, err := os.ReadFile(filepath.Join(workdir, "output", "result"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(result))
+
+	identifiers, err = local.List(ctx, cloud)
+	require.NoError(t, err)
+	require.NotContains(t, identifiers, identifier)
+}
+
+func TestTaskUpdate(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	identifier := common.NewRandomIdentifier("test")
+	newTask := func(greeting string, parallelism uint16) *local.Task {
+		task, err := local.New(ctx, cloud, identifier, common.Task{
+			Environment: common.Environment{
+				Script:    "#!/bin/sh\necho \"$GREETING\"",
+				Variables: common.Variables{"GREETING": strPtr(greeting)},
+				Timeout:   time.Minute,
+			},
+			Parallelism: parallelism,
+		})
+		require.NoError(t, err)
+		return task
+	}
+	waitForSucceeded := func(task *local.Task, count int) {
+		for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+			require.NoError(t, task.Read(ctx))
+			status, err := task.Status(ctx)
+			require.NoError(t, err)
+			if status.Count(common.PhaseSucceeded) >= count {
+				return
+			}
+		}
+		t.Fatalf("timed out waiting for %d machines to succeed", count)
+	}
+
+	task := newTask("hello", 1)
+	require.NoError(t, task.Create(ctx))
+	defer task.Delete(ctx)
+	waitForSucceeded(task, 1)
+
+	task = newTask("world", 2)
+	require.NoError(t, task.Update(ctx))
+	waitForSucceeded(task, 2)
+
+	logs, err := task.Logs(ctx)
+	require.NoError(t, err)
+	require.Len(t, logs, 2)
+	var greetings []string
+	for _, log := range logs {
+		fields := strings.Fields(log)
+		greetings = append(greetings, fields[len(fields)-1])
+	}
+	require.ElementsMatch(t, []string{"hello", "world"}, greetings)
+}
+
+func TestTaskCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	task, err := local.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{
+			Script: "#!/bin/sh\n" +
+				"echo \"$TPI_TASK_INDEX $TPI_RESUMED $TPI_RESUME_COUNT $(cat \"$TPI_CHECKPOINT_DIR/index\" 2> /dev/null)\"\n" +
+				"echo \"$TPI_TASK_INDEX\" > \"$TPI_CHECKPOINT_DIR/index\"",
+			// task.New sets the task count from the parallelism.
+			Variables: common.Variables{"TPI_TASK_COUNT": strPtr("2")},
+			Timeout:   time.Minute,
+		},
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, task.Create(ctx))
+	defer task.Delete(ctx)
+
+	// Replacement processes resume from the checkpoints of their task index.
+	for run := 1; run <= 3; run++ {
+		for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(time.Second) {
+			require.NoError(t, task.Read(ctx))
+			status, err := task.Status(ctx)
+			require.NoError(t, err)
+			// Processes that are gone keep their status reports.
+			if status.Count(common.PhaseSucceeded) == 2*run {
+				break
+			}
+			require.True(t, time.Now().Before(deadline), "timed out waiting for run %d", run)
+		}
+		if run < 3 {
+			require.NoError(t, task.Stop(ctx))
+			require.NoError(t, task.Start(ctx))
+		}
+	}
+
+	logs, err := task.Logs(ctx)
+	require.NoError(t, err)
+	var lines []string
+	for _, log := range logs {
+		line := strings.TrimSpace(log)
+		lines = append(lines, strings.SplitN(line, " ", 2)[1])
+	}
+	require.ElementsMatch(t, []string{
+		"0 false 0", "1 false 0",
+		"0 true 1 0", "1 true 1 1",
+		"0 true 2 0", "1 true 2 1",
+	}, lines)
+}
+
+func strPtr(value string) *string {
+	return &value
+}
+
+func TestTaskPlan(t *testing.T) {
+	ctx := context.Background()
+	directory := t.TempDir()
+	t.Setenv("TPI_LOCAL_DIRECTORY", directory)
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	identifier := common.NewDeterministicIdentifier("plan")
+	task, err := local.New(ctx, cloud, identifier, common.Task{
+		Environment: common.Environment{
+			Script:  "#!/bin/sh\necho hello",
+			Timeout: time.Minute,
+		},
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+
+	plan, err := task.Plan(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []common.PlannedResource{{
+		Type: "Directory",
+		Name: identifier.Long(),
+		Attributes: map[string]string{
+			"path": filepath.Join(directory, identifier.Long()),
+		},
+	}, {
+		Type: "ProcessGroup",
+		Name: identifier.Long(),
+		Attributes: map[string]string{
+			"storage":     filepath.Join(directory, identifier.Long()),
+			"parallelism": "2",
+		},
+	}}, plan)
+
+	// Planning doesn't create anything.
+	identifiers, err := local.List(ctx, cloud)
+	require.NoError(t, err)
+	require.Empty(t, identifiers)
+}
@@ -0,0 +1,323 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"terraform-provider-iterative/task/common"
+)
+
+const (
+	// PhaseWaiting is the status of pipeline stages waiting for the stages
+	// they need to succeed.
+	PhaseWaiting common.Phase = "waiting"
+	// PhaseSkipped is the status of pipeline stages that won't run because a
+	// stage they need failed.
+	PhaseSkipped common.Phase = "skipped"
+)
+
+// stageName matches valid stage names, which are also used as directory names
+// and as part of task identifiers.
+var stageName = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// Stage is a task that runs as part of a pipeline.
+type Stage struct {
+	// Name identifies the stage within the pipeline.
+	Name  string
+	Cloud common.Cloud
+	// Task is the task specification; its output directory is passed to the
+	// stages that need this one, and only downloaded for final stages.
+	Task common.Task
+	// Needs lists the stages that must succeed before this one starts. The
+	// output directory of each of them is copied into the working directory
+	// of this one, under a directory named after the stage.
+	Needs []string
+}
+
+// Pipeline runs a set of tasks in dependency order, passing the outputs of
+// every stage to the stages that need it through the task storage.
+type Pipeline struct {
+	identifier common.Identifier
+	// stages holds the stages in an order where every stage comes after
+	// the stages it needs.
+	stages []Stage
+	// outputs maps the names of the stages needed by others to their output
+	// directories.
+	outputs map[string]string
+}
+
+// StageStatus describes the state of a pipeline stage.
+type StageStatus struct {
+	Name       string
+	Identifier string
+	Phase      common.Phase
+	// Machines holds the status of the stage task machines, once created.
+	Machines common.Status
+	// Error describes why the stage couldn't be read, if it couldn't.
+	Error string
+}
+
+// PipelineStatus describes the state of every stage of a pipeline.
+type PipelineStatus []StageStatus
+
+// NewPipeline validates the given stages and returns a pipeline with them.
+// Stage tasks are identified by the pipeline identifier and the stage name, so
+// pipelines with the same identifier and stages are interchangeable.
+func NewPipeline(identifier common.Identifier, stages []Stage) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, errors.New("pipeline doesn't have any stages")
+	}
+
+	byName := map[string]Stage{}
+	needed := map[string]bool{}
+	for _, stage := range stages {
+		if !stageName.MatchString(stage.Name) {
+			return nil, fmt.Errorf("invalid stage name %#v: use lowercase letters, digits and dashes", stage.Name)
+		}
+		if _, ok := byName[stage.Name]; ok {
+			return nil, fmt.Errorf("duplicate stage %s", stage.Name)
+		}
+		byName[stage.Name] = stage
+		for _, need := range stage.Needs {
+			needed[need] = true
+		}
+	}
+
+	p := &Pipeline{identifier: identifier, outputs: map[string]string{}}
+	for _, stage := range stages {
+		for _, need := range stage.Needs {
+			if _, ok := byName[need]; !ok {
+				return nil, fmt.Errorf("stage %s needs unknown stage %s", stage.Name, need)
+			}
+		}
+
+		provider, err := Lookup(stage.Cloud.Provider)
+		if err != nil {
+			return nil, fmt.Errorf("stage %s: %w", stage.Name, err)
+		}
+		if !provider.Capabilities.Pipelines && (needed[stage.Name] || len(stage.Needs) > 0) {
+			return nil, fmt.Errorf("stage %s: provider %#v can't pass outputs between stages", stage.Name, provider.Name)
+		}
+
+		output := stage.Task.Environment.DirectoryOut
+		switch {
+		case needed[stage.Name] && output == "":
+			return nil, fmt.Errorf("stage %s is needed by other stages but doesn't have an output directory", stage.Name)
+		case needed[stage.Name] && stage.Task.Environment.Transfer.Bundle:
+			// Bundled outputs are only uploaded as archives, which other
+			// stages can't copy their inputs from.
+			return nil, fmt.Errorf("stage %s is needed by other stages, so it can't bundle its transfers", stage.Name)
+		case needed[stage.Name]:
+			// Only the outputs of final stages are downloaded on deletion.
+			p.outputs[stage.Name] = output
+			stage.Task.Environment.DirectoryOut = ""
+		case output != "" && stage.Task.Environment.Directory == "":
+			return nil, fmt.Errorf("stage %s has an output directory but no working directory to download it to", stage.Name)
+		}
+		byName[stage.Name] = stage
+	}
+
+	// Sort the stages topologically, keeping their relative order when possible.
+	placed := map[string]bool{}
+	for len(p.stages) < len(stages) {
+		progress := false
+		for _, stage := range stages {
+			if placed[stage.Name] {
+				continue
+			}
+			ready := true
+			for _, need := range stage.Needs {
+				ready = ready && placed[need]
+			}
+			if ready {
+				p.stages = append(p.stages, byName[stage.Name])
+				placed[stage.Name] = true
+				progress = true
+			}
+		}
+		if !progress {
+			var names []string
+			for _, stage := range stages {
+				if !placed[stage.Name] {
+					names = append(names, stage.Name)
+				}
+			}
+			return nil, fmt.Errorf("stages %s have circular dependencies", strings.Join(names, ", "))
+		}
+	}
+
+	return p, nil
+}
+
+// Stages returns the pipeline stages, in an order where every stage comes
+// after the stages it needs.
+func (p *Pipeline) Stages() []Stage {
+	return p.stages
+}
+
+// Identifier returns the identifier of the task of the given stage.
+func (p *Pipeline) Identifier(stage string) common.Identifier {
+	return p.identifier.Derive(stage)
+}
+
+// Advance reads every stage and creates the ones whose needs have succeeded,
+// so the pipeline progresses every time it's called, and returns the status of
+// every stage. Stages that can't be read are reported with PhaseUnknown and the
+// error, while failures to create stages are returned.
+func (p *Pipeline) Advance(ctx context.Context) (PipelineStatus, error) {
+	status := make(PipelineStatus, len(p.stages))
+	phases := map[string]common.Phase{}
+	tasks := map[string]Task{}
+
+	var ready []int
+	for index, stage := range p.stages {
+		identifier := p.Identifier(stage.Name)
+		status[index] = StageStatus{
+			Name:       stage.Name,
+			Identifier: identifier.Long(),
+			Phase:      PhaseUnknown,
+		}
+
+		tsk, err := New(ctx, stage.Cloud, identifier, stage.Task)
+		if err == nil {
+			err = tsk.Read(ctx)
+		}
+		switch {
+		case err == nil:
+			machines, err := tsk.Status(ctx)
+			if err != nil {
+				status[index].Error = err.Error()
+				break
+			}
+			status[index].Machines = machines
+			status[index].Phase = machines.Summary(stageParallelism(stage))
+			tasks[stage.Name] = tsk
+		case errors.Is(err, common.NotFoundError):
+			status[index].Phase = common.PhaseQueued
+			for _, need := range stage.Needs {
+				switch phases[need] {
+				case common.PhaseSucceeded:
+				case common.PhaseFailed, common.PhaseTimedOut, PhaseSkipped:
+					status[index].Phase = PhaseSkipped
+				default:
+					if status[index].Phase == common.PhaseQueued {
+						status[index].Phase = PhaseWaiting
+					}
+				}
+			}
+			if status[index].Phase == common.PhaseQueued {
+				ready = append(ready, index)
+			}
+		default:
+			status[index].Error = err.Error()
+		}
+		phases[stage.Name] = status[index].Phase
+	}
+
+	// The storage of every stage needed is read before creating any, so a
+	// failure to read one doesn't leave creations running unattended.
+	stages := make([]Stage, len(ready))
+	for i, index := range ready {
+		stage := p.stages[index]
+		stage.Task.Environment.Inputs = append([]common.Input{}, stage.Task.Environment.Inputs...)
+		for _, need := range stage.Needs {
+			remote, err := tasks[need].Storage(ctx)
+			if err != nil {
+				return status, fmt.Errorf("failed to read the storage of stage %s: %w", need, err)
+			}
+			stage.Task.Environment.Inputs = append(stage.Task.Environment.Inputs, common.Input{
+				Source:      remote + "/data/" + p.outputs[need],
+				Destination: need,
+			})
+		}
+		stages[i] = stage
+	}
+
+	// Stages that are ready at the same time are created concurrently.
+	errs := make([]error, len(ready))
+	var wait sync.WaitGroup
+	for i, stage := range stages {
+		wait.Add(1)
+		go func(i int, stage Stage) {
+			defer wait.Done()
+			tsk, err := New(ctx, stage.Cloud, p.Identifier(stage.Name), stage.Task)
+			if err == nil {
+				err = tsk.Create(ctx)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to create stage %s: %w", stage.Name, err)
+			}
+		}(i, stage)
+	}
+	wait.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// Delete deletes the tasks of every stage, starting with the last ones. Like
+// with any other task, the output directories of the final stages are
+// downloaded before deleting them.
+func (p *Pipeline) Delete(ctx context.Context) error {
+	for index := len(p.stages) - 1; index >= 0; index-- {
+		stage := p.stages[index]
+		tsk, err := New(ctx, stage.Cloud, p.Identifier(stage.Name), stage.Task)
+		if err != nil {
+			return err
+		}
+		if err := tsk.Delete(ctx); err != nil && !errors.Is(err, common.NotFoundError) {
+			return fmt.Errorf("failed to delete stage %s: %w", stage.Name, err)
+		}
+	}
+	return nil
+}
+
+// Summary returns the phase of the whole pipeline: failed when any stage
+// failed, succeeded when every stage succeeded, running when any stage is
+// running, and queued otherwise.
+func (s PipelineStatus) Summary() common.Phase {
+	result := common.PhaseQueued
+
+	succeeded := 0
+	for _, stage := range s {
+		switch stage.Phase {
+		case common.PhaseFailed, common.PhaseTimedOut:
+			return common.PhaseFailed
+		case common.PhaseRunning:
+			result = common.PhaseRunning
+		case common.PhaseSucceeded:
+			succeeded++
+		}
+	}
+
+	if succeeded == len(s) {
+		result = common.PhaseSucceeded
+	}
+	return result
+}
+
+// Finished reports whether every stage has either finished or been skipped.
+func (s PipelineStatus) Finished() bool {
+	for _, stage := range s {
+		if !stage.Phase.Finished() && stage.Phase != PhaseSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// stageParallelism returns the number of machines expected by a stage.
+func stageParallelism(stage Stage) int {
+	if stage.Task.Parallelism < 1 {
+		return 1
+	}
+	return int(stage.Task.Parallelism)
+}
@@ -0,0 +1,166 @@
+package task_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+func TestNewPipeline(t *testing.T) {
+	local := common.Cloud{Provider: common.ProviderLocal}
+	output := common.Task{Environment: common.Environment{DirectoryOut: "output"}}
+
+	tests := []struct {
+		description string
+		stages      []task.Stage
+		err         string
+	}{{
+		description: "no stages",
+		err:         "pipeline doesn't have any stages",
+	}, {
+		description: "invalid name",
+		stages:      []task.Stage{{Name: "Train", Cloud: local}},
+		err:         `invalid stage name "Train": use lowercase letters, digits and dashes`,
+	}, {
+		description: "duplicate stage",
+		stages:      []task.Stage{{Name: "a", Cloud: local}, {Name: "a", Cloud: local}},
+		err:         "duplicate stage a",
+	}, {
+		description: "unknown stage",
+		stages:      []task.Stage{{Name: "a", Cloud: local, Needs: []string{"b"}}},
+		err:         "stage a needs unknown stage b",
+	}, {
+		description: "missing output",
+		stages:      []task.Stage{{Name: "a", Cloud: local}, {Name: "b", Cloud: local, Needs: []string{"a"}}},
+		err:         "stage a is needed by other stages but doesn't have an output directory",
+	}, {
+		description: "missing working directory",
+		stages:      []task.Stage{{Name: "a", Cloud: local, Task: output}},
+		err:         "stage a has an output directory but no working directory to download it to",
+	}, {
+		description: "bundled output",
+		stages: []task.Stage{
+			{Name: "a", Cloud: common.Cloud{Provider: common.ProviderAWS}, Task: common.Task{Environment: common.Environment{DirectoryOut: "output", Transfer: common.Transfer{Bundle: true}}}},
+			{Name: "b", Cloud: common.Cloud{Provider: common.ProviderAWS}, Needs: []string{"a"}},
+		},
+		err: "stage a is needed by other stages, so it can't bundle its transfers",
+	}, {
+		description: "circular dependencies",
+		stages: []task.Stage{
+			{Name: "a", Cloud: local, Task: output},
+			{Name: "b", Cloud: local, Task: output, Needs: []string{"a", "c"}},
+			{Name: "c", Cloud: local, Task: output, Needs: []string{"b"}},
+		},
+		err: "stages b, c have circular dependencies",
+	}, {
+		description: "unsupported provider",
+		stages: []task.Stage{
+			{Name: "a", Cloud: local, Task: output},
+			{Name: "b", Cloud: common.Cloud{Provider: common.ProviderK8S}, Needs: []string{"a"}},
+		},
+		err: `stage b: provider "k8s" can't pass outputs between stages`,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, err := task.NewPipeline(common.NewDeterministicIdentifier("test"), test.stages)
+			require.EqualError(t, err, test.err)
+		})
+	}
+
+	pipeline, err := task.NewPipeline(common.NewDeterministicIdentifier("test"), []task.Stage{
+		{Name: "c", Cloud: local, Needs: []string{"a", "b"}},
+		{Name: "a", Cloud: local, Task: output},
+		{Name: "b", Cloud: local, Task: output, Needs: []string{"a"}},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, stage := range pipeline.Stages() {
+		names = append(names, stage.Name)
+		// Intermediate outputs are passed between stages instead of being downloaded.
+		require.Empty(t, stage.Task.Environment.DirectoryOut)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, names)
+	require.NotEqual(t, pipeline.Identifier("a").Long(), pipeline.Identifier("b").Long())
+}
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	stage := func(name, script string, needs ...string) task.Stage {
+		workdir := t.TempDir()
+		require.NoError(t, os.MkdirAll(filepath.Join(workdir, "output"), 0755))
+		return task.Stage{
+			Name:  name,
+			Cloud: cloud,
+			Task: common.Task{
+				Environment: common.Environment{
+					Script:       "#!/bin/sh\n" + script,
+					Timeout:      time.Minute,
+					Directory:    workdir,
+					DirectoryOut: "output",
+				},
+				Parallelism: 1,
+			},
+			Needs: needs,
+		}
+	}
+
+	stages := []task.Stage{
+		stage("first", "echo 1 > output/value"),
+		stage("second", "echo 2 > output/value"),
+		stage("sum", "echo $(($(cat first/value) + $(cat second/value))) > output/result", "first", "second"),
+		stage("broken", "exit 1", "first"),
+		stage("unreachable", "true", "broken"),
+	}
+	pipeline, err := task.NewPipeline(common.NewRandomIdentifier("test"), stages)
+	require.NoError(t, err)
+	defer pipeline.Delete(ctx)
+
+	var status task.PipelineStatus
+	for deadline := time.Now().Add(time.Minute); time.Now().Before(deadline); time.Sleep(time.Second) {
+		status, err = pipeline.Advance(ctx)
+		require.NoError(t, err)
+		if status.Finished() {
+			break
+		}
+	}
+
+	phases := map[string]common.Phase{}
+	for _, stage := range status {
+		phases[stage.Name] = stage.Phase
+	}
+	require.Equal(t, map[string]common.Phase{
+		"first":       common.PhaseSucceeded,
+		"second":      common.PhaseSucceeded,
+		"sum":         common.PhaseSucceeded,
+		"broken":      common.PhaseFailed,
+		"unreachable": task.PhaseSkipped,
+	}, phases)
+	require.Equal(t, common.PhaseFailed, status.Summary())
+
+	// Only the outputs of final stages are downloaded.
+	require.NoError(t, pipeline.Delete(ctx))
+	result, err := os.ReadFile(filepath.Join(stages[2].Task.Environment.Directory, "output", "result"))
+	require.NoError(t, err)
+	require.Equal(t, "3\n", string(result))
+	require.NoFileExists(t, filepath.Join(stages[0].Task.Environment.Directory, "output", "value"))
+}
@@ -0,0 +1,131 @@
+package task
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/mitchellh/go-testing-interface"
+
+	"terraform-provider-iterative/task/aws"
+	"terraform-provider-iterative/task/az"
+	"terraform-provider-iterative/task/gcp"
+	"terraform-provider-iterative/task/k8s"
+	"terraform-provider-iterative/task/local"
+
+	legacyAWS "terraform-provider-iterative/iterative/aws"
+	legacyAzure "terraform-provider-iterative/iterative/azure"
+	legacyGCP "terraform-provider-iterative/iterative/gcp"
+	legacyKubernetes "terraform-provider-iterative/iterative/kubernetes"
+
+	"terraform-provider-iterative/task/common"
+)
+
+func init() {
+	Register(Provider{
+		Name: common.ProviderAWS,
+		Capabilities: Capabilities{
+			Stop:           true,
+			SSH:            true,
+			Excludes:       true,
+			Spot:           true,
+			MachineTypes:   true,
+			Pipelines:      true,
+			Queues:         true,
+			MachineOutputs: true,
+			Bundles:        true,
+		},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+			return aws.New(ctx, cloud, identifier, task)
+		},
+		List:              aws.List,
+		DestroyRunner:     destroyRunner(legacyAWS.ResourceMachineDelete),
+		MachineType:       aws.MachineType,
+		ListResources:     aws.ListResources,
+		RequiredResources: []string{"SecurityGroup", "KeyPair", "LaunchTemplate", "AutoScalingGroup"},
+	})
+
+	Register(Provider{
+		Name:    common.ProviderAZ,
+		Aliases: []common.Provider{"azure"},
+		Capabilities: Capabilities{
+			Stop:           true,
+			SSH:            true,
+			Excludes:       true,
+			Spot:           true,
+			Pipelines:      true,
+			Queues:         true,
+			MachineOutputs: true,
+			Bundles:        true,
+		},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+			return az.New(ctx, cloud, identifier, task)
+		},
+		List:              az.List,
+		DestroyRunner:     destroyRunner(legacyAzure.ResourceMachineDelete),
+		MachineType:       az.MachineType,
+		ListResources:     az.ListResources,
+		RequiredResources: []string{"ResourceGroup", "VirtualMachineScaleSet"},
+	})
+
+	Register(Provider{
+		Name: common.ProviderGCP,
+		Capabilities: Capabilities{
+			Stop:           true,
+			SSH:            true,
+			Excludes:       true,
+			Spot:           true,
+			Pipelines:      true,
+			Queues:         true,
+			MachineOutputs: true,
+			Bundles:        true,
+		},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+			return gcp.New(ctx, cloud, identifier, task)
+		},
+		List:              gcp.List,
+		DestroyRunner:     destroyRunner(legacyGCP.ResourceMachineDelete),
+		MachineType:       gcp.MachineType,
+		ListResources:     gcp.ListResources,
+		RequiredResources: []string{"FirewallRule", "InstanceTemplate", "InstanceGroupManager"},
+	})
+
+	Register(Provider{
+		Name:    common.ProviderK8S,
+		Aliases: []common.Provider{"kubernetes"},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+			return k8s.New(ctx, cloud, identifier, task)
+		},
+		List:              k8s.List,
+		DestroyRunner:     destroyRunner(legacyKubernetes.ResourceMachineDelete),
+		ListResources:     k8s.ListResources,
+		RequiredResources: []string{"ConfigMap", "Job"},
+	})
+
+	Register(Provider{
+		Name: common.ProviderLocal,
+		Capabilities: Capabilities{
+			Stop:           true,
+			Excludes:       true,
+			Pipelines:      true,
+			Queues:         true,
+			MachineOutputs: true,
+		},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
+			return local.New(ctx, cloud, identifier, task)
+		},
+		List: local.List,
+	})
+}
+
+// destroyRunner adapts the machine deletion functions of the legacy
+// iterative_runner resource to the Provider.DestroyRunner signature.
+func destroyRunner(deleteMachine func(context.Context, *schema.ResourceData, interface{}) error) func(context.Context, common.Cloud, string) error {
+	return func(ctx context.Context, cloud common.Cloud, identifier string) error {
+		r := map[string]interface{}{"region": string(cloud.Region)}
+		s := map[string]*schema.Schema{"region": {Type: schema.TypeString}}
+		d := schema.TestResourceDataRaw(&testing.RuntimeT{}, s, r)
+		d.SetId(identifier)
+
+		return deleteMachine(ctx, d, nil)
+	}
+}
@@ -0,0 +1,120 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// Capabilities describes the optional features supported by a provider.
+type Capabilities struct {
+	// Stop reports whether tasks can be stopped and started again.
+	Stop bool
+	// SSH reports whether task machines can be accessed through SSH.
+	SSH bool
+	// Excludes reports whether storage transfers honor exclusion rules.
+	Excludes bool
+	// Spot reports whether tasks can run on spot instances.
+	Spot bool
+	// MachineTypes reports whether tasks can use a list of machine types at
+	// once; for other providers, the types are tried in order on capacity errors.
+	MachineTypes bool
+	// Pipelines reports whether tasks can run as pipeline stages, taking the
+	// outputs of other tasks from their storage as inputs.
+	Pipelines bool
+	// Queues reports whether tasks can run in queue mode, with machines
+	// claiming work items from the task storage.
+	Queues bool
+	// MachineOutputs reports whether every machine can sync its outputs to a
+	// directory of its own in the task storage.
+	MachineOutputs bool
+	// Bundles reports whether transfers to and from the task storage can be
+	// bundled into compressed archives.
+	Bundles bool
+}
+
+// Provider describes a task backend. Provider packages make themselves
+// available to task.New and task.List by passing a Provider to Register.
+type Provider struct {
+	// Name is the value of the cloud attribute selecting this provider.
+	Name common.Provider
+	// Aliases lists alternative names for the provider.
+	Aliases []common.Provider
+	// Capabilities lists the optional features supported by the provider.
+	Capabilities Capabilities
+
+	// New creates a task; it's required.
+	New func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error)
+	// List returns the identifiers of all the existing tasks; it's required.
+	List func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error)
+	// DestroyRunner deletes a machine created by the legacy iterative_runner
+	// resource; it's optional.
+	DestroyRunner func(ctx context.Context, cloud common.Cloud, identifier string) error
+	// MachineType translates generic machine sizes into provider-specific
+	// machine types, for cost estimation; it's optional.
+	MachineType func(machine string) string
+	// ListResources returns every resource named after a task identifier, in
+	// creation order, for garbage collection; it's optional.
+	ListResources func(ctx context.Context, cloud common.Cloud) ([]common.TaskResource, error)
+	// RequiredResources lists the resource types that every complete task
+	// has; tasks missing any of them are considered orphaned.
+	RequiredResources []string
+}
+
+var (
+	providersMutex sync.RWMutex
+	providers      = map[common.Provider]*Provider{}
+)
+
+// Register makes a provider available by its name and aliases. It panics if
+// a provider with the same name was already registered or if any of the
+// required functions is missing.
+func Register(provider Provider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	if provider.New == nil || provider.List == nil {
+		panic(fmt.Sprintf("task: provider %#v must define New and List", provider.Name))
+	}
+
+	registered := &provider
+	for _, name := range append([]common.Provider{provider.Name}, provider.Aliases...) {
+		if _, ok := providers[name]; ok {
+			panic(fmt.Sprintf("task: provider %#v registered twice", name))
+		}
+		providers[name] = registered
+	}
+}
+
+// Lookup returns the provider registered with the given name or alias.
+func Lookup(name common.Provider) (*Provider, error) {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("unknown provider: %#v", name)
+}
+
+// Providers returns every registered provider, sorted by name.
+func Providers() []*Provider {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	var result []*Provider
+	for name, provider := range providers {
+		if name == provider.Name {
+			result = append(result, provider)
+		}
+	}
+
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Name < result[b].Name
+	})
+
+	return result
+}
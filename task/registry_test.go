@@ -0,0 +1,211 @@
+package task_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/pricing"
+	"terraform-provider-iterative/task/common/sizes"
+)
+
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Cleanup(func() { task.Unregister("test") })
+	task.Register(task.Provider{
+		Name:    "test",
+		Aliases: []common.Provider{"test-alias"},
+		Capabilities: task.Capabilities{
+			Stop: true,
+		},
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, t common.Task) (task.Task, error) {
+			return nil, common.NotImplementedError
+		},
+		List: func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+			return []common.Identifier{common.NewDeterministicIdentifier(string(cloud.Provider))}, nil
+		},
+	})
+
+	provider, err := task.Lookup("test-alias")
+	require.NoError(t, err)
+	require.Equal(t, common.Provider("test"), provider.Name)
+	require.True(t, provider.Capabilities.Stop)
+
+	identifiers, err := task.List(ctx, common.Cloud{Provider: "test-alias"})
+	require.NoError(t, err)
+	require.Equal(t, []common.Identifier{common.NewDeterministicIdentifier("test")}, identifiers)
+
+	_, err = task.New(ctx, common.Cloud{Provider: "test"}, common.NewRandomIdentifier(""), common.Task{})
+	require.ErrorIs(t, err, common.NotImplementedError)
+
+	err = task.DestroyRunner(ctx, common.Cloud{Provider: "test"}, "identifier")
+	require.Error(t, err)
+
+	_, err = task.Lookup("nonexistent")
+	require.Error(t, err)
+
+	names := []common.Provider{}
+	for _, provider := range task.Providers() {
+		names = append(names, provider.Name)
+	}
+	require.Contains(t, names, common.Provider("test"))
+	require.NotContains(t, names, common.Provider("test-alias"))
+	require.Subset(t, names, []common.Provider{
+		common.ProviderAWS,
+		common.ProviderAZ,
+		common.ProviderGCP,
+		common.ProviderK8S,
+		common.ProviderLocal,
+	})
+
+	require.Panics(t, func() {
+		task.Register(task.Provider{Name: "test", New: provider.New, List: provider.List})
+	})
+	require.Panics(t, func() {
+		task.Register(task.Provider{Name: "incomplete"})
+	})
+}
+
+func TestEstimateCost(t *testing.T) {
+	estimate, err := task.EstimateCost(common.Cloud{Provider: "aws"}, common.Task{
+		Size:        common.Size{Machine: "s"},
+		Environment: common.Environment{Timeout: 10 * time.Hour},
+		Spot:        common.SpotDisabled,
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+	require.InDelta(t, 2*0.0116, estimate.Hourly, 1e-9)
+	require.InDelta(t, 20*0.0116, estimate.Maximum, 1e-9)
+
+	_, err = task.EstimateCost(common.Cloud{Provider: "local"}, common.Task{})
+	require.ErrorIs(t, err, pricing.ErrUnknownPrice)
+}
+
+func TestValidateMachine(t *testing.T) {
+	require.NoError(t, task.ValidateMachine(common.Cloud{Provider: "azure"}, "m+a100"))
+	require.NoError(t, task.ValidateMachine(common.Cloud{Provider: "local"}, "m"))
+	require.ErrorIs(t, task.ValidateMachine(common.Cloud{Provider: "gcp"}, "m,m+a10g"), sizes.ErrUnavailableSize)
+	require.Error(t, task.ValidateMachine(common.Cloud{Provider: "nonexistent"}, "m"))
+}
+
+type budgetTestTask struct {
+	task.Task
+	status   common.Status
+	remote   string
+	manifest *common.Manifest
+	stopped  bool
+}
+
+func (b *budgetTestTask) Read(ctx context.Context) error { return nil }
+func (b *budgetTestTask) Stop(ctx context.Context) error { b.stopped = true; return nil }
+func (b *budgetTestTask) Events(ctx context.Context) []common.Event {
+	return []common.Event{{Code: "existing"}}
+}
+func (b *budgetTestTask) Status(ctx context.Context) (common.Status, error) {
+	return b.status, nil
+}
+func (b *budgetTestTask) Storage(ctx context.Context) (string, error) {
+	return b.remote, nil
+}
+func (b *budgetTestTask) Manifest(ctx context.Context) (*common.Manifest, error) {
+	if b.manifest == nil {
+		return nil, common.NotFoundError
+	}
+	return b.manifest, nil
+}
+
+func TestBudgetGuard(t *testing.T) {
+	ctx := context.Background()
+
+	catalog := filepath.Join(t.TempDir(), "catalog.json")
+	require.NoError(t, os.WriteFile(catalog, []byte(`{"budget-test": {"large": {"on_demand": 2}}}`), 0644))
+	t.Setenv("TPI_PRICING_CATALOG", catalog)
+
+	var variables common.Variables
+	remote := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(remote, "reports"), 0755))
+	fake := &budgetTestTask{remote: remote, status: common.Status{{
+		Machine: "machine",
+		Phase:   common.PhaseRunning,
+		Started: time.Now().Add(-3 * time.Hour),
+	}}}
+	t.Cleanup(func() { task.Unregister("budget-test") })
+	task.Register(task.Provider{
+		Name: "budget-test",
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, t common.Task) (task.Task, error) {
+			variables = t.Environment.Variables
+			return fake, nil
+		},
+		List: func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+			return nil, nil
+		},
+		MachineType: func(machine string) string {
+			return machine
+		},
+	})
+
+	cloud := common.Cloud{Provider: "budget-test"}
+	cfg := common.Task{
+		Size:        common.Size{Machine: "large"},
+		Environment: common.Environment{Script: "#!/bin/sh"},
+		Spot:        common.SpotDisabled,
+		MaxCost:     10,
+	}
+
+	tsk, err := task.New(ctx, cloud, common.NewRandomIdentifier(""), cfg)
+	require.NoError(t, err)
+	require.Equal(t, "10", *variables["TPI_MAX_COST"])
+	require.Equal(t, "2", *variables["TPI_MACHINE_COST"])
+
+	require.NoError(t, tsk.Read(ctx))
+	require.False(t, fake.stopped)
+	require.Len(t, tsk.Events(ctx), 1)
+
+	fake.status[0].Started = time.Now().Add(-6 * time.Hour)
+	require.NoError(t, tsk.Read(ctx))
+	require.True(t, fake.stopped)
+	events := tsk.Events(ctx)
+	require.Len(t, events, 2)
+	require.Equal(t, common.EventBudgetExceeded, events[1].Code)
+	require.WithinDuration(t, time.Now().Add(-time.Hour), events[1].Time, time.Minute)
+
+	// Machines that are gone still count through their cost reports.
+	fake.stopped = false
+	fake.status[0].Started = time.Now().Add(-time.Hour)
+	require.NoError(t, tsk.Read(ctx))
+	require.False(t, fake.stopped)
+	require.NoError(t, os.WriteFile(filepath.Join(remote, "reports", "cost-gone"), []byte("9.5\n"), 0644))
+	require.NoError(t, tsk.Read(ctx))
+	require.True(t, fake.stopped)
+
+	// The event recorded by the machine that stopped the task takes precedence.
+	report := "2022-01-01T00:00:00Z Spend of $10.50 exceeded the maximum cost of $10\n"
+	require.NoError(t, os.WriteFile(filepath.Join(remote, "reports", "budget-gone"), []byte(report), 0644))
+	require.NoError(t, tsk.Read(ctx))
+	events = tsk.Events(ctx)
+	require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), events[1].Time)
+	require.Equal(t, []string{"Spend of $10.50 exceeded the maximum cost of $10"}, events[1].Description)
+
+	// Partial specifications, like the ones of leo stop, get the limit from
+	// the manifest.
+	require.NoError(t, os.Remove(filepath.Join(remote, "reports", "budget-gone")))
+	fake.stopped = false
+	fake.manifest = &common.Manifest{Task: cfg}
+	tsk, err = task.New(ctx, cloud, common.NewRandomIdentifier(""), common.Task{})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Read(ctx))
+	require.True(t, fake.stopped)
+
+	// Tasks without a known price aren't guarded.
+	cfg.Size.Machine = "unknown"
+	tsk, err = task.New(ctx, cloud, common.NewRandomIdentifier(""), cfg)
+	require.NoError(t, err)
+	require.Same(t, fake, tsk)
+}
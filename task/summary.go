@@ -0,0 +1,118 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"terraform-provider-iterative/task/common"
+)
+
+// PhaseUnknown is the status of tasks that couldn't be read.
+const PhaseUnknown common.Phase = "unknown"
+
+// Summary describes the state of an existing task along with the settings
+// recorded in its manifest; settings are empty for tasks without one.
+type Summary struct {
+	Identifier string       `json:"identifier"`
+	Status     common.Phase `json:"status"`
+	// Machines counts the task machines in every phase.
+	Machines    map[common.Phase]int `json:"machines"`
+	Created     *time.Time           `json:"created,omitempty"`
+	MachineType string               `json:"machine_type,omitempty"`
+	Parallelism uint16               `json:"parallelism,omitempty"`
+	Region      common.Region        `json:"region"`
+	Tags        map[string]string    `json:"tags,omitempty"`
+	// Error describes why the task couldn't be read, if it couldn't.
+	Error string `json:"error,omitempty"`
+}
+
+// Summarize reads the given tasks concurrently, with at most workers of them
+// at a time, and returns their summaries in the same order. Tasks that can't be
+// read are reported with PhaseUnknown and the error instead of failing the rest.
+func Summarize(ctx context.Context, cloud common.Cloud, identifiers []common.Identifier, workers int) []Summary {
+	if workers < 1 {
+		workers = 1
+	}
+
+	summaries := make([]Summary, len(identifiers))
+	indexes := make(chan int)
+
+	var wait sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for index := range indexes {
+				summaries[index] = summarize(ctx, cloud, identifiers[index])
+			}
+		}()
+	}
+
+	for index := range identifiers {
+		indexes <- index
+	}
+	close(indexes)
+	wait.Wait()
+
+	return summaries
+}
+
+func summarize(ctx context.Context, cloud common.Cloud, identifier common.Identifier) Summary {
+	summary := Summary{
+		Identifier: identifier.Long(),
+		Status:     PhaseUnknown,
+		Machines:   map[common.Phase]int{},
+		Region:     cloud.Region,
+	}
+
+	fail := func(err error) Summary {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	tsk, err := New(ctx, cloud, identifier, common.Task{})
+	if err != nil {
+		return fail(err)
+	}
+
+	if err := tsk.Read(ctx); err != nil {
+		return fail(err)
+	}
+
+	manifest, err := tsk.Manifest(ctx)
+	switch {
+	case err == nil:
+		created := manifest.Created
+		summary.Created = &created
+		summary.MachineType = manifest.MachineType
+		summary.Parallelism = manifest.Task.Parallelism
+		summary.Region = manifest.Region
+		summary.Tags = manifest.Tags
+	case errors.Is(err, common.NotFoundError), errors.Is(err, common.NotImplementedError):
+	default:
+		return fail(err)
+	}
+
+	status, err := tsk.Status(ctx)
+	if err != nil {
+		return fail(err)
+	}
+
+	for _, machine := range status {
+		summary.Machines[machine.Phase]++
+	}
+
+	// Without a manifest, assume that every expected machine was created.
+	parallelism := int(summary.Parallelism)
+	if parallelism == 0 {
+		parallelism = len(status)
+	}
+	if parallelism == 0 {
+		parallelism = 1
+	}
+	summary.Status = status.Summary(parallelism)
+
+	return summary
+}
@@ -0,0 +1,94 @@
+package task_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+type summaryTestTask struct {
+	task.Task
+	manifest *common.Manifest
+	status   common.Status
+}
+
+func (s *summaryTestTask) Read(ctx context.Context) error { return nil }
+func (s *summaryTestTask) Manifest(ctx context.Context) (*common.Manifest, error) {
+	if s.manifest == nil {
+		return nil, common.NotFoundError
+	}
+	return s.manifest, nil
+}
+func (s *summaryTestTask) Status(ctx context.Context) (common.Status, error) {
+	return s.status, nil
+}
+
+func TestSummarize(t *testing.T) {
+	ctx := context.Background()
+
+	created := time.Now().Add(-time.Hour).UTC()
+	described := common.NewDeterministicIdentifier("described")
+	undescribed := common.NewDeterministicIdentifier("undescribed")
+	broken := common.NewDeterministicIdentifier("broken")
+	tasks := map[common.Identifier]*summaryTestTask{
+		described: {
+			manifest: &common.Manifest{
+				Created:     created,
+				Region:      "us-west-1",
+				MachineType: "t2.micro",
+				Tags:        map[string]string{"team": "ml"},
+				Task:        common.Task{Parallelism: 2},
+			},
+			status: common.Status{
+				{Machine: "a", Phase: common.PhaseRunning},
+				{Machine: "b", Phase: common.PhaseSucceeded},
+			},
+		},
+		undescribed: {
+			status: common.Status{{Machine: "a", Phase: common.PhaseSucceeded}},
+		},
+	}
+	t.Cleanup(func() { task.Unregister("summary-test") })
+	task.Register(task.Provider{
+		Name: "summary-test",
+		New: func(ctx context.Context, cloud common.Cloud, identifier common.Identifier, t common.Task) (task.Task, error) {
+			if tsk, ok := tasks[identifier]; ok {
+				return tsk, nil
+			}
+			return nil, errors.New("broken")
+		},
+		List: func(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
+			return nil, nil
+		},
+	})
+
+	cloud := common.Cloud{Provider: "summary-test", Region: "us-west"}
+	summaries := task.Summarize(ctx, cloud, []common.Identifier{described, undescribed, broken}, 2)
+	require.Equal(t, []task.Summary{{
+		Identifier:  described.Long(),
+		Status:      common.PhaseQueued,
+		Machines:    map[common.Phase]int{common.PhaseRunning: 1, common.PhaseSucceeded: 1},
+		Created:     &created,
+		MachineType: "t2.micro",
+		Parallelism: 2,
+		Region:      "us-west-1",
+		Tags:        map[string]string{"team": "ml"},
+	}, {
+		Identifier: undescribed.Long(),
+		Status:     common.PhaseSucceeded,
+		Machines:   map[common.Phase]int{common.PhaseSucceeded: 1},
+		Region:     "us-west",
+	}, {
+		Identifier: broken.Long(),
+		Status:     task.PhaseUnknown,
+		Machines:   map[common.Phase]int{},
+		Region:     "us-west",
+		Error:      "broken",
+	}}, summaries)
+}
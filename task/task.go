@@ -2,52 +2,205 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
-
-	"terraform-provider-iterative/task/aws"
-	"terraform-provider-iterative/task/az"
-	"terraform-provider-iterative/task/gcp"
-	"terraform-provider-iterative/task/k8s"
+	"strconv"
 
 	"terraform-provider-iterative/task/common"
+	"terraform-provider-iterative/task/common/machine"
+	"terraform-provider-iterative/task/common/pricing"
+	"terraform-provider-iterative/task/common/sizes"
 	"terraform-provider-iterative/task/common/ssh"
 )
 
 func List(ctx context.Context, cloud common.Cloud) ([]common.Identifier, error) {
-	switch cloud.Provider {
-	case common.ProviderAWS:
-		return aws.List(ctx, cloud)
-	case common.ProviderAZ:
-		return az.List(ctx, cloud)
-	case common.ProviderGCP:
-		return gcp.List(ctx, cloud)
-	case common.ProviderK8S:
-		return k8s.List(ctx, cloud)
-	default:
-		return nil, fmt.Errorf("unknown provider: %#v", cloud.Provider)
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return nil, err
 	}
+
+	cloud.Provider = provider.Name
+
+	return provider.List(ctx, cloud)
 }
 
 func New(ctx context.Context, cloud common.Cloud, identifier common.Identifier, task common.Task) (Task, error) {
-	switch cloud.Provider {
-	case common.ProviderAWS:
-		return aws.New(ctx, cloud, identifier, task)
-	case common.ProviderAZ:
-		return az.New(ctx, cloud, identifier, task)
-	case common.ProviderGCP:
-		return gcp.New(ctx, cloud, identifier, task)
-	case common.ProviderK8S:
-		return k8s.New(ctx, cloud, identifier, task)
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	cloud.Provider = provider.Name
+
+	if task.Environment.Queue.Enabled() && !provider.Capabilities.Queues {
+		return nil, fmt.Errorf("provider %#v doesn't support work queues", provider.Name)
+	}
+	if task.Environment.Queue.Retries < 0 {
+		return nil, errors.New("queue retries can't be negative")
+	}
+	if task.Environment.PerMachineOutput && !provider.Capabilities.MachineOutputs {
+		return nil, fmt.Errorf("provider %#v doesn't support per-machine outputs", provider.Name)
+	}
+	switch task.Environment.OutputMerge {
+	case common.MergeNone, common.MergeNewest, common.MergeStrict:
 	default:
-		return nil, fmt.Errorf("unknown provider: %#v", cloud.Provider)
+		return nil, fmt.Errorf("unknown output merge policy %#v", task.Environment.OutputMerge)
+	}
+	if task.Environment.Transfer.Bundle && !provider.Capabilities.Bundles {
+		return nil, fmt.Errorf("provider %#v doesn't support bundled transfers", provider.Name)
+	}
+	if err := machine.ValidateTransfer(task.Environment.Transfer); err != nil {
+		return nil, err
 	}
+	task.Environment.Variables = taskVariables(task)
+
+	construct := func(ctx context.Context, cloud common.Cloud, task common.Task) (Task, error) {
+		// Partial specifications are guarded too, with the maximum cost
+		// recorded in the manifest.
+		if task.MaxCost <= 0 && !task.Partial() {
+			return provider.New(ctx, cloud, identifier, task)
+		}
+		return newBudgetGuard(ctx, provider, cloud, identifier, task)
+	}
+
+	machineTypes := provider.Capabilities.MachineTypes || len(task.Size.Machines()) < 2
+	if len(cloud.FallbackRegions) == 0 && machineTypes {
+		return construct(ctx, cloud, task)
+	}
+
+	return newFallback(ctx, cloud, task, machineTypes, construct)
+}
+
+// taskVariables returns the task variables along with TPI_TASK_COUNT, the
+// number of machines; every machine also gets a unique index below it through
+// TPI_TASK_INDEX, so work can be sharded among them. Tasks in queue mode also
+// get TPI_WORK_QUEUE, so machines claim work items instead, along with
+// TPI_QUEUE_RETRIES when failed items are retried, and tasks with
+// per-machine outputs get TPI_PER_MACHINE_OUTPUT, so machines sync their
+// working directory to data/machines/<index>. Tasks with bundled transfers get
+// TPI_BUNDLE, and the transfer options are passed to rclone.
+func taskVariables(task common.Task) common.Variables {
+	count := "1"
+	if task.Parallelism > 1 {
+		count = strconv.Itoa(int(task.Parallelism))
+	}
+
+	variables := common.Variables{}
+	for name, value := range task.Environment.Variables {
+		variables[name] = value
+	}
+	variables["TPI_TASK_COUNT"] = &count
+	if task.Environment.Queue.Enabled() {
+		queue := "true"
+		variables["TPI_WORK_QUEUE"] = &queue
+		if retries := task.Environment.Queue.Retries; retries > 0 {
+			value := strconv.Itoa(retries)
+			variables["TPI_QUEUE_RETRIES"] = &value
+		}
+	}
+	if task.Environment.PerMachineOutput {
+		perMachine := "true"
+		variables["TPI_PER_MACHINE_OUTPUT"] = &perMachine
+	}
+	if task.Environment.Transfer.Bundle {
+		bundle := "true"
+		variables["TPI_BUNDLE"] = &bundle
+	}
+	// Machines pass the transfer options to rclone through its environment.
+	if transfers := task.Environment.Transfer.Transfers; transfers > 0 {
+		value := strconv.Itoa(transfers)
+		variables["RCLONE_TRANSFERS"] = &value
+	}
+	if checkers := task.Environment.Transfer.Checkers; checkers > 0 {
+		value := strconv.Itoa(checkers)
+		variables["RCLONE_CHECKERS"] = &value
+	}
+	if limit := task.Environment.Transfer.BandwidthLimit; limit != "" {
+		variables["RCLONE_BWLIMIT"] = &limit
+	}
+	return variables
+}
+
+// EstimateCost estimates the cost of running the given task, using the
+// machine type resolved by the provider and the pricing catalog.
+func EstimateCost(cloud common.Cloud, task common.Task) (pricing.Estimate, error) {
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return pricing.Estimate{}, err
+	}
+
+	price, err := lookupPrice(provider, task)
+	if err != nil {
+		return pricing.Estimate{}, err
+	}
+
+	return pricing.NewEstimate(price, task.Spot, task.Parallelism, task.Environment.Timeout), nil
+}
+
+// ValidateMachine checks that every generic size in the given machine type
+// list is available on the cloud provider.
+func ValidateMachine(cloud common.Cloud, machine string) error {
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return err
+	}
+
+	return sizes.Validate(provider.Name, machine)
+}
+
+// lookupPrice returns the price of the machine type used by the task.
+func lookupPrice(provider *Provider, task common.Task) (pricing.Price, error) {
+	if provider.MachineType == nil {
+		return pricing.Price{}, fmt.Errorf("%w: provider %#v doesn't have a pricing catalog", pricing.ErrUnknownPrice, provider.Name)
+	}
+
+	catalog, err := pricing.Load()
+	if err != nil {
+		return pricing.Price{}, err
+	}
+
+	// Machine type lists are priced by their preferred type.
+	return catalog.Lookup(provider.Name, provider.MachineType(task.Size.Machines()[0]))
+}
+
+// ExitStatuses returns the exit code and result of the task script for every
+// machine of the given task where it has terminated.
+func ExitStatuses(ctx context.Context, t Task) ([]common.ExitStatus, error) {
+	status, err := t.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status.ExitStatuses(), nil
+}
+
+// DestroyRunner deletes a machine created by the legacy iterative_runner resource.
+func DestroyRunner(ctx context.Context, cloud common.Cloud, identifier string) error {
+	provider, err := Lookup(cloud.Provider)
+	if err != nil {
+		return err
+	}
+
+	if provider.DestroyRunner == nil {
+		return fmt.Errorf("provider %#v doesn't support runners", cloud.Provider)
+	}
+
+	return provider.DestroyRunner(ctx, cloud, identifier)
 }
 
 // Task defines the interface implemented by provider-specific task resources.
 type Task interface {
 	common.Resource
 
+	// Update applies the current attributes to an existing task: it rescales
+	// it to the requested parallelism, retags its resources and refreshes the
+	// machine templates, so new machines pick up environment and timeout changes.
+	Update(ctx context.Context) error
+
+	// Plan resolves the data sources and describes the resources that Create
+	// would make, without creating anything.
+	Plan(ctx context.Context) ([]common.PlannedResource, error)
+
 	Start(ctx context.Context) error
 	Stop(ctx context.Context) error
 
@@ -55,10 +208,24 @@ type Task interface {
 	Push(ctx context.Context) error
 	// Pull downloads the output directory from remote storage.
 	Pull(ctx context.Context) error
+	// Storage returns the rclone connection string of the task storage, once
+	// the task has been created or read, so other tasks can copy from it.
+	Storage(ctx context.Context) (string, error)
+
+	// Queue counts the work items of a task in queue mode by state, or returns
+	// common.NotFoundError for tasks without a queue.
+	Queue(ctx context.Context) (common.QueueStatus, error)
+
+	// Manifest returns the manifest written to the remote storage at creation,
+	// or common.NotFoundError for tasks created without one.
+	Manifest(ctx context.Context) (*common.Manifest, error)
 
 	Status(ctx context.Context) (common.Status, error)
 	Events(ctx context.Context) []common.Event
 	Logs(ctx context.Context) ([]string, error)
+	// StreamLogs returns the log lines written after the given cursor, along
+	// with the updated cursor; an empty cursor starts from the beginning.
+	StreamLogs(ctx context.Context, cursor common.LogCursor) ([]common.LogLine, common.LogCursor, error)
 
 	// To be refactored.
 	GetIdentifier(ctx context.Context) common.Identifier
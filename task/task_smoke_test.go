@@ -67,8 +67,9 @@ func TestTaskSmoke(t *testing.T) {
 	enableAZ := os.Getenv("SMOKE_TEST_ENABLE_AZ") != ""
 	enableGCP := os.Getenv("SMOKE_TEST_ENABLE_GCP") != ""
 	enableK8S := os.Getenv("SMOKE_TEST_ENABLE_K8S") != ""
+	enableLocal := os.Getenv("SMOKE_TEST_ENABLE_LOCAL") != ""
 
-	enableALL := !enableAWS && !enableAZ && !enableGCP && !enableK8S
+	enableALL := !enableAWS && !enableAZ && !enableGCP && !enableK8S && !enableLocal
 
 	targetName := os.Getenv("SMOKE_TEST_TARGET")
 	if targetName == "" {
@@ -80,10 +81,11 @@ func TestTaskSmoke(t *testing.T) {
 	}
 
 	providers := map[common.Provider]bool{
-		common.ProviderAWS: enableAWS || enableALL,
-		common.ProviderAZ:  enableAZ || enableALL,
-		common.ProviderGCP: enableGCP || enableALL,
-		common.ProviderK8S: enableK8S || enableALL,
+		common.ProviderAWS:   enableAWS || enableALL,
+		common.ProviderAZ:    enableAZ || enableALL,
+		common.ProviderGCP:   enableGCP || enableALL,
+		common.ProviderK8S:   enableK8S || enableALL,
+		common.ProviderLocal: enableLocal || enableALL,
 	}
 
 	if testName == "" {
@@ -198,7 +200,7 @@ func TestTaskSmoke(t *testing.T) {
 				require.NoError(t, err)
 				t.Log(status)
 
-				if status[common.StatusCodeFailed] > 0 {
+				if status.Count(common.PhaseFailed) > 0 {
 					break
 				}
 
@@ -214,8 +216,8 @@ func TestTaskSmoke(t *testing.T) {
 				status, err := newTask.Status(ctx)
 				require.NoError(t, err)
 
-				if status[common.StatusCodeActive] == 0 &&
-					status[common.StatusCodeSucceeded] > 0 {
+				if status.Count(common.PhaseRunning) == 0 &&
+					status.Count(common.PhaseSucceeded) > 0 {
 					break
 				}
 
@@ -0,0 +1,251 @@
+package task_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"terraform-provider-iterative/task"
+	"terraform-provider-iterative/task/common"
+)
+
+func TestTaskIndex(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	tsk, err := task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{
+			Script:  "#!/bin/sh\necho \"index $TPI_TASK_INDEX of $TPI_TASK_COUNT\"",
+			Timeout: time.Minute,
+		},
+		Parallelism: 3,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+	defer tsk.Delete(ctx)
+
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		require.NoError(t, tsk.Read(ctx))
+		status, err := tsk.Status(ctx)
+		require.NoError(t, err)
+		if status.Count(common.PhaseSucceeded) == 3 {
+			break
+		}
+	}
+
+	logs, err := tsk.Logs(ctx)
+	require.NoError(t, err)
+
+	var indexes []string
+	for _, log := range logs {
+		indexes = append(indexes, regexp.MustCompile(`index \d+ of \d+`).FindString(log))
+	}
+	sort.Strings(indexes)
+	require.Equal(t, []string{"index 0 of 3", "index 1 of 3", "index 2 of 3"}, indexes)
+}
+
+func TestTaskQueue(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	items := filepath.Join(t.TempDir(), "items.txt")
+	require.NoError(t, os.WriteFile(items, []byte("a\nb\nbad\nc\nd\ne\n"), 0644))
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	tsk, err := task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{
+			Script:  "#!/bin/sh\necho \"ran $TPI_WORK_ITEM\"\ntest \"$TPI_WORK_ITEM\" != bad",
+			Timeout: time.Minute,
+			Queue:   common.Queue{File: items},
+		},
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+	defer tsk.Delete(ctx)
+
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		require.NoError(t, tsk.Read(ctx))
+		status, err := tsk.Status(ctx)
+		require.NoError(t, err)
+		if status.Count(common.PhaseSucceeded)+status.Count(common.PhaseFailed) == 2 {
+			break
+		}
+	}
+
+	queue, err := tsk.Queue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, common.QueueStatus{Done: 5, Failed: 1}, queue)
+
+	// Every item runs exactly once.
+	logs, err := tsk.Logs(ctx)
+	require.NoError(t, err)
+	var runs []string
+	for _, log := range logs {
+		runs = append(runs, regexp.MustCompile(`ran \w+`).FindAllString(log, -1)...)
+	}
+	sort.Strings(runs)
+	require.Equal(t, "ran a,ran b,ran bad,ran c,ran d,ran e", strings.Join(runs, ","))
+
+	_, err = task.New(ctx, common.Cloud{Provider: common.ProviderK8S}, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{Queue: common.Queue{File: items}},
+	})
+	require.EqualError(t, err, `provider "k8s" doesn't support work queues`)
+}
+
+func TestTaskQueueRetries(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+
+	items := filepath.Join(t.TempDir(), "items.txt")
+	require.NoError(t, os.WriteFile(items, []byte("good\nflaky\nbad\n"), 0644))
+	markers := t.TempDir()
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	// The flaky item only fails the first time, and the bad one always fails.
+	script := "#!/bin/sh\necho \"ran $TPI_WORK_ITEM\"\n" +
+		"test \"$TPI_WORK_ITEM\" = flaky && ! test -f " + markers + "/flaky && touch " + markers + "/flaky && exit 1\n" +
+		"test \"$TPI_WORK_ITEM\" != bad"
+	tsk, err := task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{
+			Script:  script,
+			Timeout: time.Minute,
+			Queue:   common.Queue{File: items, Retries: 2},
+		},
+		Parallelism: 1,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+	defer tsk.Delete(ctx)
+
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		require.NoError(t, tsk.Read(ctx))
+		status, err := tsk.Status(ctx)
+		require.NoError(t, err)
+		if status.Count(common.PhaseSucceeded)+status.Count(common.PhaseFailed) == 1 {
+			break
+		}
+	}
+
+	queue, err := tsk.Queue(ctx)
+	require.NoError(t, err)
+	require.Equal(t, common.QueueStatus{Done: 2, Failed: 1}, queue)
+
+	// Failed items run again until they run out of retries.
+	logs, err := tsk.Logs(ctx)
+	require.NoError(t, err)
+	var runs []string
+	for _, log := range logs {
+		runs = append(runs, regexp.MustCompile(`ran \w+`).FindAllString(log, -1)...)
+	}
+	sort.Strings(runs)
+	require.Equal(t, "ran bad,ran bad,ran bad,ran flaky,ran flaky,ran good", strings.Join(runs, ","))
+
+	_, err = task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{Queue: common.Queue{File: items, Retries: -1}},
+	})
+	require.EqualError(t, err, "queue retries can't be negative")
+}
+
+func TestTaskPerMachineOutput(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+	workdir := t.TempDir()
+
+	cloud := common.Cloud{
+		Provider: common.ProviderLocal,
+		Timeouts: common.Timeouts{
+			Create: time.Minute,
+			Read:   time.Minute,
+			Update: time.Minute,
+			Delete: time.Minute,
+		},
+	}
+	tsk, err := task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{
+			Script:           "#!/bin/sh\nmkdir -p output\necho \"$TPI_TASK_INDEX\" > output/index",
+			Timeout:          time.Minute,
+			Directory:        workdir,
+			DirectoryOut:     "output",
+			PerMachineOutput: true,
+		},
+		Parallelism: 2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, tsk.Create(ctx))
+
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+		require.NoError(t, tsk.Read(ctx))
+		status, err := tsk.Status(ctx)
+		require.NoError(t, err)
+		if status.Count(common.PhaseSucceeded) == 2 {
+			break
+		}
+	}
+	require.NoError(t, tsk.Delete(ctx))
+
+	for _, index := range []string{"0", "1"} {
+		contents, err := os.ReadFile(filepath.Join(workdir, "machines", index, "output", "index"))
+		require.NoError(t, err)
+		require.Equal(t, index+"\n", string(contents))
+	}
+	require.NoDirExists(t, filepath.Join(workdir, "output"))
+
+	_, err = task.New(ctx, common.Cloud{Provider: common.ProviderLocal}, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{PerMachineOutput: true, OutputMerge: "random"},
+	})
+	require.EqualError(t, err, `unknown output merge policy "random"`)
+}
+
+func TestTaskTransfer(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("TPI_LOCAL_DIRECTORY", t.TempDir())
+	cloud := common.Cloud{Provider: common.ProviderLocal}
+
+	_, err := task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{Transfer: common.Transfer{Bundle: true}},
+	})
+	require.EqualError(t, err, `provider "local" doesn't support bundled transfers`)
+
+	_, err = task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{Transfer: common.Transfer{BandwidthLimit: "fast"}},
+	})
+	require.ErrorContains(t, err, `invalid bandwidth limit "fast"`)
+
+	_, err = task.New(ctx, cloud, common.NewRandomIdentifier("test"), common.Task{
+		Environment: common.Environment{Transfer: common.Transfer{Transfers: 16, BandwidthLimit: "10M"}},
+	})
+	require.NoError(t, err)
+}